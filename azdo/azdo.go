@@ -7,6 +7,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
@@ -90,7 +91,13 @@ func LogCmdPrependPath(path string) {
 // Markdown features. The path must be a full path.
 // https://docs.microsoft.com/en-us/azure/devops/pipelines/scripts/logging-commands?view=azure-devops&tabs=bash#uploadsummary-add-some-markdown-content-to-the-build-summary
 func LogCmdUploadSummary(path string) {
-	fmt.Printf("##vso[task.uploadsummary]%v\n", path)
+	LogCmdUploadSummaryTo(os.Stdout, path)
+}
+
+// LogCmdUploadSummaryTo is LogCmdUploadSummary, but writes the logging command to w. AzDO finds
+// the command even if w adds a prefix to the line.
+func LogCmdUploadSummaryTo(w io.Writer, path string) {
+	fmt.Fprintf(w, "##vso[task.uploadsummary]%v\n", path)
 }
 
 // AzDOBuildDetectionDoc describes how AzDO build detection works, listing the env vars used. Use
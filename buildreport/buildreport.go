@@ -70,10 +70,18 @@ func Update(ctx context.Context, owner, repoName, pat string, issue int, s State
 
 // UpdateIssueBody updates the given issue with new state. Requires the target GitHub repo to have
 // the wiki activated to perform safer concurrent updates than a simple issue description edit.
-func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int, s State) error {
+func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int, s ...State) error {
+	_, err := UpdateIssueBodyReturnPrevious(ctx, owner, repoName, pat, issue, s...)
+	return err
+}
+
+// UpdateIssueBodyReturnPrevious is UpdateIssueBody, but also returns the states that were in the
+// report before the update with the same IDs as the updated states. This lets the caller tell which
+// updates are changes, for example to only send a notification the first time an entry fails.
+func UpdateIssueBodyReturnPrevious(ctx context.Context, owner, repoName, pat string, issue int, s ...State) ([]State, error) {
 	client, err := githubutil.NewClient(ctx, pat)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// To handle concurrent edits, use Git and "git push".
@@ -82,17 +90,19 @@ func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int
 	// descriptions isn't safe concurrently. The ETags provided are weak, so If-Match doesn't work.
 	// If-Unmodified-Since seems to be ignored. The "update ref without force update" API allows
 	// forced updates if the API calls happen close together.
+	webURL := githubutil.WebURL(githubutil.APIURL())
 	auther := gitcmd.GitHubPATAuther{
 		// Username doesn't need to match PAT owner to auth a Git HTTP URL. Use a placeholder.
-		User: "unused-placeholder",
-		PAT:  pat,
+		User:   "unused-placeholder",
+		PAT:    pat,
+		WebURL: webURL,
 	}
 	// Use the wiki to store the data. This makes it visible without causing noise in the main repo.
-	url := "https://github.com/" + owner + "/" + repoName + ".wiki.git"
+	url := webURL + "/" + owner + "/" + repoName + ".wiki.git"
 
 	gitDir, err := gitcmd.NewTempGitRepo()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer gitcmd.AttemptDelete(gitDir)
 
@@ -101,12 +111,13 @@ func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int
 	dataPath := filepath.Join(gitDir, dataFilename)
 
 	var body string
+	var previous []State
 
 	startTime := time.Now()
 	for {
 		elapsed := time.Now().Sub(startTime)
 		if elapsed > reportRetryTimeoutDuration {
-			return fmt.Errorf("retry timeout %v expended", reportRetryTimeoutDuration)
+			return nil, fmt.Errorf("retry timeout %v expended", reportRetryTimeoutDuration)
 		}
 
 		// githubutil.Retry is designed to handle infra flakiness and rate limiting. We want this,
@@ -132,10 +143,13 @@ func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int
 			}
 
 			rc := parseReportComment(existingBody)
-			rc.update(s)
+			previous = rc.find(s)
+			for _, state := range s {
+				rc.update(state)
+			}
 
 			// Tweak body generation fields that only apply to the issue body, not notifications.
-			rc.wikiURL = "https://github.com/" + owner + "/" + repoName + "/wiki/" + pageName
+			rc.wikiURL = webURL + "/" + owner + "/" + repoName + "/wiki/" + pageName
 			rc.key = true
 
 			body, err = rc.body()
@@ -181,8 +195,8 @@ func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int
 	// itself is safe: the next UpdateIssueBody call will fix the issue and post the correct
 	// data. The report includes a link to the actual data in case it's important to get the
 	// real data during a release.
-	log.Printf("Copying report to https://github.com/%v/%v/issues/%v description...", owner, repoName, issue)
-	return githubutil.Retry(func() error {
+	log.Printf("Copying report to %v/%v/%v/issues/%v description...", webURL, owner, repoName, issue)
+	err = githubutil.Retry(func() error {
 		edit, _, err := client.Issues.Edit(ctx, owner, repoName, issue, &github.IssueRequest{Body: &body})
 		if err != nil {
 			return err
@@ -190,6 +204,10 @@ func UpdateIssueBody(ctx context.Context, owner, repoName, pat string, issue int
 		log.Printf("Edit successful:\n%v\n", edit.ID)
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
 }
 
 // Notify determines if a notification is necessary for the given status update and sends it.
@@ -223,26 +241,31 @@ func Notify(ctx context.Context, owner string, repoName string, pat string, issu
 	if notification == "" {
 		return nil
 	}
+	return Comment(ctx, owner, repoName, pat, issue, notification, s)
+}
 
+// Comment posts a comment on the issue that starts with notification, followed by a table of the
+// given states and a link to the issue description.
+func Comment(ctx context.Context, owner string, repoName string, pat string, issue int, notification string, s ...State) error {
 	client, err := githubutil.NewClient(ctx, pat)
 	if err != nil {
 		return err
 	}
 
 	return githubutil.Retry(func() error {
-		c := commentBody{reports: []State{*&s}}
+		c := commentBody{reports: append([]State(nil), s...)}
 		body, err := c.body()
 		if err != nil {
 			return err
 		}
 
-		notification += body +
+		comment := notification + body +
 			"\n<sub>See the [issue description](" +
-			"https://github.com/" + owner + "/" + repoName + "/issues/" + strconv.Itoa(issue) +
+			githubutil.WebURL(githubutil.APIURL()) + "/" + owner + "/" + repoName + "/issues/" + strconv.Itoa(issue) +
 			") for the latest build status.</sub>"
 
 		notificationComment, _, err := client.Issues.CreateComment(
-			ctx, owner, repoName, issue, &github.IssueComment{Body: &notification})
+			ctx, owner, repoName, issue, &github.IssueComment{Body: &comment})
 		if err != nil {
 			return err
 		}
@@ -322,6 +345,20 @@ func parseReportComment(body string) commentBody {
 	}
 }
 
+// find returns the reports in c with the same IDs as any of the given reports.
+func (c *commentBody) find(reports []State) []State {
+	var found []State
+	for _, r := range c.reports {
+		for _, report := range reports {
+			if r.ID == report.ID {
+				found = append(found, r)
+				break
+			}
+		}
+	}
+	return found
+}
+
 func (c *commentBody) update(report State) {
 	found := false
 	for i := range c.reports {
@@ -138,3 +138,18 @@ func Test_commentBody_body_UpdateExisting(t *testing.T) {
 	}
 	goldentest.Check(t, "go test ./buildreport -run "+t.Name(), filepath.Join("testdata", "report", "update-existing.golden.md"), got)
 }
+
+func Test_commentBody_find(t *testing.T) {
+	cb := commentBody{
+		reports: []State{
+			{ID: "1", Status: SymbolFailed},
+			{ID: "2", Status: SymbolSucceeded},
+			{ID: "3", Status: SymbolInProgress},
+		},
+	}
+	got := cb.find([]State{{ID: "3"}, {ID: "1"}, {ID: "4"}})
+	want := []State{cb.reports[0], cb.reports[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("find() = %#v, want %#v", got, want)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 
 	"github.com/microsoft/go-infra/buildmodel"
+	"github.com/microsoft/go-infra/githubutil"
 )
 
 const description = `
@@ -28,6 +29,7 @@ To run this command locally, it may be useful to specify Git addresses like
 
 func main() {
 	f := buildmodel.BindPRFlags()
+	githubutil.BindAPIURLFlag()
 
 	buildmodel.ParseBoundFlags(description)
 
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/go-infra/patch"
+	"github.com/microsoft/go-infra/subcmd"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "check",
+		Summary: "Check whether the patch files apply cleanly to a given commit, without changing the submodule.",
+		Description: `
+
+This command applies each patch file in order onto the given base commit in a temporary clone of the
+submodule, and reports whether each patch applies cleanly, applies with fuzz or offset, or
+conflicts. If a patch conflicts, check skips it and continues with the next patch, so a conflict may
+also cause conflicts in later patches that depend on it.
+
+The base commit must exist in the submodule. To check a new upstream commit, fetch it into the
+submodule first.
+
+check exits with a nonzero exit code if any patch conflicts. With "-strict", it also exits with a
+nonzero exit code if any patch applies with fuzz or offset.
+` + repoRootSearchDescription,
+		Handle: handleCheck,
+	})
+}
+
+func handleCheck(p subcmd.ParseFunc) error {
+	base := flag.String("base", "", "The submodule commit or ref to apply the patches onto. If nothing is specified, use the submodule commit in the outer repo's HEAD.")
+	strict := flag.Bool("strict", false, "Fail if any patch applies with fuzz or offset, not only if a patch conflicts.")
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	rootDir, goDir := config.FullProjectRoots()
+
+	baseCommit := *base
+	if baseCommit == "" {
+		if baseCommit, err = getTargetSubmoduleCommit(rootDir, goDir); err != nil {
+			return err
+		}
+	}
+
+	results, err := patch.Check(goDir, baseCommit, filepath.Join(rootDir, config.PatchesDir))
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[patch.ApplyStatus]int)
+	fmt.Printf("\nPatches applied onto %v:\n", baseCommit)
+	for _, r := range results {
+		counts[r.Status]++
+		fmt.Printf("%-8v %v\n", r.Status, filepath.Base(r.Path))
+		if r.Detail != "" {
+			fmt.Printf("         %v\n", strings.ReplaceAll(r.Detail, "\n", "\n         "))
+		}
+	}
+	fmt.Printf(
+		"\n%v clean, %v with fuzz or offset, %v conflicting\n",
+		counts[patch.ApplyClean], counts[patch.ApplyFuzz], counts[patch.ApplyConflict])
+
+	if counts[patch.ApplyConflict] > 0 {
+		return fmt.Errorf("%v patch(es) conflict with %v", counts[patch.ApplyConflict], baseCommit)
+	}
+	if *strict && counts[patch.ApplyFuzz] > 0 {
+		return errors.New("patches apply with fuzz or offset, and -strict is specified")
+	}
+	return nil
+}
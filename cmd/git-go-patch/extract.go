@@ -4,7 +4,6 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"io"
@@ -18,7 +17,6 @@ import (
 
 	"github.com/microsoft/go-infra/executil"
 	"github.com/microsoft/go-infra/patch"
-	"github.com/microsoft/go-infra/stringutil"
 	"github.com/microsoft/go-infra/subcmd"
 )
 
@@ -37,9 +35,9 @@ extract uses "git format-patch" internally, passing additional arguments to redu
 non-repeatable data in the resulting patch file.
 
 extract searches inside each commit description for lines that contain (only) a command.
-Each command starts with "` + commandPrefix + `", then:
+Each command starts with "` + patch.CommandPrefix + `", then:
 
-- "` + patchNumberCommand + `<x>"
+- "` + patch.PatchNumberCommand + `<x>"
   Set the number of the patch to x. Subsequent patches are numbered x+1, x+2, and so on. x must be
   >= the number this patch would be assigned without this command.
 
@@ -51,9 +49,6 @@ Each command starts with "` + commandPrefix + `", then:
 	})
 }
 
-const commandPrefix = "github.com/microsoft/go-infra/cmd/git-go-patch command: "
-const patchNumberCommand = "patch number "
-
 func handleExtract(p subcmd.ParseFunc) error {
 	sinceFlag := flag.String("since", "", "The commit or ref to begin formatting patches at. If nothing is specified, use the last commit recorded by 'apply'.")
 	verbatim := flag.Bool("verbatim", false, "Extract every patch even if rewriting it results in only spurious changes.")
@@ -159,27 +154,10 @@ func handleExtract(p subcmd.ParseFunc) error {
 			p.FromAuthor = config.ExtractAsAuthor
 		}
 
-		subjectReader := strings.NewReader(p.Subject)
-		cmds, err := readPatchCommands(subjectReader)
-		if err != nil {
-			return err
-		}
-		for _, cmd := range cmds {
-			// Git has extracted the commits and given them sequential numbers in their filenames.
-			// Here, renumber the patch files with our own rules.
-			if after, found := stringutil.CutPrefix(cmd, patchNumberCommand); found {
-				num, err := strconv.Atoi(after)
-				if err != nil {
-					return fmt.Errorf("malformed patch number command arg %q in %#q: %w", after, path, err)
-				}
-				if num >= n {
-					n = num
-				} else {
-					return fmt.Errorf("patch number command arg %v too small, expected at least %v in %#q", num, n, path)
-				}
-			} else {
-				return fmt.Errorf("command %#q is not recognized in patch %#q", cmd, path)
-			}
+		// Git has extracted the commits and given them sequential numbers in their filenames.
+		// Here, renumber the patch files with our own rules.
+		if n, err = p.Number(n); err != nil {
+			return fmt.Errorf("%v in %#q", err, path)
 		}
 
 		if n > 9999 {
@@ -272,30 +250,6 @@ func failSuggestVerbatim(description string, err error) error {
 	return fmt.Errorf("%v; use '-verbatim' or fix the underlying issue: %v", description, err)
 }
 
-// readPatchCommands reads the given patch file's header and returns all potential commands, with
-// commandPrefix trimmed off.
-func readPatchCommands(r io.Reader) ([]string, error) {
-	var cmds []string
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
-		t := scanner.Text()
-		if t == "---" {
-			// Patch is done: stop reading. Technically, "---" could occur inside the commit
-			// message, so we might be giving up early. But even "git format-patch" and "git am"
-			// don't round-trip "---" ("format-patch" doesn't escape it, "am" cuts off the message),
-			// so don't worry about it here.
-			break
-		}
-		if after, found := stringutil.CutPrefix(t, commandPrefix); found {
-			cmds = append(cmds, after)
-		}
-	}
-	return cmds, nil
-}
-
 func copyFile(dst, src string) error {
 	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
 		return err
@@ -0,0 +1,63 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/microsoft/go-infra/patch"
+	"github.com/microsoft/go-infra/subcmd"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "lint",
+		Summary: "Check the patch files for problems like trailing whitespace and inconsistent numbering.",
+		Description: `
+
+This command checks each patch file with the rules configured by "Lint" in the "` + patch.ConfigFileName + `"
+config file. If the config file doesn't configure "Lint", lint checks for trailing whitespace,
+duplicated hunks, and patch numbers that don't match what "extract" would assign.
+
+With "-fix", lint fixes the problems it can fix automatically: trailing whitespace, the author, and
+patch file numbering. Fixing trailing whitespace in a patch may make later patches fail to apply,
+so run "apply" and "extract" afterward if necessary.
+
+lint exits with a nonzero exit code if it finds any problems it didn't fix.
+` + repoRootSearchDescription,
+		Handle: handleLint,
+	})
+}
+
+func handleLint(p subcmd.ParseFunc) error {
+	fix := flag.Bool("fix", false, "Fix the problems that can be fixed automatically.")
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	issues, err := patch.Lint(config, *fix)
+	if err != nil {
+		return err
+	}
+
+	var unfixed int
+	for _, i := range issues {
+		fmt.Println(i.String())
+		if !i.Fixed {
+			unfixed++
+		}
+	}
+	fmt.Printf("\nFound %v problem(s), %v unfixed.\n", len(issues), unfixed)
+	if unfixed > 0 {
+		return fmt.Errorf("found %v unfixed problem(s) in patch files", unfixed)
+	}
+	return nil
+}
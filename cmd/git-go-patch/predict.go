@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/microsoft/go-infra/patch"
+	"github.com/microsoft/go-infra/stringutil"
+	"github.com/microsoft/go-infra/subcmd"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "predict",
+		Summary: "List the patch files that may conflict with upstream changes in a range of submodule commits.",
+		Description: `
+
+This command finds each patch hunk that overlaps lines changed by the upstream commits between the
+old and new submodule commits, including the hunk's context lines. It lists the patches with
+overlapping hunks, along with the upstream commits responsible. Both commits must exist in the
+submodule. To check a new upstream commit, fetch it into the submodule first.
+
+This is a prediction: an overlapping hunk may still apply, and a patch without any overlaps may
+still conflict, for example if it depends on a patch that conflicts. To find out for sure whether
+the patches apply, use "check".
+` + repoRootSearchDescription,
+		Handle: handlePredict,
+	})
+}
+
+func handlePredict(p subcmd.ParseFunc) error {
+	oldFlag := flag.String("old", "", "The submodule commit or ref the patches currently apply to. If nothing is specified, use the submodule commit in the outer repo's HEAD.")
+	newFlag := flag.String("new", "", "[Required] The submodule commit or ref to predict conflicts with.")
+	jsonPath := flag.String("json", "", "Write the overlapping patches to this file as JSON.")
+	markdownPath := flag.String("markdown", "", "Write the overlapping patches to this file as Markdown.")
+
+	if err := p(); err != nil {
+		return err
+	}
+	if *newFlag == "" {
+		return errors.New("no new commit specified")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	rootDir, goDir := config.FullProjectRoots()
+
+	oldCommit := *oldFlag
+	if oldCommit == "" {
+		if oldCommit, err = getTargetSubmoduleCommit(rootDir, goDir); err != nil {
+			return err
+		}
+	}
+
+	overlaps, err := patch.PredictConflicts(config, oldCommit, *newFlag)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if err := patch.WriteConflictMarkdown(&b, oldCommit, *newFlag, overlaps); err != nil {
+		return err
+	}
+	fmt.Printf("\n%v", b.String())
+
+	if *markdownPath != "" {
+		if err := os.WriteFile(*markdownPath, []byte(b.String()), 0o666); err != nil {
+			return err
+		}
+	}
+	if *jsonPath != "" {
+		if overlaps == nil {
+			// Write "[]" rather than "null" to make the file easier to consume.
+			overlaps = []patch.PatchOverlap{}
+		}
+		if err := stringutil.WriteJSONFile(*jsonPath, overlaps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
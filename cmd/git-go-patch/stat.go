@@ -0,0 +1,166 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/microsoft/go-infra/patch"
+	"github.com/microsoft/go-infra/subcmd"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "stat",
+		Summary: "Summarize the files, lines, and packages changed by each patch file.",
+		Description: `
+
+This command reads each patch file and prints the number of files it changes, the number of lines
+it inserts and deletes, and the top-level packages it changes. With "-by package", it prints the
+totals for each top-level package across all the patches instead.
+
+The top-level package of a file in the "src" dir is the first dir inside "src", like "crypto" for
+"src/crypto/tls/conn.go". For other files, it's the first dir, like "misc".
+` + repoRootSearchDescription,
+		Handle: handleStat,
+	})
+}
+
+func handleStat(p subcmd.ParseFunc) error {
+	format := flag.String("format", "table", "The output format: table, json, or csv.")
+	by := flag.String("by", "patch", "Summarize by patch, or total by package.")
+	out := flag.String("o", "", "Write the summary to this file instead of stdout.")
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	var write func(io.Writer, *patch.Stat) error
+	switch *by {
+	case "patch":
+		switch *format {
+		case "table":
+			write = writePatchStatTable
+		case "json":
+			write = func(w io.Writer, s *patch.Stat) error { return writeStatJSON(w, s.Patches) }
+		case "csv":
+			write = writePatchStatCSV
+		}
+	case "package":
+		switch *format {
+		case "table":
+			write = writePackageStatTable
+		case "json":
+			write = func(w io.Writer, s *patch.Stat) error { return writeStatJSON(w, s.Packages) }
+		case "csv":
+			write = writePackageStatCSV
+		}
+	default:
+		return fmt.Errorf("unknown -by value: %q", *by)
+	}
+	if write == nil {
+		return fmt.Errorf("unknown -format value: %q", *format)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	s, err := patch.Stats(filepath.Join(config.RootDir, config.PatchesDir))
+	if err != nil {
+		return err
+	}
+	if s.Patches == nil {
+		// Write "[]" rather than "null" to make the file easier to consume.
+		s.Patches = []patch.PatchStat{}
+	}
+	if s.Packages == nil {
+		s.Packages = []patch.PackageStat{}
+	}
+	// Only keep the file name: the patches dir is the same for every patch.
+	for i := range s.Patches {
+		s.Patches[i].Path = filepath.Base(s.Patches[i].Path)
+	}
+	if *out == "" {
+		return write(os.Stdout, s)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := write(f, s); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writePatchStatTable(w io.Writer, s *patch.Stat) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Files\tInsertions\tDeletions\t Patch\t Packages\t")
+	var files, insertions, deletions int
+	for _, ps := range s.Patches {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t %v\t %v\t\n", ps.Files, ps.Insertions, ps.Deletions, ps.Path, strings.Join(ps.Packages, " "))
+		files += ps.Files
+		insertions += ps.Insertions
+		deletions += ps.Deletions
+	}
+	fmt.Fprintf(tw, "%v\t%v\t%v\t %v patch(es)\t %v package(s)\t\n", files, insertions, deletions, len(s.Patches), len(s.Packages))
+	return tw.Flush()
+}
+
+func writePackageStatTable(w io.Writer, s *patch.Stat) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Patches\tFiles\tInsertions\tDeletions\t Package\t")
+	for _, ps := range s.Packages {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t %v\t\n", ps.Patches, ps.Files, ps.Insertions, ps.Deletions, ps.Package)
+	}
+	return tw.Flush()
+}
+
+func writePatchStatCSV(w io.Writer, s *patch.Stat) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{{"Patch", "Subject", "Files", "Insertions", "Deletions", "Packages"}}
+	for _, ps := range s.Patches {
+		records = append(records, []string{
+			ps.Path,
+			ps.Subject,
+			strconv.Itoa(ps.Files),
+			strconv.Itoa(ps.Insertions),
+			strconv.Itoa(ps.Deletions),
+			strings.Join(ps.Packages, " "),
+		})
+	}
+	return cw.WriteAll(records)
+}
+
+func writePackageStatCSV(w io.Writer, s *patch.Stat) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{{"Package", "Patches", "Files", "Insertions", "Deletions"}}
+	for _, ps := range s.Packages {
+		records = append(records, []string{
+			ps.Package,
+			strconv.Itoa(ps.Patches),
+			strconv.Itoa(ps.Files),
+			strconv.Itoa(ps.Insertions),
+			strconv.Itoa(ps.Deletions),
+		})
+	}
+	return cw.WriteAll(records)
+}
+
+func writeStatJSON(w io.Writer, v interface{}) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
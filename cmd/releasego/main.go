@@ -8,6 +8,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/microsoft/go-infra/githubutil"
 	"github.com/microsoft/go-infra/goversion"
 	"github.com/microsoft/go-infra/subcmd"
 )
@@ -20,6 +21,7 @@ releasego runs various parts of a release of microsoft/go. The subcommands imple
 var subcommands []subcmd.Option
 
 func main() {
+	githubutil.BindAPIURLFlag()
 	if err := subcmd.Run("releasego", description, subcommands); err != nil {
 		log.Fatal(err)
 	}
@@ -82,6 +82,8 @@ func handleSync(p subcmd.ParseFunc) error {
 	// Only sync the single branch we intend to.
 	foundEntry.AutoSyncBranches = []string{versionUpstream}
 	foundEntry.AutoMirrorBranches = nil
+	foundEntry.AutoMirrorTags = nil
+	foundEntry.AutoTargetTags = nil
 	if *commit != "" {
 		// Use the target commit, not just what happens to be the latest.
 		foundEntry.SourceBranchLatestCommit = map[string]string{versionUpstream: *commit}
@@ -97,6 +99,9 @@ func handleSync(p subcmd.ParseFunc) error {
 	}
 
 	results, err := sync.MakeBranchPRs(syncFlags, dir, foundEntry)
+	if reportErr := syncFlags.WriteJSONReport(sync.CompleteResults(foundEntry, results, err)); reportErr != nil {
+		return reportErr
+	}
 	if err != nil {
 		return err
 	}
@@ -124,7 +129,7 @@ func handleSync(p subcmd.ParseFunc) error {
 
 // findTarget searches through entries to find a config entry matching the given repo and with a
 // valid mapping for the given upstream branch. Returns the first found config entry, or nil if none
-// is found.
+// is found. Returns an error if the found entry doesn't pass validation.
 func findTarget(entries []sync.ConfigEntry, repo string, upstream string) (*sync.ConfigEntry, error) {
 	for i := range entries {
 		entry := &entries[i]
@@ -138,6 +143,9 @@ func findTarget(entries []sync.ConfigEntry, repo string, upstream string) (*sync
 		if target == "" {
 			continue
 		}
+		if problems := entry.Validate(fmt.Sprintf("$[%v]", i)); len(problems) > 0 {
+			return nil, &sync.ConfigProblemsError{Problems: problems}
+		}
 		return entry, nil
 	}
 	return nil, nil
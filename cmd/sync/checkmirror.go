@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/go-infra/githubutil"
+	"github.com/microsoft/go-infra/subcmd"
+	"github.com/microsoft/go-infra/sync"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "check-mirror",
+		Summary: "Check how far each UpstreamMirror is behind its Upstream.",
+		Description: `
+
+Example:
+
+  go run ./cmd/sync check-mirror -max-commits 50 -max-lag 24h
+
+For each config entry with an UpstreamMirror, compares the AutoSyncBranches and AutoMirrorBranches
+in Upstream with the same branches in UpstreamMirror, and reports how many commits the mirror is
+missing and how long it has been missing the oldest one. Also reports Upstream tags that are missing
+from the mirror or point at a different object.
+
+Exits with a nonzero code if a mirror is past a threshold, a mirror branch has diverged from
+Upstream (it can't catch up with a fast-forward), a branch is missing from the mirror, or a tag has
+changed.
+
+To run the same check before syncing, pass -upstream-mirror-max-commits or -upstream-mirror-max-lag
+to the sync command.
+`,
+		Handle: handleCheckMirror,
+	})
+}
+
+func handleCheckMirror(p subcmd.ParseFunc) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	f := sync.BindFlags(wd)
+	githubutil.BindAPIURLFlag()
+	maxCommits := flag.Int("max-commits", 0, "Fail if a mirror branch is missing more than this many Upstream commits. 0 means no limit.")
+	maxLag := flag.Duration("max-lag", 0, "Fail if a mirror branch has been missing an Upstream commit for longer than this. 0 means no limit.")
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	entries, err := f.ReadConfig()
+	if err != nil {
+		return err
+	}
+	runDir, err := f.MakeGitWorkDir()
+	if err != nil {
+		return err
+	}
+
+	t := &sync.MirrorLagThresholds{MaxCommits: *maxCommits, MaxLag: *maxLag}
+	var problems []string
+	for i := range entries {
+		entry := &entries[i]
+		if entry.UpstreamMirror == "" {
+			continue
+		}
+		fmt.Printf("---- Checking %v against %v\n", entry.UpstreamMirror, entry.Upstream)
+		r, err := sync.CheckUpstreamMirror(f, filepath.Join(runDir, fmt.Sprintf("check-mirror-%v", i)), entry, t, os.Stdout)
+		if err != nil {
+			return fmt.Errorf("failed to check %v: %w", entry.UpstreamMirror, err)
+		}
+		for _, l := range r.Branches {
+			fmt.Printf("  %v\n", l)
+		}
+		if len(r.MissingTags) > 0 {
+			fmt.Printf("  %v tag(s) missing from mirror: %v\n", len(r.MissingTags), strings.Join(r.MissingTags, ", "))
+		}
+		for _, d := range r.ChangedTags {
+			fmt.Printf("  Tag changed: %v\n", d)
+		}
+		for _, p := range r.Problems {
+			problems = append(problems, fmt.Sprintf("%v: %v", entry.UpstreamMirror, p))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %v upstream mirror problem(s):\n  %v", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/microsoft/go-infra/githubutil"
+	"github.com/microsoft/go-infra/subcmd"
+	"github.com/microsoft/go-infra/sync"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "cleanup",
+		Summary: "Close stale sync PRs and delete their branches.",
+		Description: `
+
+Example:
+
+  go run ./cmd/sync cleanup -n
+
+Finds open PRs created by the submitter user in each config entry's Target repository with a
+'dev/auto-sync/...' or 'dev/auto-sync-conflict/...' head branch that doesn't match any config
+entry's AutoSyncBranches. For example, a PR for a release branch that has been removed from the
+config after going out of support. Closes each stale PR with a comment, then deletes its head
+branch. A PR into a branch that a config entry's BranchMap still maps to isn't stale, because
+"releasego sync" submits PRs for those branches.
+
+Only the Target repositories in the config are checked. With -n, only lists the stale PRs.
+
+The sync command's auth and config flags also apply.
+`,
+		Handle: handleCleanup,
+	})
+}
+
+func handleCleanup(p subcmd.ParseFunc) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	f := sync.BindFlags(wd)
+	githubutil.BindAPIURLFlag()
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	entries, err := f.ReadConfig()
+	if err != nil {
+		return err
+	}
+	runDir, err := f.MakeGitWorkDir()
+	if err != nil {
+		return err
+	}
+
+	stale, err := sync.CleanupStalePRs(f, filepath.Join(runDir, "cleanup"), entries, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if *f.DryRun {
+		fmt.Printf("\nFound %v stale PR(s). Dry run: nothing was closed.\n", len(stale))
+		return nil
+	}
+	fmt.Printf("\nClosed %v stale PR(s).\n", len(stale))
+	return nil
+}
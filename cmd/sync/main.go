@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/microsoft/go-infra/buildmodel"
+	"github.com/microsoft/go-infra/githubutil"
+	"github.com/microsoft/go-infra/subcmd"
 	"github.com/microsoft/go-infra/sync"
 )
 
@@ -33,16 +36,34 @@ This script creates the temporary repository in 'eng/artifacts/' by default.
 
 To run a subset of the syncs specified in the config file, or to swap out URLs for development
 purposes, create a copy of the configuration file and point at it using a '-c' argument.
+
+Sync also has subcommands for related tasks. Run 'go run ./cmd/sync {subcommand} -h' for details:
 `
 
+// subcommands is the list of subcommand options, populated by each file's init function. If the
+// first arg isn't the name of a subcommand, the sync command runs.
+var subcommands []subcmd.Option
+
 func main() {
+	if len(os.Args) > 1 {
+		for _, c := range subcommands {
+			if c.Name == os.Args[1] {
+				if err := subcmd.Run("sync", description, subcommands); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
+	}
+
 	wd, err := os.Getwd()
 	if err != nil {
 		log.Panic(err)
 	}
 	f := sync.BindFlags(wd)
+	githubutil.BindAPIURLFlag()
 
-	buildmodel.ParseBoundFlags(description)
+	buildmodel.ParseBoundFlags(description + subcommandSummaries())
 
 	if err := sync.MakePRs(f); err != nil {
 		panic(err)
@@ -50,3 +71,11 @@ func main() {
 
 	fmt.Println("\nSuccess.")
 }
+
+func subcommandSummaries() string {
+	var b strings.Builder
+	for _, c := range subcommands {
+		fmt.Fprintf(&b, "\n  %v\n    %v\n", c.Name, c.Summary)
+	}
+	return b.String()
+}
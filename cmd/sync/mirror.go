@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/go-infra/githubutil"
+	"github.com/microsoft/go-infra/subcmd"
+	"github.com/microsoft/go-infra/sync"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "mirror",
+		Summary: "Mirror branches and tags from Upstream to MirrorTarget, without syncing.",
+		Description: `
+
+Example:
+
+  go run ./cmd/sync mirror -n -include 'heads/release-branch.go*' -include 'tags/go1.*'
+
+For each config entry with a MirrorTarget, pushes the Upstream refs that match the include globs
+and don't match the exclude globs to MirrorTarget. Globs match ref names without 'refs/', like
+'heads/master' or 'tags/go1.21.0'. If no include globs are specified, each entry's
+AutoSyncBranches, AutoMirrorBranches, and AutoMirrorTags are mirrored.
+
+With -prune, selected refs that no longer exist in Upstream are deleted from MirrorTarget.
+
+After mirroring, checks that each selected ref is the same in Upstream and MirrorTarget, and reports
+any drift. Exits with a nonzero code if any drift is found.
+
+The sync command's auth, config, dry run, and bundle flags also apply.
+`,
+		Handle: handleMirror,
+	})
+}
+
+func handleMirror(p subcmd.ParseFunc) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	f := sync.BindFlags(wd)
+	githubutil.BindAPIURLFlag()
+	var include, exclude subcmd.MultiStringFlag
+	flag.Var(&include, "include", "A glob of ref names to mirror, like 'heads/release-branch.go*'. May be specified multiple times.")
+	flag.Var(&exclude, "exclude", "A glob of ref names not to mirror, even if included. May be specified multiple times.")
+	prune := flag.Bool("prune", false, "Delete selected refs from MirrorTarget that don't exist in Upstream.")
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	entries, err := f.ReadConfig()
+	if err != nil {
+		return err
+	}
+	runDir, err := f.MakeGitWorkDir()
+	if err != nil {
+		return err
+	}
+
+	opts := &sync.MirrorOptions{
+		Include: include.Values,
+		Exclude: exclude.Values,
+		Prune:   *prune,
+	}
+	var drift, failures []string
+	for i := range entries {
+		entry := &entries[i]
+		if entry.MirrorTarget == "" {
+			continue
+		}
+		fmt.Printf("---- Mirroring %v to %v\n", entry.Upstream, entry.MirrorTarget)
+		r, err := sync.MirrorEntry(f, filepath.Join(runDir, fmt.Sprintf("mirror-%v", i)), entry, opts, os.Stdout)
+		if err != nil {
+			// Continue with the next entry, like sync.
+			failure := fmt.Sprintf("failed to mirror %v to %v: %v", entry.Upstream, entry.MirrorTarget, err)
+			fmt.Printf("---- %v\n", failure)
+			failures = append(failures, failure)
+			continue
+		}
+		fmt.Printf("---- Pushed %v ref(s), pruned %v ref(s).\n", len(r.Pushed), len(r.Pruned))
+		for _, d := range r.Drift {
+			drift = append(drift, fmt.Sprintf("%v: %v", entry.MirrorTarget, d))
+		}
+	}
+	var errs []string
+	if len(failures) > 0 {
+		errs = append(errs, fmt.Sprintf("failed to mirror %v entries:\n  %v", len(failures), strings.Join(failures, "\n  ")))
+	}
+	if len(drift) > 0 {
+		errs = append(errs, fmt.Sprintf("found %v ref(s) that don't match upstream after mirroring:\n  %v", len(drift), strings.Join(drift, "\n  ")))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
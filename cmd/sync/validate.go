@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/microsoft/go-infra/subcmd"
+	"github.com/microsoft/go-infra/sync"
+)
+
+func init() {
+	subcommands = append(subcommands, subcmd.Option{
+		Name:    "validate",
+		Summary: "Check a sync config file for problems without running sync.",
+		Description: `
+
+Example:
+
+  go run ./cmd/sync validate -c eng/sync-config.json
+
+Checks each entry in the config file offline and reports every problem found, with the JSON path
+of the value that has the problem. Exits with a nonzero code if there are any problems.
+
+The JSON Schema of the file format is published at docs/automation/sync-config.schema.json.
+`,
+		Handle: handleValidate,
+	})
+}
+
+func handleValidate(p subcmd.ParseFunc) error {
+	config := flag.String("c", "eng/sync-config.json", "The sync configuration file to validate.")
+
+	if err := p(); err != nil {
+		return err
+	}
+
+	problems, err := sync.ValidateConfigFile(*config)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return &sync.ConfigProblemsError{Problems: problems}
+	}
+	fmt.Printf("No problems found in %v.\n", *config)
+	return nil
+}
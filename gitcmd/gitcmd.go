@@ -42,6 +42,9 @@ func (GitHubSSHAuther) InsertAuth(url string) string {
 // GitHubPATAuther adds a username and password into the https-style GitHub URL.
 type GitHubPATAuther struct {
 	User, PAT string
+	// WebURL is the base URL of another GitHub web host, like "https://ghe.example.com", whose URLs
+	// are also authenticated. This supports GitHub Enterprise Server. Optional.
+	WebURL string
 }
 
 func (a GitHubPATAuther) InsertAuth(url string) string {
@@ -51,6 +54,11 @@ func (a GitHubPATAuther) InsertAuth(url string) string {
 	if after, found := stringutil.CutPrefix(url, githubPrefix); found {
 		return fmt.Sprintf("https://%v:%v@github.com/%v", a.User, a.PAT, after)
 	}
+	if host, found := stringutil.CutPrefix(a.WebURL, "https://"); found {
+		if after, found := stringutil.CutPrefix(url, a.WebURL+"/"); found {
+			return fmt.Sprintf("https://%v:%v@%v/%v", a.User, a.PAT, host, after)
+		}
+	}
 	return url
 }
 
@@ -9,6 +9,8 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -16,14 +18,113 @@ import (
 	"golang.org/x/oauth2"
 )
 
-// NewClient creates a GitHub client using the given personal access token.
+// DefaultAPIURL is the base URL of the public GitHub REST API.
+const DefaultAPIURL = "https://api.github.com"
+
+// APIURLEnv is the environment variable that specifies the GitHub REST API base URL if the
+// "github-api-url" flag isn't passed. GitHub Actions sets this variable to the API of the GitHub
+// instance running the workflow.
+const APIURLEnv = "GITHUB_API_URL"
+
+// apiURL is the API URL set by SetAPIURL, or empty string.
+var apiURL string
+
+// APIURL returns the base URL of the GitHub REST API that all GitHub calls in this module should
+// use, without a trailing slash. This is the value set by SetAPIURL (e.g. through the flag bound by
+// BindAPIURLFlag), otherwise the value of the APIURLEnv environment variable, otherwise
+// DefaultAPIURL.
+//
+// For GitHub Enterprise Server, the API URL is "https://{host}/api/v3". It can also be the URL of
+// a local stand-in for the GitHub API, used for testing.
+func APIURL() string {
+	if apiURL != "" {
+		return apiURL
+	}
+	if u := os.Getenv(APIURLEnv); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return DefaultAPIURL
+}
+
+// SetAPIURL sets the GitHub REST API base URL returned by APIURL. Returns an error if u isn't an
+// absolute http(s) URL.
+func SetAPIURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("unable to parse GitHub API URL %q: %w", u, err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+		return fmt.Errorf("GitHub API URL %q is not an absolute http(s) URL", u)
+	}
+	apiURL = strings.TrimSuffix(u, "/")
+	return nil
+}
+
+// BindAPIURLFlag binds a flag that configures the GitHub REST API base URL by calling SetAPIURL.
+// Bind it once per command, before any GitHub call is made.
+func BindAPIURLFlag() {
+	flag.Func(
+		"github-api-url",
+		"The base URL of the GitHub REST API. Use 'https://{host}/api/v3' for GitHub Enterprise Server.\n"+
+			"If not specified, uses the "+APIURLEnv+" environment variable, or "+DefaultAPIURL+".",
+		SetAPIURL)
+}
+
+// GraphQLURL returns the URL of the GitHub GraphQL API that corresponds to the given REST API base
+// URL. GitHub Enterprise Server serves GraphQL at "/api/graphql" rather than "/api/v3/graphql".
+func GraphQLURL(apiURL string) string {
+	if host, ok := cutEnterpriseAPIPath(apiURL); ok {
+		return host + "/api/graphql"
+	}
+	return apiURL + "/graphql"
+}
+
+// WebURL returns the base URL of the GitHub web UI and Git HTTP endpoints that corresponds to the
+// given REST API base URL, without a trailing slash. For example, "https://api.github.com" returns
+// "https://github.com". An unrecognized API URL is returned as-is: this is the case for a local
+// stand-in that serves every endpoint at the same base URL.
+func WebURL(apiURL string) string {
+	if apiURL == DefaultAPIURL {
+		return "https://github.com"
+	}
+	if host, ok := cutEnterpriseAPIPath(apiURL); ok {
+		return host
+	}
+	return apiURL
+}
+
+// cutEnterpriseAPIPath removes the GitHub Enterprise Server REST API path from apiURL, if present.
+func cutEnterpriseAPIPath(apiURL string) (string, bool) {
+	if strings.HasSuffix(apiURL, "/api/v3") {
+		return strings.TrimSuffix(apiURL, "/api/v3"), true
+	}
+	return apiURL, false
+}
+
+// NewClient creates a GitHub client using the given personal access token. The client uses the
+// API URL returned by APIURL.
 func NewClient(ctx context.Context, pat string) (*github.Client, error) {
 	if pat == "" {
 		return nil, errors.New("no GitHub PAT specified")
 	}
 	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: pat})
 	tokenClient := oauth2.NewClient(ctx, tokenSource)
-	return github.NewClient(tokenClient), nil
+	client := github.NewClient(tokenClient)
+	if u := APIURL(); u != DefaultAPIURL {
+		baseURL, err := url.Parse(u + "/")
+		if err != nil {
+			return nil, err
+		}
+		uploadURL := baseURL
+		if host, ok := cutEnterpriseAPIPath(u); ok {
+			if uploadURL, err = url.Parse(host + "/api/uploads/"); err != nil {
+				return nil, err
+			}
+		}
+		client.BaseURL = baseURL
+		client.UploadURL = uploadURL
+	}
+	return client, nil
 }
 
 // BindPATFlag returns a flag to specify the personal access token.
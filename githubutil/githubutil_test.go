@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package githubutil
+
+import "testing"
+
+func TestAPIURLMapping(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiURL     string
+		wantGraph  string
+		wantWebURL string
+	}{
+		{"public", DefaultAPIURL, "https://api.github.com/graphql", "https://github.com"},
+		{"enterprise", "https://ghes.example.org/api/v3", "https://ghes.example.org/api/graphql", "https://ghes.example.org"},
+		{"stand-in", "http://127.0.0.1:8080", "http://127.0.0.1:8080/graphql", "http://127.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GraphQLURL(tt.apiURL); got != tt.wantGraph {
+				t.Errorf("GraphQLURL() = %v, want %v", got, tt.wantGraph)
+			}
+			if got := WebURL(tt.apiURL); got != tt.wantWebURL {
+				t.Errorf("WebURL() = %v, want %v", got, tt.wantWebURL)
+			}
+		})
+	}
+}
+
+func TestSetAPIURL(t *testing.T) {
+	t.Cleanup(func() { apiURL = "" })
+
+	if err := SetAPIURL("ghes.example.org/api/v3"); err == nil {
+		t.Errorf("expected error for URL without scheme")
+	}
+	if err := SetAPIURL("https://ghes.example.org/api/v3/"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := APIURL(), "https://ghes.example.org/api/v3"; got != want {
+		t.Errorf("APIURL() = %v, want %v", got, want)
+	}
+}
+
+func TestAPIURLEnv(t *testing.T) {
+	t.Setenv(APIURLEnv, "https://ghes.example.org/api/v3/")
+	if got, want := APIURL(), "https://ghes.example.org/api/v3"; got != want {
+		t.Errorf("APIURL() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package gitpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/azure-devops-go-api/azuredevops"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/git"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/identity"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/location"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/webapi"
+)
+
+// azdoVoteApproved is the AzDO reviewer vote value that means "approved".
+const azdoVoteApproved = 10
+
+// AzDORepo is a parsed Azure DevOps Git repository URL.
+type AzDORepo struct {
+	// OrgURL is the base URL of the organization, such as 'https://dev.azure.com/dnceng'.
+	OrgURL string
+	// Project is the project containing the repository, such as 'internal'.
+	Project string
+	// Repo is the name of the repository.
+	Repo string
+}
+
+// ParseAzDORepoURL parses an Azure DevOps Git URL in one of these forms, with or without a
+// username:
+//
+//	https://dev.azure.com/{org}/{project}/_git/{repo}
+//	https://{org}.visualstudio.com/{project}/_git/{repo}
+func ParseAzDORepoURL(repoURL string) (*AzDORepo, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	r := &AzDORepo{}
+	switch {
+	case u.Host == "dev.azure.com" && len(parts) == 4 && parts[2] == "_git":
+		r.OrgURL = "https://dev.azure.com/" + parts[0]
+		parts = parts[1:]
+	case strings.HasSuffix(u.Host, ".visualstudio.com") && len(parts) == 3 && parts[1] == "_git":
+		r.OrgURL = "https://" + u.Host
+	default:
+		return nil, fmt.Errorf("failed to parse AzDO repository URL %q: expected https://dev.azure.com/{org}/{project}/_git/{repo}", repoURL)
+	}
+	r.Project = parts[0]
+	r.Repo = parts[2]
+	return r, nil
+}
+
+// PRWebURL returns the web URL of the given PR ID in the repository.
+func (r *AzDORepo) PRWebURL(id int) string {
+	return r.OrgURL + "/" + r.Project + "/_git/" + r.Repo + "/pullrequest/" + strconv.Itoa(id)
+}
+
+// AzDOForge submits PRs to an Azure DevOps repository using the AzDO REST API.
+type AzDOForge struct {
+	Repo *AzDORepo
+
+	PAT         string
+	ReviewerPAT string
+}
+
+func (a *AzDOForge) CreatePR(ctx context.Context, r *PRRequest) (*PR, error) {
+	client, err := a.newClient(ctx, a.PAT)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := client.CreatePullRequest(ctx, git.CreatePullRequestArgs{
+		GitPullRequestToCreate: &git.GitPullRequest{
+			SourceRefName: azdoBranchRef(r.HeadBranch),
+			TargetRefName: azdoBranchRef(r.BaseBranch),
+			Title:         &r.Title,
+			Description:   &r.Body,
+			IsDraft:       &r.Draft,
+		},
+		RepositoryId: &a.Repo.Repo,
+		Project:      &a.Repo.Project,
+	})
+	if err != nil {
+		var wrapped azuredevops.WrappedError
+		if errors.As(err, &wrapped) && wrapped.TypeKey != nil && *wrapped.TypeKey == "GitPullRequestExistsException" {
+			return nil, fmt.Errorf("%w: %v", ErrPRAlreadyExists, err)
+		}
+		return nil, err
+	}
+	return a.pr(pr), nil
+}
+
+func (a *AzDOForge) FindExistingPR(ctx context.Context, r *PRRequest) (*PR, error) {
+	client, err := a.newClient(ctx, a.PAT)
+	if err != nil {
+		return nil, err
+	}
+	creator, err := azdoAuthenticatedUser(ctx, a.Repo.OrgURL, a.PAT)
+	if err != nil {
+		return nil, err
+	}
+	prs, err := client.GetPullRequests(ctx, git.GetPullRequestsArgs{
+		RepositoryId: &a.Repo.Repo,
+		Project:      &a.Repo.Project,
+		SearchCriteria: &git.GitPullRequestSearchCriteria{
+			CreatorId:     creator.Id,
+			SourceRefName: azdoBranchRef(r.HeadBranch),
+			TargetRefName: azdoBranchRef(r.BaseBranch),
+			Status:        &git.PullRequestStatusValues.Active,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(*prs) > 1 {
+		return nil, fmt.Errorf("expected 0/1 PR search result, found %v", len(*prs))
+	}
+	if len(*prs) == 0 {
+		return nil, nil
+	}
+	return a.pr(&(*prs)[0]), nil
+}
+
+func (a *AzDOForge) ApprovePR(ctx context.Context, pr *PR) error {
+	client, err := a.newClient(ctx, a.ReviewerPAT)
+	if err != nil {
+		return err
+	}
+	reviewer, err := azdoAuthenticatedUser(ctx, a.Repo.OrgURL, a.ReviewerPAT)
+	if err != nil {
+		return err
+	}
+	reviewerID := reviewer.Id.String()
+	vote := azdoVoteApproved
+	_, err = client.CreatePullRequestReviewer(ctx, git.CreatePullRequestReviewerArgs{
+		Reviewer:      &git.IdentityRefWithVote{Vote: &vote},
+		RepositoryId:  &a.Repo.Repo,
+		PullRequestId: &pr.Number,
+		ReviewerId:    &reviewerID,
+		Project:       &a.Repo.Project,
+	})
+	return err
+}
+
+func (a *AzDOForge) EnablePRAutoMerge(ctx context.Context, pr *PR) error {
+	client, err := a.newClient(ctx, a.ReviewerPAT)
+	if err != nil {
+		return err
+	}
+	reviewer, err := azdoAuthenticatedUser(ctx, a.Repo.OrgURL, a.ReviewerPAT)
+	if err != nil {
+		return err
+	}
+	reviewerID := reviewer.Id.String()
+	_, err = client.UpdatePullRequest(ctx, git.UpdatePullRequestArgs{
+		GitPullRequestToUpdate: &git.GitPullRequest{
+			AutoCompleteSetBy: &webapi.IdentityRef{Id: &reviewerID},
+			CompletionOptions: &git.GitPullRequestCompletionOptions{
+				MergeStrategy: &git.GitPullRequestMergeStrategyValues.NoFastForward,
+			},
+		},
+		RepositoryId:  &a.Repo.Repo,
+		PullRequestId: &pr.Number,
+		Project:       &a.Repo.Project,
+	})
+	return err
+}
+
+func (a *AzDOForge) CommentPR(ctx context.Context, pr *PR, body string) error {
+	client, err := a.newClient(ctx, a.PAT)
+	if err != nil {
+		return err
+	}
+	_, err = client.CreateThread(ctx, git.CreateThreadArgs{
+		CommentThread: &git.GitPullRequestCommentThread{
+			Comments: &[]git.Comment{
+				{
+					Content:     &body,
+					CommentType: &git.CommentTypeValues.Text,
+				},
+			},
+			Status: &git.CommentThreadStatusValues.Closed,
+		},
+		RepositoryId:  &a.Repo.Repo,
+		PullRequestId: &pr.Number,
+		Project:       &a.Repo.Project,
+	})
+	return err
+}
+
+func (a *AzDOForge) ListOpenPRs(ctx context.Context, headBranchPrefix string) ([]*OpenPR, error) {
+	client, err := a.newClient(ctx, a.PAT)
+	if err != nil {
+		return nil, err
+	}
+	creator, err := azdoAuthenticatedUser(ctx, a.Repo.OrgURL, a.PAT)
+	if err != nil {
+		return nil, err
+	}
+	var found []*OpenPR
+	for skip := 0; ; {
+		prs, err := client.GetPullRequests(ctx, git.GetPullRequestsArgs{
+			RepositoryId: &a.Repo.Repo,
+			Project:      &a.Repo.Project,
+			SearchCriteria: &git.GitPullRequestSearchCriteria{
+				CreatorId: creator.Id,
+				Status:    &git.PullRequestStatusValues.Active,
+			},
+			Skip: &skip,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(*prs) == 0 {
+			return found, nil
+		}
+		skip += len(*prs)
+		for i := range *prs {
+			pr := &(*prs)[i]
+			if pr.ForkSource != nil {
+				// The head branch is in a fork, not the repository that stores our PR branches.
+				continue
+			}
+			head := strings.TrimPrefix(*pr.SourceRefName, "refs/heads/")
+			if !strings.HasPrefix(head, headBranchPrefix) {
+				continue
+			}
+			found = append(found, &OpenPR{
+				PR:         *a.pr(pr),
+				HeadBranch: head,
+				BaseBranch: strings.TrimPrefix(*pr.TargetRefName, "refs/heads/"),
+				Title:      *pr.Title,
+			})
+		}
+	}
+}
+
+func (a *AzDOForge) ClosePR(ctx context.Context, pr *PR) error {
+	client, err := a.newClient(ctx, a.PAT)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdatePullRequest(ctx, git.UpdatePullRequestArgs{
+		GitPullRequestToUpdate: &git.GitPullRequest{
+			Status: &git.PullRequestStatusValues.Abandoned,
+		},
+		RepositoryId:  &a.Repo.Repo,
+		PullRequestId: &pr.Number,
+		Project:       &a.Repo.Project,
+	})
+	return err
+}
+
+func (a *AzDOForge) Gitlink(ctx context.Context, commit, path string) (string, error) {
+	client, err := a.newClient(ctx, a.PAT)
+	if err != nil {
+		return "", err
+	}
+	item, err := client.GetItem(ctx, git.GetItemArgs{
+		RepositoryId: &a.Repo.Repo,
+		Project:      &a.Repo.Project,
+		Path:         &path,
+		VersionDescriptor: &git.GitVersionDescriptor{
+			Version:     &commit,
+			VersionType: &git.GitVersionTypeValues.Commit,
+		},
+	})
+	if err != nil {
+		if azdoNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if item.GitObjectType == nil || *item.GitObjectType != git.GitObjectTypeValues.Commit || item.ObjectId == nil {
+		return "", nil
+	}
+	return *item.ObjectId, nil
+}
+
+func (a *AzDOForge) newClient(ctx context.Context, pat string) (git.Client, error) {
+	if pat == "" {
+		return nil, errors.New("no AzDO PAT specified")
+	}
+	return git.NewClient(ctx, azuredevops.NewPatConnection(a.Repo.OrgURL, pat))
+}
+
+func (a *AzDOForge) pr(pr *git.GitPullRequest) *PR {
+	return &PR{
+		Number: *pr.PullRequestId,
+		URL:    a.Repo.PRWebURL(*pr.PullRequestId),
+	}
+}
+
+// azdoAuthenticatedUser finds the identity associated with a PAT.
+func azdoAuthenticatedUser(ctx context.Context, orgURL, pat string) (*identity.Identity, error) {
+	c := location.NewClient(ctx, azuredevops.NewPatConnection(orgURL, pat))
+	data, err := c.GetConnectionData(ctx, location.GetConnectionDataArgs{})
+	if err != nil {
+		return nil, err
+	}
+	if data.AuthenticatedUser == nil || data.AuthenticatedUser.Id == nil {
+		return nil, errors.New("AzDO connection data doesn't include an authenticated user ID")
+	}
+	return data.AuthenticatedUser, nil
+}
+
+// azdoNotFound returns true if err is an AzDO API "not found" response. The AzDO client returns
+// WrappedError both by value and by pointer.
+func azdoNotFound(err error) bool {
+	var wrapped azuredevops.WrappedError
+	var wrappedPtr *azuredevops.WrappedError
+	switch {
+	case errors.As(err, &wrapped):
+	case errors.As(err, &wrappedPtr):
+		wrapped = *wrappedPtr
+	default:
+		return false
+	}
+	return wrapped.StatusCode != nil && *wrapped.StatusCode == http.StatusNotFound
+}
+
+func azdoBranchRef(branch string) *string {
+	ref := "refs/heads/" + branch
+	return &ref
+}
@@ -0,0 +1,136 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package gitpr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FakeForge is an in-memory Forge for tests. It keeps track of the PRs created through it and the
+// operations performed on them so a test can inspect the result. It is safe for concurrent use.
+type FakeForge struct {
+	mu  sync.Mutex
+	prs []*FakePR
+
+	// Gitlinks maps "{commit}:{path}" to the commit of the submodule at path in the target repo's
+	// commit, for Gitlink to return. Set it before using the forge.
+	Gitlinks map[string]string
+}
+
+// FakePR is the state of a PR created in a FakeForge.
+type FakePR struct {
+	PR
+	Request PRRequest
+
+	Approved  bool
+	AutoMerge bool
+	Closed    bool
+	Comments  []string
+}
+
+// PRs returns a snapshot of the PRs that have been created, in creation order.
+func (f *FakeForge) PRs() []FakePR {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prs := make([]FakePR, 0, len(f.prs))
+	for _, pr := range f.prs {
+		c := *pr
+		c.Comments = append([]string(nil), pr.Comments...)
+		prs = append(prs, c)
+	}
+	return prs
+}
+
+func (f *FakeForge) CreatePR(ctx context.Context, r *PRRequest) (*PR, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.find(r) != nil {
+		return nil, fmt.Errorf("%w: %v -> %v", ErrPRAlreadyExists, r.HeadBranch, r.BaseBranch)
+	}
+	n := len(f.prs) + 1
+	pr := &FakePR{
+		PR: PR{
+			Number: n,
+			URL:    fmt.Sprintf("https://fake.example.org/pull/%v", n),
+			NodeID: fmt.Sprintf("fake-pr-%v", n),
+		},
+		Request: *r,
+	}
+	f.prs = append(f.prs, pr)
+	p := pr.PR
+	return &p, nil
+}
+
+func (f *FakeForge) FindExistingPR(ctx context.Context, r *PRRequest) (*PR, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if pr := f.find(r); pr != nil {
+		p := pr.PR
+		return &p, nil
+	}
+	return nil, nil
+}
+
+func (f *FakeForge) ApprovePR(ctx context.Context, pr *PR) error {
+	return f.update(pr, func(p *FakePR) { p.Approved = true })
+}
+
+func (f *FakeForge) EnablePRAutoMerge(ctx context.Context, pr *PR) error {
+	return f.update(pr, func(p *FakePR) { p.AutoMerge = true })
+}
+
+func (f *FakeForge) CommentPR(ctx context.Context, pr *PR, body string) error {
+	return f.update(pr, func(p *FakePR) { p.Comments = append(p.Comments, body) })
+}
+
+func (f *FakeForge) ListOpenPRs(ctx context.Context, headBranchPrefix string) ([]*OpenPR, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []*OpenPR
+	for _, pr := range f.prs {
+		if !pr.Closed && strings.HasPrefix(pr.Request.HeadBranch, headBranchPrefix) {
+			found = append(found, &OpenPR{
+				PR:         pr.PR,
+				HeadBranch: pr.Request.HeadBranch,
+				BaseBranch: pr.Request.BaseBranch,
+				Title:      pr.Request.Title,
+			})
+		}
+	}
+	return found, nil
+}
+
+func (f *FakeForge) ClosePR(ctx context.Context, pr *PR) error {
+	return f.update(pr, func(p *FakePR) { p.Closed = true })
+}
+
+func (f *FakeForge) Gitlink(ctx context.Context, commit, path string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Gitlinks[commit+":"+path], nil
+}
+
+func (f *FakeForge) find(r *PRRequest) *FakePR {
+	for _, pr := range f.prs {
+		if !pr.Closed && pr.Request.HeadBranch == r.HeadBranch && pr.Request.BaseBranch == r.BaseBranch {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (f *FakeForge) update(pr *PR, fn func(p *FakePR)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.prs {
+		if p.Number == pr.Number {
+			fn(p)
+			return nil
+		}
+	}
+	return fmt.Errorf("PR %v not found", pr.Number)
+}
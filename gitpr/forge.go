@@ -0,0 +1,306 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package gitpr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/microsoft/go-infra/githubutil"
+)
+
+// ErrPRAlreadyExists is returned (possibly wrapped) by Forge.CreatePR when an open PR already
+// exists for the same head and base branches. For our purposes, this is not a fatal error: the
+// caller can use Forge.FindExistingPR to find the PR and reuse it.
+var ErrPRAlreadyExists = errors.New("PR already exists")
+
+// Forge is a Git hosting service that hosts a Target repository and accepts PRs into it. Each
+// implementation is bound to one target repository, one head repository, and a set of credentials.
+type Forge interface {
+	// CreatePR submits a new PR. If an open PR already exists for the same head and base branches,
+	// returns an error that matches ErrPRAlreadyExists.
+	CreatePR(ctx context.Context, r *PRRequest) (*PR, error)
+	// FindExistingPR finds the open PR created by the submitter for the head and base branches in
+	// r. Returns nil if no match is found, and an error if more than one match is found.
+	FindExistingPR(ctx context.Context, r *PRRequest) (*PR, error)
+	// ApprovePR adds an approving review to the PR, as the reviewer.
+	ApprovePR(ctx context.Context, pr *PR) error
+	// EnablePRAutoMerge sets up the PR to merge automatically (using a merge commit) once all
+	// requirements are satisfied, as the reviewer.
+	EnablePRAutoMerge(ctx context.Context, pr *PR) error
+	// CommentPR posts a comment on the PR, as the submitter.
+	CommentPR(ctx context.Context, pr *PR, body string) error
+	// ListOpenPRs finds the open PRs created by the submitter from the head repository into the
+	// target repository with a head branch name that starts with headBranchPrefix.
+	ListOpenPRs(ctx context.Context, headBranchPrefix string) ([]*OpenPR, error)
+	// ClosePR closes the PR without merging it, as the submitter.
+	ClosePR(ctx context.Context, pr *PR) error
+	// Gitlink returns the commit that the submodule at path points to in the given commit of the
+	// target repository. Returns empty string if there is no submodule at path in that commit.
+	Gitlink(ctx context.Context, commit, path string) (string, error)
+}
+
+// PRRequest is the forge-independent data needed to create a PR.
+type PRRequest struct {
+	// HeadBranch is the name of the branch containing the changes, without "refs/heads/".
+	HeadBranch string
+	// BaseBranch is the name of the branch to merge the changes into, without "refs/heads/".
+	BaseBranch string
+
+	Title string
+	Body  string
+	Draft bool
+}
+
+// CreatePRRequest creates the data model that can be sent to a Forge to create a PR for this
+// branch.
+func (b PRRefSet) CreatePRRequest(title, body string) *PRRequest {
+	return &PRRequest{
+		HeadBranch: b.PRBranch(),
+		BaseBranch: b.Name,
+		Title:      title,
+		Body:       body,
+	}
+}
+
+// PR is a PR that exists on a forge.
+type PR struct {
+	// Number is the number of the PR that is displayed to users. On GitHub, this is the PR number,
+	// and on AzDO it's the pull request ID.
+	Number int
+	// URL is the web (not API) URL of the PR.
+	URL string
+	// NodeID is the forge-specific identity of the PR used by API calls, if it isn't simply the
+	// Number. On GitHub, this is the GraphQL node ID.
+	NodeID string
+}
+
+// OpenPR is an open PR found by Forge.ListOpenPRs.
+type OpenPR struct {
+	PR
+	// HeadBranch and BaseBranch are the names of the PR's branches, without "refs/heads/".
+	HeadBranch string
+	BaseBranch string
+	Title      string
+}
+
+// ForgeKind is a type of forge. Each kind has its own URL format and API.
+type ForgeKind string
+
+// Forge kinds supported by NewForge.
+const (
+	ForgeGitHub ForgeKind = "github"
+	ForgeAzDO   ForgeKind = "azdo"
+)
+
+// ForgeAuth contains the credentials used to access forges. Only the credentials for the kind of
+// forge being used need to be specified.
+type ForgeAuth struct {
+	// GitHubUser is the user that submits GitHub PRs. It is used to search for existing PRs.
+	GitHubUser string
+	// GitHubPAT submits GitHub PRs, and must belong to GitHubUser.
+	GitHubPAT string
+	// GitHubPATReviewer approves GitHub PRs and enables auto-merge.
+	GitHubPATReviewer string
+
+	// AzDOPAT submits AzDO PRs.
+	AzDOPAT string
+	// AzDOPATReviewer approves AzDO PRs and sets them to auto-complete.
+	AzDOPATReviewer string
+}
+
+// DetectForgeKind determines what kind of forge hosts the repository at the given URL. A URL on
+// the host of the configured GitHub API (see githubutil.APIURL) is also detected as GitHub, to
+// support GitHub Enterprise Server.
+func DetectForgeKind(repoURL string) (ForgeKind, error) {
+	if strings.HasPrefix(repoURL, "git@github.com:") {
+		return ForgeGitHub, nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse repository URL %q: %w", repoURL, err)
+	}
+	var gitHubHost string
+	if web, err := url.Parse(githubutil.WebURL(githubutil.APIURL())); err == nil {
+		gitHubHost = web.Host
+	}
+	switch {
+	case u.Host == "github.com", u.Host == gitHubHost:
+		return ForgeGitHub, nil
+	case u.Host == "dev.azure.com", strings.HasSuffix(u.Host, ".visualstudio.com"):
+		return ForgeAzDO, nil
+	}
+	return "", fmt.Errorf("unable to determine forge for repository URL %q: expected a github.com or Azure DevOps URL", repoURL)
+}
+
+// NewForge creates a Forge that submits PRs into target from branches stored in head, based on
+// the URL of target. The forge writes its logs to out.
+func NewForge(out io.Writer, target, head string, auth *ForgeAuth) (Forge, error) {
+	kind, err := DetectForgeKind(target)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case ForgeGitHub:
+		targetRemote, err := parseRemoteURL(out, target)
+		if err != nil {
+			return nil, err
+		}
+		headRemote, err := parseRemoteURL(out, head)
+		if err != nil {
+			return nil, err
+		}
+		return &GitHubForge{
+			Target:      targetRemote,
+			Head:        headRemote,
+			Out:         out,
+			User:        auth.GitHubUser,
+			PAT:         auth.GitHubPAT,
+			ReviewerPAT: auth.GitHubPATReviewer,
+		}, nil
+
+	case ForgeAzDO:
+		repo, err := ParseAzDORepoURL(target)
+		if err != nil {
+			return nil, err
+		}
+		if head != target {
+			headRepo, err := ParseAzDORepoURL(head)
+			if err != nil {
+				return nil, err
+			}
+			if *headRepo != *repo {
+				return nil, fmt.Errorf("AzDO PRs from a separate head repository are not supported: %v", head)
+			}
+		}
+		return &AzDOForge{
+			Repo:        repo,
+			PAT:         auth.AzDOPAT,
+			ReviewerPAT: auth.AzDOPATReviewer,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported forge kind %q", kind)
+}
+
+// GitHubForge submits PRs to a GitHub repository using the GitHub REST and GraphQL APIs.
+type GitHubForge struct {
+	Target *Remote
+	Head   *Remote
+	// APIURL is the base URL of the GitHub REST API. If empty, uses githubutil.APIURL. This can
+	// point at a GitHub Enterprise Server API or a local stand-in for testing.
+	APIURL string
+	// Out receives the logs of the API requests and responses. If nil, uses os.Stdout.
+	Out io.Writer
+
+	User        string
+	PAT         string
+	ReviewerPAT string
+}
+
+func (g *GitHubForge) CreatePR(ctx context.Context, r *PRRequest) (*PR, error) {
+	request := g.gitHubRequest(r)
+	response, err := postGitHub(g.out(), g.apiURL(), g.Target.GetOwnerSlashRepo(), request, g.PAT)
+	if err != nil {
+		return nil, err
+	}
+	if response.AlreadyExists {
+		return nil, fmt.Errorf("%w: %v", ErrPRAlreadyExists, response.Errors)
+	}
+	return &PR{
+		Number: response.Number,
+		URL:    response.HTMLURL,
+		NodeID: response.NodeID,
+	}, nil
+}
+
+func (g *GitHubForge) FindExistingPR(ctx context.Context, r *PRRequest) (*PR, error) {
+	existing, err := findExistingPR(g.out(), g.apiURL(), g.gitHubRequest(r), g.Head, g.Target, r.HeadBranch, g.User, g.PAT)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	return &PR{
+		Number: existing.Number,
+		URL:    existing.URL,
+		NodeID: existing.ID,
+	}, nil
+}
+
+func (g *GitHubForge) ApprovePR(ctx context.Context, pr *PR) error {
+	return approvePR(g.out(), g.apiURL(), pr.NodeID, g.ReviewerPAT)
+}
+
+func (g *GitHubForge) EnablePRAutoMerge(ctx context.Context, pr *PR) error {
+	return enablePRAutoMerge(g.out(), g.apiURL(), pr.NodeID, g.ReviewerPAT)
+}
+
+func (g *GitHubForge) CommentPR(ctx context.Context, pr *PR, body string) error {
+	return addPRComment(g.out(), g.apiURL(), pr.NodeID, body, g.PAT)
+}
+
+func (g *GitHubForge) ListOpenPRs(ctx context.Context, headBranchPrefix string) ([]*OpenPR, error) {
+	prs, err := listOpenPRs(g.out(), g.apiURL(), g.User, g.PAT)
+	if err != nil {
+		return nil, err
+	}
+	var found []*OpenPR
+	for _, pr := range prs {
+		if !strings.HasPrefix(pr.HeadRefName, headBranchPrefix) ||
+			!strings.EqualFold(pr.HeadRepositoryOwner.Login, g.Head.GetOwner()) ||
+			!strings.EqualFold(pr.BaseRepository.NameWithOwner, g.Target.GetOwnerSlashRepo()) {
+			continue
+		}
+		found = append(found, &OpenPR{
+			PR: PR{
+				Number: pr.Number,
+				URL:    pr.URL,
+				NodeID: pr.ID,
+			},
+			HeadBranch: pr.HeadRefName,
+			BaseBranch: pr.BaseRefName,
+			Title:      pr.Title,
+		})
+	}
+	return found, nil
+}
+
+func (g *GitHubForge) ClosePR(ctx context.Context, pr *PR) error {
+	return closePR(g.out(), g.apiURL(), pr.NodeID, g.PAT)
+}
+
+func (g *GitHubForge) Gitlink(ctx context.Context, commit, path string) (string, error) {
+	return getGitlink(g.out(), g.apiURL(), g.Target.GetOwnerSlashRepo(), commit, path, g.PAT)
+}
+
+func (g *GitHubForge) out() io.Writer {
+	if g.Out != nil {
+		return g.Out
+	}
+	return os.Stdout
+}
+
+func (g *GitHubForge) apiURL() string {
+	if g.APIURL != "" {
+		return g.APIURL
+	}
+	return githubutil.APIURL()
+}
+
+func (g *GitHubForge) gitHubRequest(r *PRRequest) *GitHubRequest {
+	return &GitHubRequest{
+		Head:                g.Head.GetOwner() + ":" + r.HeadBranch,
+		Base:                r.BaseBranch,
+		Title:               r.Title,
+		Body:                r.Body,
+		MaintainerCanModify: true,
+		Draft:               r.Draft,
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package gitpr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectForgeKind(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    ForgeKind
+		wantErr bool
+	}{
+		{"https://github.com/microsoft/go", ForgeGitHub, false},
+		{"git@github.com:microsoft/go", ForgeGitHub, false},
+		{"https://dev.azure.com/dnceng/internal/_git/microsoft-go-mirror", ForgeAzDO, false},
+		{"https://dnceng@dev.azure.com/dnceng/internal/_git/microsoft-go-mirror", ForgeAzDO, false},
+		{"https://dnceng.visualstudio.com/internal/_git/microsoft-go-mirror", ForgeAzDO, false},
+		{"https://go.googlesource.com/go", "", true},
+		{"/tmp/target/microsoft/go", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := DetectForgeKind(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectForgeKind() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DetectForgeKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAzDORepoURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    AzDORepo
+		wantErr bool
+	}{
+		{
+			"https://dnceng@dev.azure.com/dnceng/internal/_git/microsoft-go-mirror",
+			AzDORepo{"https://dev.azure.com/dnceng", "internal", "microsoft-go-mirror"},
+			false,
+		},
+		{
+			"https://dnceng.visualstudio.com/internal/_git/microsoft-go-mirror",
+			AzDORepo{"https://dnceng.visualstudio.com", "internal", "microsoft-go-mirror"},
+			false,
+		},
+		{"https://dev.azure.com/dnceng/internal", AzDORepo{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := ParseAzDORepoURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAzDORepoURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("ParseAzDORepoURL() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeForge(t *testing.T) {
+	ctx := context.Background()
+	var f FakeForge
+	r := PRRefSet{Name: "microsoft/main", Purpose: "auto-sync"}.CreatePRRequest("Title", "Body")
+
+	pr, err := f.CreatePR(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.CreatePR(ctx, r); !errors.Is(err, ErrPRAlreadyExists) {
+		t.Fatalf("second CreatePR error = %v, want ErrPRAlreadyExists", err)
+	}
+	existing, err := f.FindExistingPR(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing == nil || *existing != *pr {
+		t.Fatalf("FindExistingPR() = %+v, want %+v", existing, pr)
+	}
+	if err := f.ApprovePR(ctx, pr); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.CommentPR(ctx, pr, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	prs := f.PRs()
+	if len(prs) != 1 {
+		t.Fatalf("got %v PRs, want 1", len(prs))
+	}
+	if got := prs[0]; !got.Approved || got.AutoMerge || len(got.Comments) != 1 || got.Request.HeadBranch != "dev/auto-sync/microsoft/main" {
+		t.Errorf("unexpected PR state: %+v", got)
+	}
+
+	open, err := f.ListOpenPRs(ctx, "dev/auto-sync/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].PR != *pr || open[0].BaseBranch != "microsoft/main" {
+		t.Fatalf("ListOpenPRs() = %+v, want PR %+v", open, pr)
+	}
+	if err := f.ClosePR(ctx, pr); err != nil {
+		t.Fatal(err)
+	}
+	if open, err := f.ListOpenPRs(ctx, "dev/auto-sync/"); err != nil || len(open) != 0 {
+		t.Fatalf("ListOpenPRs() after close = %+v, %v; want none", open, err)
+	}
+	if _, err := f.CreatePR(ctx, r); err != nil {
+		t.Fatalf("CreatePR after close: %v", err)
+	}
+}
+
+func TestGitHubForge_Gitlink(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("ref"); got != "main-commit" {
+			http.Error(w, "unexpected ref "+got, http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/microsoft/go/contents/go":
+			w.Write([]byte(`{"type": "submodule", "sha": "` + commit + `"}`))
+		case "/repos/microsoft/go/contents/README.md":
+			w.Write([]byte(`{"type": "file", "sha": "abc"}`))
+		case "/repos/microsoft/go/contents/eng":
+			w.Write([]byte(`[{"type": "file", "sha": "abc"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	target, err := ParseRemoteURL("https://github.com/microsoft/go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &GitHubForge{Target: target, Head: target, APIURL: server.URL, PAT: "fake-pat"}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"go", commit},
+		{"README.md", ""},
+		{"eng", ""},
+		{"missing", ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := g.Gitlink(context.Background(), "main-commit", tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Gitlink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
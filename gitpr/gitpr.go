@@ -7,11 +7,16 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"time"
+
+	"github.com/microsoft/go-infra/githubutil"
 )
 
 var client = http.Client{
@@ -145,6 +150,10 @@ type Remote struct {
 // and grabs the owner ("microsoft") and repository name ("go"). This assumes the URL follows one of
 // these two patterns, or something that's compatible. Returns an initialized 'Remote'.
 func ParseRemoteURL(url string) (*Remote, error) {
+	return parseRemoteURL(os.Stdout, url)
+}
+
+func parseRemoteURL(out io.Writer, url string) (*Remote, error) {
 	r := &Remote{
 		url,
 		strings.FieldsFunc(url, func(r rune) bool { return r == '/' || r == ':' }),
@@ -156,7 +165,7 @@ func ParseRemoteURL(url string) (*Remote, error) {
 			r.urlParts,
 		)
 	}
-	fmt.Printf("From repo URL %v, detected %v for the PR target.\n", url, r.urlParts)
+	fmt.Fprintf(out, "From repo URL %v, detected %v for the PR target.\n", url, r.urlParts)
 	return r, nil
 }
 
@@ -174,7 +183,7 @@ func (r Remote) GetOwnerSlashRepo() string {
 
 // GetUsername queries GitHub for the username associated with a PAT.
 func GetUsername(pat string) string {
-	request, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	request, err := http.NewRequest("GET", githubutil.APIURL()+"/user", nil)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -184,7 +193,7 @@ func GetUsername(pat string) string {
 		Login string `json:"login"`
 	}{}
 
-	if err := sendJSONRequestSuccessful(request, response); err != nil {
+	if err := sendJSONRequestSuccessful(os.Stdout, request, response); err != nil {
 		log.Panic(err)
 	}
 
@@ -193,9 +202,9 @@ func GetUsername(pat string) string {
 
 // sendJSONRequest sends a request for JSON information. The JSON response is unmarshalled (parsed)
 // into the 'response' parameter, based on the structure of 'response'.
-func sendJSONRequest(request *http.Request, response interface{}) (status int, err error) {
+func sendJSONRequest(out io.Writer, request *http.Request, response interface{}) (status int, err error) {
 	request.Header.Add("Accept", "application/vnd.github.v3+json")
-	fmt.Printf("Sending request: %v %v\n", request.Method, request.URL)
+	fmt.Fprintf(out, "Sending request: %v %v\n", request.Method, request.URL)
 
 	httpResponse, err := client.Do(request)
 	if err != nil {
@@ -206,7 +215,7 @@ func sendJSONRequest(request *http.Request, response interface{}) (status int, e
 
 	for key, value := range httpResponse.Header {
 		if strings.HasPrefix(key, "X-Ratelimit-") {
-			fmt.Printf("%v : %v\n", key, value)
+			fmt.Fprintf(out, "%v : %v\n", key, value)
 		}
 	}
 
@@ -215,8 +224,8 @@ func sendJSONRequest(request *http.Request, response interface{}) (status int, e
 		return
 	}
 
-	fmt.Printf("---- Full response:\n%v\n", string(jsonBytes))
-	fmt.Printf("----\n")
+	fmt.Fprintf(out, "---- Full response:\n%v\n", string(jsonBytes))
+	fmt.Fprintf(out, "----\n")
 
 	err = json.Unmarshal(jsonBytes, response)
 	return
@@ -224,8 +233,8 @@ func sendJSONRequest(request *http.Request, response interface{}) (status int, e
 
 // sendJSONRequestSuccessful sends a request for JSON information via sendJSONRequest and verifies
 // the status code is success.
-func sendJSONRequestSuccessful(request *http.Request, response interface{}) error {
-	status, err := sendJSONRequest(request, response)
+func sendJSONRequestSuccessful(out io.Writer, request *http.Request, response interface{}) error {
+	status, err := sendJSONRequest(out, request, response)
 	if err != nil {
 		return err
 	}
@@ -266,17 +275,21 @@ type GitHubRequestError struct {
 }
 
 func PostGitHub(ownerRepo string, request *GitHubRequest, pat string) (response *GitHubResponse, err error) {
+	return postGitHub(os.Stdout, githubutil.APIURL(), ownerRepo, request, pat)
+}
+
+func postGitHub(out io.Writer, apiURL, ownerRepo string, request *GitHubRequest, pat string) (response *GitHubResponse, err error) {
 	prSubmitContent, err := json.MarshalIndent(request, "", "")
-	fmt.Printf("Submitting payload: %s\n", prSubmitContent)
+	fmt.Fprintf(out, "Submitting payload: %s\n", prSubmitContent)
 
-	httpRequest, err := http.NewRequest("POST", "https://api.github.com/repos/"+ownerRepo+"/pulls", bytes.NewReader(prSubmitContent))
+	httpRequest, err := http.NewRequest("POST", apiURL+"/repos/"+ownerRepo+"/pulls", bytes.NewReader(prSubmitContent))
 	if err != nil {
 		return
 	}
 	httpRequest.SetBasicAuth("", pat)
 
 	response = &GitHubResponse{}
-	statusCode, err := sendJSONRequest(httpRequest, response)
+	statusCode, err := sendJSONRequest(out, httpRequest, response)
 	if err != nil {
 		return
 	}
@@ -321,6 +334,10 @@ func PostGitHub(ownerRepo string, request *GitHubRequest, pat string) (response
 }
 
 func QueryGraphQL(pat string, query string, variables map[string]interface{}, result interface{}) error {
+	return queryGraphQL(os.Stdout, githubutil.APIURL(), pat, query, variables, result)
+}
+
+func queryGraphQL(out io.Writer, apiURL, pat string, query string, variables map[string]interface{}, result interface{}) error {
 	queryBytes, err := json.Marshal(&struct {
 		Query     string                 `json:"query"`
 		Variables map[string]interface{} `json:"variables,omitempty"`
@@ -332,30 +349,39 @@ func QueryGraphQL(pat string, query string, variables map[string]interface{}, re
 		return err
 	}
 
-	httpRequest, err := http.NewRequest("POST", "https://api.github.com/graphql", bytes.NewReader(queryBytes))
+	httpRequest, err := http.NewRequest("POST", githubutil.GraphQLURL(apiURL), bytes.NewReader(queryBytes))
 	if err != nil {
 		return err
 	}
 	httpRequest.SetBasicAuth("", pat)
 
-	return sendJSONRequestSuccessful(httpRequest, result)
+	return sendJSONRequestSuccessful(out, httpRequest, result)
 }
 
 func MutateGraphQL(pat string, query string, variables map[string]interface{}) error {
+	return mutateGraphQL(os.Stdout, githubutil.APIURL(), pat, query, variables)
+}
+
+func mutateGraphQL(out io.Writer, apiURL, pat string, query string, variables map[string]interface{}) error {
 	// Queries and mutations use the same API. But with a mutation, the results aren't useful to us.
-	return QueryGraphQL(pat, query, variables, &struct{}{})
+	return queryGraphQL(out, apiURL, pat, query, variables, &struct{}{})
 }
 
 type ExistingPR struct {
 	Title  string
 	ID     string
 	Number int
+	URL    string
 }
 
 // FindExistingPR looks for a PR submitted to a target branch with a set of filters. Returns the
 // result's graphql identity if one match is found, empty string if no matches are found, and an
 // error if more than one match was found.
 func FindExistingPR(r *GitHubRequest, head, target *Remote, headBranch, submitterUser, githubPAT string) (*ExistingPR, error) {
+	return findExistingPR(os.Stdout, githubutil.APIURL(), r, head, target, headBranch, submitterUser, githubPAT)
+}
+
+func findExistingPR(out io.Writer, apiURL string, r *GitHubRequest, head, target *Remote, headBranch, submitterUser, githubPAT string) (*ExistingPR, error) {
 	prQuery := `query ($githubUser: String!, $headRefName: String!, $baseRefName: String!) {
 		user(login: $githubUser) {
 			pullRequests(states: OPEN, headRefName: $headRefName, baseRefName: $baseRefName, first: 5) {
@@ -363,6 +389,7 @@ func FindExistingPR(r *GitHubRequest, head, target *Remote, headBranch, submitte
 					title
 					id
 					number
+					url
 					headRepositoryOwner {
 						login
 					}
@@ -411,10 +438,10 @@ func FindExistingPR(r *GitHubRequest, head, target *Remote, headBranch, submitte
 		}
 	}{}
 
-	if err := QueryGraphQL(githubPAT, prQuery, variables, result); err != nil {
+	if err := queryGraphQL(out, apiURL, githubPAT, prQuery, variables, result); err != nil {
 		return nil, err
 	}
-	fmt.Printf("%+v\n", result)
+	fmt.Fprintf(out, "%+v\n", result)
 
 	// Basic search result validation. We could be more flexible in some cases, but the goal here is
 	// to detect an unknown state early so we don't end up doing something strange.
@@ -440,10 +467,86 @@ func FindExistingPR(r *GitHubRequest, head, target *Remote, headBranch, submitte
 	return &n.ExistingPR, nil
 }
 
+// userOpenPR is an open PR found by listOpenPRs.
+type userOpenPR struct {
+	ExistingPR
+	HeadRefName         string
+	BaseRefName         string
+	HeadRepositoryOwner struct {
+		Login string
+	}
+	BaseRepository struct {
+		NameWithOwner string
+	}
+}
+
+// listOpenPRs finds all open PRs created by submitterUser, in any repository.
+func listOpenPRs(out io.Writer, apiURL, submitterUser, githubPAT string) ([]userOpenPR, error) {
+	prQuery := `query ($githubUser: String!, $cursor: String) {
+		user(login: $githubUser) {
+			pullRequests(states: OPEN, first: 100, after: $cursor) {
+				nodes {
+					title
+					id
+					number
+					url
+					headRefName
+					baseRefName
+					headRepositoryOwner {
+						login
+					}
+					baseRepository {
+						nameWithOwner
+					}
+				}
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
+			}
+		}
+	}`
+	var prs []userOpenPR
+	var cursor interface{}
+	for {
+		result := &struct {
+			Data struct {
+				User struct {
+					PullRequests struct {
+						Nodes    []userOpenPR
+						PageInfo struct {
+							HasNextPage bool
+							EndCursor   string
+						}
+					}
+				}
+			}
+		}{}
+		variables := map[string]interface{}{
+			"githubUser": submitterUser,
+			"cursor":     cursor,
+		}
+		if err := queryGraphQL(out, apiURL, githubPAT, prQuery, variables, result); err != nil {
+			return nil, err
+		}
+		page := result.Data.User.PullRequests
+		prs = append(prs, page.Nodes...)
+		if !page.PageInfo.HasNextPage {
+			return prs, nil
+		}
+		cursor = page.PageInfo.EndCursor
+	}
+}
+
 // ApprovePR adds an approving review on the target GraphQL PR node ID. The review author is the user
 // associated with the PAT.
 func ApprovePR(nodeID string, pat string) error {
-	return MutateGraphQL(
+	return approvePR(os.Stdout, githubutil.APIURL(), nodeID, pat)
+}
+
+func approvePR(out io.Writer, apiURL, nodeID string, pat string) error {
+	return mutateGraphQL(out,
+		apiURL,
 		pat,
 		`mutation ($nodeID: ID!) {
 				addPullRequestReview(input: {pullRequestId: $nodeID, event: APPROVE, body: "Thanks! Auto-approving."}) {
@@ -455,7 +558,12 @@ func ApprovePR(nodeID string, pat string) error {
 
 // EnablePRAutoMerge enables PR automerge on the target GraphQL PR node ID.
 func EnablePRAutoMerge(nodeID string, pat string) error {
-	return MutateGraphQL(
+	return enablePRAutoMerge(os.Stdout, githubutil.APIURL(), nodeID, pat)
+}
+
+func enablePRAutoMerge(out io.Writer, apiURL, nodeID string, pat string) error {
+	return mutateGraphQL(out,
+		apiURL,
 		pat,
 		`mutation ($nodeID: ID!) {
 			enablePullRequestAutoMerge(input: {pullRequestId: $nodeID, mergeMethod: MERGE}) {
@@ -465,6 +573,75 @@ func EnablePRAutoMerge(nodeID string, pat string) error {
 		map[string]interface{}{"nodeID": nodeID})
 }
 
+// AddPRComment adds a comment to the target GraphQL PR node ID. The comment author is the user
+// associated with the PAT.
+func AddPRComment(nodeID string, body string, pat string) error {
+	return addPRComment(os.Stdout, githubutil.APIURL(), nodeID, body, pat)
+}
+
+func addPRComment(out io.Writer, apiURL, nodeID string, body string, pat string) error {
+	return mutateGraphQL(out,
+		apiURL,
+		pat,
+		`mutation ($nodeID: ID!, $body: String!) {
+			addComment(input: {subjectId: $nodeID, body: $body}) {
+				clientMutationId
+			}
+		}`,
+		map[string]interface{}{"nodeID": nodeID, "body": body})
+}
+
+func closePR(out io.Writer, apiURL, nodeID string, pat string) error {
+	return mutateGraphQL(out,
+		apiURL,
+		pat,
+		`mutation ($nodeID: ID!) {
+			closePullRequest(input: {pullRequestId: $nodeID}) {
+				clientMutationId
+			}
+		}`,
+		map[string]interface{}{"nodeID": nodeID})
+}
+
+// getGitlink uses the GitHub contents API to find the commit that the submodule at path points to
+// in the given commit of the ownerRepo repository. Returns empty string if path doesn't exist or
+// isn't a submodule.
+func getGitlink(out io.Writer, apiURL, ownerRepo, commit, path, pat string) (string, error) {
+	u := apiURL + "/repos/" + ownerRepo + "/contents/" + (&url.URL{Path: path}).EscapedPath() + "?ref=" + url.QueryEscape(commit)
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth("", pat)
+
+	// The response is an array if path is a directory, so check what it is before parsing it.
+	var response json.RawMessage
+	status, err := sendJSONRequest(out, request, &response)
+	if status == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if status < 200 || status > 299 {
+		return "", fmt.Errorf("request unsuccessful, http status %v, %v", status, http.StatusText(status))
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(response), []byte("[")) {
+		return "", nil
+	}
+	var content struct {
+		Type string `json:"type"`
+		SHA  string `json:"sha"`
+	}
+	if err := json.Unmarshal(response, &content); err != nil {
+		return "", err
+	}
+	if content.Type != "submodule" {
+		return "", nil
+	}
+	return content.SHA, nil
+}
+
 // createRefspec makes a refspec that will fetch or push a branch "source" to "dest". The args must
 // not already have a "refs/heads/" prefix.
 func createRefspec(source, dest string) string {
@@ -0,0 +1,158 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/microsoft/go-infra/executil"
+	"github.com/microsoft/go-infra/gitcmd"
+)
+
+// ApplyStatus is how well a patch applies to a commit.
+type ApplyStatus int
+
+const (
+	// ApplyClean means every hunk of the patch applies exactly where the patch file says it should.
+	ApplyClean ApplyStatus = iota
+	// ApplyFuzz means the patch applies, but some hunks only apply at a different line (offset) or
+	// only when ignoring some of their context lines (fuzz). A dev should refresh the patch file,
+	// but it doesn't need to be fixed up.
+	ApplyFuzz
+	// ApplyConflict means the patch doesn't apply.
+	ApplyConflict
+)
+
+func (s ApplyStatus) String() string {
+	switch s {
+	case ApplyClean:
+		return "clean"
+	case ApplyFuzz:
+		return "fuzz"
+	case ApplyConflict:
+		return "conflict"
+	}
+	return fmt.Sprintf("ApplyStatus(%d)", int(s))
+}
+
+// CheckResult is the result of checking whether one patch file applies.
+type CheckResult struct {
+	// Path is the path of the patch file.
+	Path   string
+	Status ApplyStatus
+	// Detail is the "git apply" output that explains a status other than ApplyClean.
+	Detail string
+}
+
+// fuzzContext is the number of context lines "git apply" needs to match when checking a patch that
+// doesn't apply cleanly for fuzz.
+const fuzzContext = 1
+
+// offsetRegexp matches the "git apply -v" message for a hunk that applies at a different line.
+var offsetRegexp = regexp.MustCompile(`(?m)^Hunk #\d+ succeeded at \d+ \(offset .*$`)
+
+// Check applies each patch in patchesDir in order to baseCommit of the repository at submodulePath
+// in a temp clone, and returns how well each patch applies. If a patch conflicts, it is skipped, and
+// the remaining patches are applied without it. This means a conflict may cause conflicts in later
+// patches that depend on it.
+func Check(submodulePath, baseCommit, patchesDir string) ([]CheckResult, error) {
+	gitDir, err := gitcmd.NewTempCloneRepo(submodulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp clone of submodule to check patches: %v", err)
+	}
+	defer gitcmd.AttemptDelete(gitDir)
+	if err := gitcmd.Run(gitDir, "checkout", "-q", baseCommit); err != nil {
+		return nil, fmt.Errorf("failed to check out base commit in temp repo: %v", err)
+	}
+
+	var results []CheckResult
+	err = WalkPatches(patchesDir, func(path string) error {
+		// Make sure path is absolute because we will pass it to Git running in a different working dir.
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		r, err := checkApply(gitDir, absPath)
+		if err != nil {
+			return err
+		}
+		r.Path = path
+		results = append(results, *r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkApply checks how well the patch at path applies to HEAD of the repository at gitDir. If it
+// applies, commits it.
+func checkApply(gitDir, path string) (*CheckResult, error) {
+	var r CheckResult
+	amArgs := []string{"am", "-q", "--whitespace=nowarn"}
+
+	out, ok, err := gitApplyCheck(gitDir, "-v", path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if offsets := offsetRegexp.FindAllString(out, -1); len(offsets) > 0 {
+			r.Status = ApplyFuzz
+			r.Detail = strings.Join(offsets, "\n")
+		}
+	} else {
+		fuzzArg := fmt.Sprintf("-C%d", fuzzContext)
+		if _, fuzzOK, err := gitApplyCheck(gitDir, fuzzArg, path); err != nil {
+			return nil, err
+		} else if fuzzOK {
+			r.Status = ApplyFuzz
+			r.Detail = fmt.Sprintf("Applies only when matching %v line(s) of context:\n%v", fuzzContext, applyErrors(out))
+			amArgs = append(amArgs, fuzzArg)
+		} else {
+			r.Status = ApplyConflict
+			r.Detail = applyErrors(out)
+			return &r, nil
+		}
+	}
+
+	if err := gitcmd.Run(gitDir, append(amArgs, path)...); err != nil {
+		return nil, fmt.Errorf("failed to apply patch after successful check: %v", err)
+	}
+	return &r, nil
+}
+
+// gitApplyCheck runs "git apply --check" with the given args in gitDir. Returns the output and
+// whether the check succeeded. Only returns an error if Git couldn't be run.
+func gitApplyCheck(gitDir string, args ...string) (string, bool, error) {
+	c := executil.Dir(gitDir, "git", append([]string{"apply", "--check", "--whitespace=nowarn"}, args...)...)
+	fmt.Printf("---- Running command: %v %v\n", c.Path, c.Args)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), false, nil
+		}
+		return "", false, err
+	}
+	return string(out), true, nil
+}
+
+// applyErrors returns the lines of "git apply" output that describe why the patch didn't apply.
+func applyErrors(out string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.HasPrefix(line, "Checking patch ") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		patchesDir string
+		base       string
+		want       []ApplyStatus
+	}{
+		{"clean", "TestApplyMiddleConflict/before", "v1.0.0", []ApplyStatus{ApplyClean, ApplyClean, ApplyClean}},
+		{"middle conflict", "TestApplyMiddleConflict/before", "v1.0.2", []ApplyStatus{ApplyClean, ApplyConflict, ApplyClean}},
+		{"fuzz", "TestApplyAllNew/after", "v1.0.0", []ApplyStatus{ApplyFuzz, ApplyClean}},
+		{"corrupt", "TestApplyCorruptBeforePatch/before", "v1.0.2", []ApplyStatus{ApplyConflict}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			results, err := Check(filepath.Join("testdata", "moremath.pack"), tt.base, filepath.Join("testdata", tt.patchesDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []ApplyStatus
+			for _, r := range results {
+				got = append(got, r.Status)
+				if (r.Status == ApplyClean) != (r.Detail == "") {
+					t.Errorf("patch %#q is %v with detail %q", r.Path, r.Status, r.Detail)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -46,6 +46,41 @@ type Config struct {
 	//
 	// Example: "microsoft-golang-bot <microsoft-golang-bot@users.noreply.github.com>"
 	ExtractAsAuthor string `json:",omitempty"`
+
+	// Lint configures the rules checked by "git-go-patch lint". If nil, lint uses DefaultLintConfig.
+	Lint *LintConfig `json:",omitempty"`
+}
+
+// LintConfig configures the rules checked by "git-go-patch lint". A rule with a zero value isn't
+// checked. Rules marked as fixable can be fixed automatically by "git-go-patch lint -fix".
+type LintConfig struct {
+	// TrailingWhitespace reports added lines that end in whitespace. Fixable.
+	TrailingWhitespace bool `json:",omitempty"`
+	// SubjectPattern is a regular expression that the first line of each patch's subject must
+	// match. The "[PATCH] " prefix added by "git format-patch" isn't included.
+	//
+	// Example: "^[a-z0-9/._,-]+: " requires a Go-style package prefix, like "crypto/tls: ".
+	SubjectPattern string `json:",omitempty"`
+	// RequireExtractAsAuthor reports patches with an author other than ExtractAsAuthor. Fixable.
+	RequireExtractAsAuthor bool `json:",omitempty"`
+	// MaxChangedLines is the maximum number of added and deleted lines in one patch.
+	MaxChangedLines int `json:",omitempty"`
+	// ForbiddenPaths are "path.Match" patterns of files that patches must not change. A pattern also
+	// matches all files in the directories it matches.
+	ForbiddenPaths []string `json:",omitempty"`
+	// DuplicateHunks reports hunks that make the same change to the same file as a hunk in an
+	// earlier patch.
+	DuplicateHunks bool `json:",omitempty"`
+	// Numbering reports patch files that aren't named like "0001-Subject.patch", with the numbers
+	// "git-go-patch extract" would give them. Fixable.
+	Numbering bool `json:",omitempty"`
+}
+
+// DefaultLintConfig is the lint config used if the config file doesn't specify one.
+var DefaultLintConfig = LintConfig{
+	TrailingWhitespace: true,
+	DuplicateHunks:     true,
+	Numbering:          true,
 }
 
 // FoundConfig is a Config file's contents plus the location the config file was found, the RootDir.
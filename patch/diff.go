@@ -0,0 +1,348 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/go-infra/stringutil"
+)
+
+// Diff is the parsed content of a Git patch file after the header: the diff of each file. ParseDiff
+// and String round-trip byte for byte, so a tool can parse a patch file, change some lines, and
+// write it back without making unrelated changes.
+type Diff struct {
+	// Preamble is the text before the first file diff, like the "---" line and the diffstat.
+	Preamble string
+	Files    []*FileDiff
+	// Trailer is the text after the last file diff, like the "-- " signature line and Git version.
+	Trailer string
+}
+
+// FileDiff is the diff of one file.
+type FileDiff struct {
+	// HeaderLines are the lines from "diff --git" up to the first hunk, without newlines. This
+	// includes the extended header lines like "index" and "rename from", the "---" and "+++" lines,
+	// and any binary patch data. String writes them as-is: the parsed fields below describe them,
+	// but changing the fields doesn't change the output.
+	HeaderLines []string
+
+	// OldPath and NewPath are the paths of the file before and after the change, without the "a/"
+	// or "b/" prefix. OldPath is empty if the file is new, and NewPath is empty if it's deleted.
+	OldPath, NewPath string
+	// OldMode and NewMode are the file modes before and after the change, like "100644", if the
+	// header includes them.
+	OldMode, NewMode string
+	// Renamed and Copied report whether the diff is a rename or copy from OldPath to NewPath.
+	Renamed, Copied bool
+	// Binary reports whether the diff is a binary diff, without any hunks.
+	Binary bool
+
+	Hunks []*Hunk
+}
+
+// Path returns the path of the file after the change, or before the change if it's deleted.
+func (f *FileDiff) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+// Hunk is a range of lines changed in a file, and the surrounding context lines.
+type Hunk struct {
+	// OldStart and OldLines are the range of lines in the file before the change. If OldLines is 0,
+	// OldStart is the line before the empty range. NewStart and NewLines are the same for the file
+	// after the change.
+	OldStart, OldLines int
+	NewStart, NewLines int
+	// Section is the text after the closing "@@" of the hunk header, usually the enclosing
+	// function, including the leading space.
+	Section string
+	Lines   []Line
+
+	// oldLinesExplicit and newLinesExplicit record that a line count of 1 is written explicitly in
+	// the hunk header, like "-3,1", rather than omitted, like Git does.
+	oldLinesExplicit, newLinesExplicit bool
+}
+
+// LineOp is the kind of a hunk line, written as the first character of the line.
+type LineOp byte
+
+const (
+	LineContext   LineOp = ' '
+	LineDeleted   LineOp = '-'
+	LineAdded     LineOp = '+'
+	LineNoNewline LineOp = '\\'
+)
+
+// Line is a line of a hunk.
+type Line struct {
+	Op LineOp
+	// Text is the line after the op character, without the newline.
+	Text string
+}
+
+// ParseDiff parses the content of a patch file after the header, like Patch.Content.
+func ParseDiff(content string) (*Diff, error) {
+	var d Diff
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	i := 0
+	for ; i < len(lines) && !strings.HasPrefix(lines[i], "diff --git "); i++ {
+		d.Preamble += lines[i]
+	}
+	for i < len(lines) && strings.HasPrefix(lines[i], "diff --git ") {
+		f := &FileDiff{HeaderLines: []string{strings.TrimSuffix(lines[i], "\n")}}
+		i++
+		// Extended header lines and binary patch data continue until the first hunk or the next
+		// file. Binary patch data includes an empty line, so the end of the header isn't as
+		// straightforward to detect as the end of a hunk.
+		for ; i < len(lines) && !strings.HasPrefix(lines[i], "@@ ") && !strings.HasPrefix(lines[i], "diff --git "); i++ {
+			if !f.Binary && strings.HasPrefix(lines[i], "-- ") {
+				// Signature: the file diff is done.
+				break
+			}
+			f.HeaderLines = append(f.HeaderLines, strings.TrimSuffix(lines[i], "\n"))
+		}
+		if err := f.parseHeader(); err != nil {
+			return nil, err
+		}
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			h, err := parseHunkHeader(strings.TrimSuffix(lines[i], "\n"))
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", f.Path(), err)
+			}
+			i++
+			for oldLeft, newLeft := h.OldLines, h.NewLines; oldLeft > 0 || newLeft > 0 || (i < len(lines) && strings.HasPrefix(lines[i], `\`)); i++ {
+				if i >= len(lines) {
+					return nil, fmt.Errorf("%v: hunk %q ends early", f.Path(), h.header())
+				}
+				line := strings.TrimSuffix(lines[i], "\n")
+				if line == "" {
+					return nil, fmt.Errorf("%v: empty line in hunk %q: context lines must start with a space", f.Path(), h.header())
+				}
+				l := Line{Op: LineOp(line[0]), Text: line[1:]}
+				switch l.Op {
+				case LineContext:
+					oldLeft--
+					newLeft--
+				case LineDeleted:
+					oldLeft--
+				case LineAdded:
+					newLeft--
+				case LineNoNewline:
+				default:
+					return nil, fmt.Errorf("%v: unexpected line in hunk %q: %q", f.Path(), h.header(), line)
+				}
+				if oldLeft < 0 || newLeft < 0 {
+					return nil, fmt.Errorf("%v: hunk %q has more lines than its header says", f.Path(), h.header())
+				}
+				h.Lines = append(h.Lines, l)
+			}
+			f.Hunks = append(f.Hunks, h)
+		}
+		d.Files = append(d.Files, f)
+	}
+	for ; i < len(lines); i++ {
+		d.Trailer += lines[i]
+	}
+	if !strings.HasSuffix(content, "\n") && content != "" && d.Trailer == "" {
+		return nil, fmt.Errorf("diff doesn't end with a newline")
+	}
+	return &d, nil
+}
+
+// String formats the diff. If d was returned by ParseDiff and not modified, returns the content it
+// was parsed from.
+func (d *Diff) String() string {
+	var b strings.Builder
+	b.WriteString(d.Preamble)
+	for _, f := range d.Files {
+		for _, line := range f.HeaderLines {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		for _, h := range f.Hunks {
+			b.WriteString(h.header())
+			b.WriteString("\n")
+			for _, l := range h.Lines {
+				b.WriteByte(byte(l.Op))
+				b.WriteString(l.Text)
+				b.WriteString("\n")
+			}
+		}
+	}
+	b.WriteString(d.Trailer)
+	return b.String()
+}
+
+// Diff parses the diff content of the patch.
+func (h *Patch) Diff() (*Diff, error) {
+	return ParseDiff(h.Content)
+}
+
+// parseHeader sets the fields of f that describe its HeaderLines.
+func (f *FileDiff) parseHeader() error {
+	var oldPath, newPath string
+	var oldFound, newFound bool
+	var err error
+	for _, line := range f.HeaderLines[1:] {
+		switch {
+		case f.Binary:
+			// Binary patch data.
+		case strings.HasPrefix(line, "--- "):
+			oldPath, err = parseDiffPath(line[len("--- "):], "a/")
+			oldFound = true
+		case strings.HasPrefix(line, "+++ "):
+			newPath, err = parseDiffPath(line[len("+++ "):], "b/")
+			newFound = true
+		case strings.HasPrefix(line, "rename from "):
+			f.Renamed = true
+			oldPath, err = parseDiffPath(line[len("rename from "):], "")
+			oldFound = true
+		case strings.HasPrefix(line, "rename to "):
+			newPath, err = parseDiffPath(line[len("rename to "):], "")
+			newFound = true
+		case strings.HasPrefix(line, "copy from "):
+			f.Copied = true
+			oldPath, err = parseDiffPath(line[len("copy from "):], "")
+			oldFound = true
+		case strings.HasPrefix(line, "copy to "):
+			newPath, err = parseDiffPath(line[len("copy to "):], "")
+			newFound = true
+		case strings.HasPrefix(line, "old mode "):
+			f.OldMode = line[len("old mode "):]
+		case strings.HasPrefix(line, "new mode "):
+			f.NewMode = line[len("new mode "):]
+		case strings.HasPrefix(line, "deleted file mode "):
+			f.OldMode = line[len("deleted file mode "):]
+			newFound = true
+		case strings.HasPrefix(line, "new file mode "):
+			f.NewMode = line[len("new file mode "):]
+			oldFound = true
+		case strings.HasPrefix(line, "index "):
+			// "index <old>..<new> <mode>": the mode is only here if it didn't change.
+			if _, mode, ok := strings.Cut(line[len("index "):], " "); ok {
+				f.OldMode, f.NewMode = mode, mode
+			}
+		case line == "GIT binary patch", strings.HasPrefix(line, "Binary files "):
+			f.Binary = true
+		}
+		if err != nil {
+			return fmt.Errorf("invalid file header line %q: %v", line, err)
+		}
+	}
+	if !oldFound || !newFound {
+		// A mode change or binary diff without "---" and "+++": get the paths from the
+		// "diff --git a/<path> b/<path>" line. The paths are the same, so split it in half.
+		names := strings.TrimPrefix(f.HeaderLines[0], "diff --git ")
+		var name string
+		if strings.HasPrefix(names, `"`) {
+			i := strings.Index(names, `" `)
+			if i < 0 {
+				return fmt.Errorf("invalid file header line %q", f.HeaderLines[0])
+			}
+			name, err = parseDiffPath(names[:i+1], "a/")
+		} else if len(names)%2 == 1 {
+			name, err = parseDiffPath(names[:len(names)/2], "a/")
+		} else {
+			err = fmt.Errorf("unable to determine the path")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid file header line %q: %v", f.HeaderLines[0], err)
+		}
+		if !oldFound {
+			oldPath = name
+		}
+		if !newFound {
+			newPath = name
+		}
+	}
+	f.OldPath, f.NewPath = oldPath, newPath
+	return nil
+}
+
+// parseDiffPath parses a path in a file header, which may be quoted, and removes prefix. Returns
+// empty string for "/dev/null".
+func parseDiffPath(s, prefix string) (string, error) {
+	if s == "/dev/null" {
+		return "", nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return "", err
+		}
+	}
+	if prefix != "" {
+		var ok bool
+		if s, ok = stringutil.CutPrefix(s, prefix); !ok {
+			return "", fmt.Errorf("path doesn't start with %q", prefix)
+		}
+	}
+	return s, nil
+}
+
+// header returns the hunk header line, like "@@ -1,2 +1,3 @@ func f() {".
+func (h *Hunk) header() string {
+	return fmt.Sprintf(
+		"@@ -%v +%v @@%v",
+		formatHunkRange(h.OldStart, h.OldLines, h.oldLinesExplicit),
+		formatHunkRange(h.NewStart, h.NewLines, h.newLinesExplicit),
+		h.Section)
+}
+
+// parseHunkHeader parses a hunk header line like "@@ -1,2 +1,3 @@ func f() {".
+func parseHunkHeader(line string) (*Hunk, error) {
+	var h Hunk
+	rest, ok := stringutil.CutPrefix(line, "@@ -")
+	if !ok {
+		return nil, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	oldRange, rest, ok := strings.Cut(rest, " +")
+	if !ok {
+		return nil, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	newRange, section, ok := strings.Cut(rest, " @@")
+	if !ok {
+		return nil, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	var err error
+	if h.OldStart, h.OldLines, h.oldLinesExplicit, err = parseHunkRange(oldRange); err != nil {
+		return nil, fmt.Errorf("invalid hunk header: %q: %v", line, err)
+	}
+	if h.NewStart, h.NewLines, h.newLinesExplicit, err = parseHunkRange(newRange); err != nil {
+		return nil, fmt.Errorf("invalid hunk header: %q: %v", line, err)
+	}
+	h.Section = section
+	return &h, nil
+}
+
+// parseHunkRange parses a hunk header range like "1,2", without the "-" or "+". If there's no
+// length, it's 1.
+func parseHunkRange(s string) (start, length int, explicit bool, err error) {
+	startString, lengthString, ok := strings.Cut(s, ",")
+	if start, err = strconv.Atoi(startString); err != nil {
+		return 0, 0, false, err
+	}
+	if !ok {
+		return start, 1, false, nil
+	}
+	if length, err = strconv.Atoi(lengthString); err != nil {
+		return 0, 0, false, err
+	}
+	return start, length, length == 1, nil
+}
+
+func formatHunkRange(start, length int, explicit bool) string {
+	if length == 1 && !explicit {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(length)
+}
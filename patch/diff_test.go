@@ -0,0 +1,227 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff_RoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*/*/*.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(path, func(t *testing.T) {
+			p, err := ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := p.Diff()
+			if strings.Contains(filepath.ToSlash(path), "TestApplyCorruptBeforePatch/before/") {
+				// This patch has a hunk with the wrong number of lines.
+				if err == nil {
+					t.Errorf("want error parsing corrupt patch")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.Files) == 0 {
+				t.Errorf("found no files")
+			}
+			if got := d.String(); got != p.Content {
+				t.Errorf("round trip = %q, want %q", got, p.Content)
+			}
+		})
+	}
+}
+
+const testDiff = `---
+ a.go | 3 ++-
+ 2 files changed
+
+diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@ package a
+ package a
+-var x = 1
++var x = 2
+ 
+@@ -10 +10,1 @@
+-// end
++// end.
+\ No newline at end of file
+diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+index 3333333..4444444 100644
+--- a/old.go
++++ b/new.go
+@@ -1 +1 @@
+-package old
++package new
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 5555555..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git "a/with space.txt" "b/with space.txt"
+new file mode 100644
+index 0000000..6666666
+--- /dev/null
++++ "b/with space.txt"
+@@ -0,0 +1 @@
++hi
+diff --git a/image.png b/image.png
+new file mode 100644
+index 0000000000000000000000000000000000000000..7777777777777777777777777777777777777777
+GIT binary patch
+literal 5
+McmZQzWMXCn00031000
+
+literal 0
+HcmV?d00001
+
+-- 
+2.39.0
+
+`
+
+func TestParseDiff(t *testing.T) {
+	d, err := ParseDiff(testDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.String(); got != testDiff {
+		t.Errorf("round trip = %q, want %q", got, testDiff)
+	}
+	if want := "---\n a.go | 3 ++-\n 2 files changed\n\n"; d.Preamble != want {
+		t.Errorf("Preamble = %q, want %q", d.Preamble, want)
+	}
+	if want := "-- \n2.39.0\n\n"; d.Trailer != want {
+		t.Errorf("Trailer = %q, want %q", d.Trailer, want)
+	}
+
+	type file struct {
+		OldPath, NewPath string
+		OldMode, NewMode string
+		Renamed, Binary  bool
+		Hunks            int
+	}
+	var got []file
+	for _, f := range d.Files {
+		got = append(got, file{f.OldPath, f.NewPath, f.OldMode, f.NewMode, f.Renamed, f.Binary, len(f.Hunks)})
+	}
+	want := []file{
+		{"a.go", "a.go", "100644", "100644", false, false, 2},
+		{"old.go", "new.go", "100644", "100644", true, false, 1},
+		{"run.sh", "run.sh", "100644", "100755", false, false, 0},
+		{"gone.txt", "", "100644", "", false, false, 1},
+		{"", "with space.txt", "", "100644", false, false, 1},
+		{"", "image.png", "", "100644", false, true, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %+v, want %+v", got, want)
+	}
+
+	h := d.Files[0].Hunks[1]
+	wantLines := []Line{
+		{LineDeleted, "// end"},
+		{LineAdded, "// end."},
+		{LineNoNewline, " No newline at end of file"},
+	}
+	if !reflect.DeepEqual(h.Lines, wantLines) {
+		t.Errorf("Lines = %+v, want %+v", h.Lines, wantLines)
+	}
+}
+
+func TestParseDiff_Edit(t *testing.T) {
+	d, err := ParseDiff(testDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Files[1].Hunks[0].Lines[1].Text = "package renamed"
+	d.Files[0].Hunks[0].Section = ""
+	d2, err := ParseDiff(d.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d2.Files[1].Hunks[0].Lines[1].Text; got != "package renamed" {
+		t.Errorf("edited line = %q", got)
+	}
+	if got := d2.Files[0].Hunks[0].Section; got != "" {
+		t.Errorf("edited section = %q", got)
+	}
+}
+
+func TestParseDiff_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"short hunk", "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1,2 +1,2 @@\n-x\n+y\n"},
+		{"long hunk", "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n-x\n-y\n+z\n"},
+		{"empty line", "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1,2 +1,2 @@\n\n-x\n+y\n"},
+		{"bad line", "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n*x\n+y\n"},
+		{"bad hunk header", "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 @@\n-x\n"},
+		{"bad path", "diff --git a/a b/a\n--- a\n+++ b/a\n@@ -1 +1 @@\n-x\n+y\n"},
+		{"no final newline", "diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n-x\n+y"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if d, err := ParseDiff(tt.content); err == nil {
+				t.Errorf("ParseDiff() = %+v, want error", d)
+			}
+		})
+	}
+}
+
+func Test_parseHunkHeader(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Hunk
+		wantErr bool
+	}{
+		{"@@ -11,7 +11,7 @@ func Subtract(x, y int) int {", Hunk{OldStart: 11, OldLines: 7, NewStart: 11, NewLines: 7, Section: " func Subtract(x, y int) int {"}, false},
+		{"@@ -12,4 +12 @@", Hunk{OldStart: 12, OldLines: 4, NewStart: 12, NewLines: 1}, false},
+		{"@@ -0,0 +1,3 @@", Hunk{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 3}, false},
+		{"@@ -3,1 +3 @@", Hunk{OldStart: 3, OldLines: 1, NewStart: 3, NewLines: 1, oldLinesExplicit: true}, false},
+		{"@@ -1,2 @@", Hunk{}, true},
+		{"@@ 1,2 +1,2 @@", Hunk{}, true},
+		{"@@ -1,x +1,2 @@", Hunk{}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseHunkHeader(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHunkHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parseHunkHeader() = %+v, want %+v", *got, tt.want)
+			}
+			if h := got.header(); h != tt.line {
+				t.Errorf("header() = %q, want %q", h, tt.line)
+			}
+		})
+	}
+}
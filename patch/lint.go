@@ -0,0 +1,222 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Lint rule names, used in LintIssue.
+const (
+	LintRuleTrailingWhitespace = "trailing-whitespace"
+	LintRuleSubject            = "subject"
+	LintRuleAuthor             = "author"
+	LintRuleMaxChangedLines    = "max-changed-lines"
+	LintRuleForbiddenPath      = "forbidden-path"
+	LintRuleDuplicateHunk      = "duplicate-hunk"
+	LintRuleNumbering          = "numbering"
+)
+
+// LintIssue is a problem with a patch file found by Lint.
+type LintIssue struct {
+	// Path is the path of the patch file, before any rename by Lint.
+	Path    string
+	Rule    string
+	Message string
+	// Fixed is true if Lint fixed the issue.
+	Fixed bool
+}
+
+func (i *LintIssue) String() string {
+	s := fmt.Sprintf("%v: [%v] %v", filepath.Base(i.Path), i.Rule, i.Message)
+	if i.Fixed {
+		s += " (fixed)"
+	}
+	return s
+}
+
+// Lint checks the patch files in config's patches dir using config's lint rules, and returns the
+// issues it finds. If fix is true, also fixes the fixable issues by rewriting and renaming patch
+// files, and marks them as Fixed.
+//
+// Fixing trailing whitespace changes the lines the patch adds, so a later patch that uses one of
+// those lines as context no longer applies until it is fixed up, too.
+func Lint(config *FoundConfig, fix bool) ([]LintIssue, error) {
+	rules := DefaultLintConfig
+	if config.Lint != nil {
+		rules = *config.Lint
+	}
+	var subjectRegexp *regexp.Regexp
+	if rules.SubjectPattern != "" {
+		var err error
+		if subjectRegexp, err = regexp.Compile(rules.SubjectPattern); err != nil {
+			return nil, fmt.Errorf("invalid Lint.SubjectPattern: %v", err)
+		}
+	}
+	if rules.RequireExtractAsAuthor && config.ExtractAsAuthor == "" {
+		return nil, errors.New("Lint.RequireExtractAsAuthor is set, but ExtractAsAuthor is not")
+	}
+	for _, pattern := range rules.ForbiddenPaths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid Lint.ForbiddenPaths pattern %q: %v", pattern, err)
+		}
+	}
+
+	var issues []LintIssue
+	// hunks maps each hunk's file path and content to the name of the first patch file with it.
+	hunks := make(map[string]string)
+	// renames maps patch file paths to their new paths.
+	renames := make(map[string]string)
+	// Start numbering patches at 1 (0001), like "git-go-patch extract".
+	n := 1
+
+	err := WalkGoPatches(config, func(patchPath string) error {
+		p, err := ReadFile(patchPath)
+		if err != nil {
+			return err
+		}
+		d, err := p.Diff()
+		if err != nil {
+			return fmt.Errorf("failed to parse %#q: %v", patchPath, err)
+		}
+		name := filepath.Base(patchPath)
+		changed := false
+		report := func(rule string, fixable bool, format string, args ...interface{}) {
+			issues = append(issues, LintIssue{
+				Path:    patchPath,
+				Rule:    rule,
+				Message: fmt.Sprintf(format, args...),
+				Fixed:   fix && fixable,
+			})
+		}
+
+		if rules.Numbering {
+			num, err := p.Number(n)
+			if err != nil {
+				report(LintRuleNumbering, false, "%v", err)
+				num = n
+			}
+			// Keep the part after the number (0001-Add-good-code.patch), like "extract".
+			_, after, found := strings.Cut(name, "-")
+			if !found {
+				after = name
+			}
+			if want := fmt.Sprintf("%04d-%v", num, after); name != want {
+				report(LintRuleNumbering, true, "file name should be %v", want)
+				renames[patchPath] = filepath.Join(filepath.Dir(patchPath), want)
+			}
+			n = num + 1
+		}
+
+		if rules.RequireExtractAsAuthor && p.FromAuthor != config.ExtractAsAuthor {
+			report(LintRuleAuthor, true, "author is %q, not ExtractAsAuthor %q", p.FromAuthor, config.ExtractAsAuthor)
+			p.FromAuthor = config.ExtractAsAuthor
+			changed = true
+		}
+
+		if subjectRegexp != nil {
+			subject := p.SubjectLine()
+			if !subjectRegexp.MatchString(subject) {
+				report(LintRuleSubject, false, "subject %q doesn't match %q", subject, rules.SubjectPattern)
+			}
+		}
+
+		changedLines := 0
+		for _, f := range d.Files {
+			for _, pattern := range rules.ForbiddenPaths {
+				for _, filePath := range []string{f.OldPath, f.NewPath} {
+					if filePath != "" && matchPathOrDir(pattern, filePath) {
+						report(LintRuleForbiddenPath, false, "changes %v, which matches forbidden path %q", filePath, pattern)
+						break
+					}
+				}
+			}
+			whitespaceLines := 0
+			for _, h := range f.Hunks {
+				for i := range h.Lines {
+					l := &h.Lines[i]
+					if l.Op == LineAdded || l.Op == LineDeleted {
+						changedLines++
+					}
+					if rules.TrailingWhitespace && l.Op == LineAdded {
+						if trimmed := strings.TrimRight(l.Text, " \t"); trimmed != l.Text {
+							whitespaceLines++
+							l.Text = trimmed
+							changed = true
+						}
+					}
+				}
+				if rules.DuplicateHunks {
+					key := f.Path() + "\x00" + hunkChange(h)
+					if first, ok := hunks[key]; ok {
+						report(LintRuleDuplicateHunk, false, "hunk %q in %v makes the same change as a hunk in %v", h.header(), f.Path(), first)
+					} else {
+						hunks[key] = name
+					}
+				}
+			}
+			if whitespaceLines > 0 {
+				report(LintRuleTrailingWhitespace, true, "%v added line(s) in %v end in whitespace", whitespaceLines, f.Path())
+			}
+		}
+		if rules.MaxChangedLines > 0 && changedLines > rules.MaxChangedLines {
+			report(LintRuleMaxChangedLines, false, "changes %v lines, more than the maximum %v", changedLines, rules.MaxChangedLines)
+		}
+
+		if fix && changed {
+			p.Content = d.String()
+			if err := os.WriteFile(patchPath, []byte(p.String()), 0o666); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fix && len(renames) > 0 {
+		// Rename in two steps, in case a new name is the old name of another patch file. The temp
+		// name doesn't end in ".patch", so if something goes wrong, it won't be applied.
+		for oldPath := range renames {
+			if err := os.Rename(oldPath, oldPath+".lint-rename"); err != nil {
+				return nil, err
+			}
+		}
+		for oldPath, newPath := range renames {
+			if err := os.Rename(oldPath+".lint-rename", newPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return issues, nil
+}
+
+// matchPathOrDir reports whether the slash-separated file path or any of its parent dirs match
+// pattern. The pattern must be valid.
+func matchPathOrDir(pattern, file string) bool {
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hunkChange returns the content of h, without the line numbers in the hunk header.
+func hunkChange(h *Hunk) string {
+	var b strings.Builder
+	for _, l := range h.Lines {
+		b.WriteByte(byte(l.Op))
+		b.WriteString(l.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
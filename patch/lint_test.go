@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint_Clean(t *testing.T) {
+	config := lintTestProject(t, nil, nil)
+	if err := WalkPatches(filepath.Join("testdata", "TestApplyMiddleConflict", "before"), func(path string) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(config.RootDir, config.PatchesDir, filepath.Base(path)), content, 0o666)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := Lint(config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Lint() = %v, want no issues", issues)
+	}
+}
+
+func TestLint(t *testing.T) {
+	const bot = "bot <bot@example.org>"
+	lintConfig := &LintConfig{
+		TrailingWhitespace:     true,
+		SubjectPattern:         `^[a-z0-9/._,-]+: `,
+		RequireExtractAsAuthor: true,
+		MaxChangedLines:        3,
+		ForbiddenPaths:         []string{"vendor"},
+		DuplicateHunks:         true,
+		Numbering:              true,
+	}
+	patches := map[string]string{
+		"0001-clean.patch": lintTestPatch(bot, "math: clean", "", "a.go", "+x"),
+		// Fixable: should be 0002, has an added line with trailing whitespace, and isn't by bot.
+		"0003-fixable.patch": lintTestPatch("dev <dev@example.org>", "math: fixable", "", "b.go", "+y \t"),
+		// Duplicates the first patch's hunk, changes a forbidden path, and is too big.
+		"0003-unfixable.patch": lintTestPatch(bot, "Unfixable", "", "a.go", "+x") +
+			lintTestPatch(bot, "", "", "vendor/c/c.go", "+a\n+b\n+c"),
+		// Uses a patch number command to skip ahead.
+		"0010-skip.patch": lintTestPatch(bot, "math: skip", CommandPrefix+PatchNumberCommand+"10", "d.go", "+z"),
+	}
+	config := lintTestProject(t, lintConfig, patches)
+	config.ExtractAsAuthor = bot
+
+	issues, err := Lint(config, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, i := range issues {
+		got = append(got, fmt.Sprintf("%v %v %v", filepath.Base(i.Path), i.Rule, i.Fixed))
+	}
+	want := []string{
+		"0003-fixable.patch numbering true",
+		"0003-fixable.patch author true",
+		"0003-fixable.patch trailing-whitespace true",
+		"0003-unfixable.patch subject false",
+		"0003-unfixable.patch duplicate-hunk false",
+		"0003-unfixable.patch forbidden-path false",
+		"0003-unfixable.patch max-changed-lines false",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() = %#v, want %#v", got, want)
+	}
+
+	// Check that the fixes worked.
+	issues, err = Lint(config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, i := range issues {
+		got = append(got, fmt.Sprintf("%v %v %v", filepath.Base(i.Path), i.Rule, i.Fixed))
+	}
+	want = []string{
+		"0003-unfixable.patch subject false",
+		"0003-unfixable.patch duplicate-hunk false",
+		"0003-unfixable.patch forbidden-path false",
+		"0003-unfixable.patch max-changed-lines false",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() after fix = %#v, want %#v", got, want)
+	}
+	p, err := ReadFile(filepath.Join(config.RootDir, config.PatchesDir, "0002-fixable.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := lintTestPatch(bot, "math: fixable", "", "b.go", "+y"); p.String() != want {
+		t.Errorf("fixed patch = %q, want %q", p.String(), want)
+	}
+}
+
+func TestLint_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config LintConfig
+	}{
+		{"subject pattern", LintConfig{SubjectPattern: "("}},
+		{"forbidden path", LintConfig{ForbiddenPaths: []string{"["}}},
+		{"no author", LintConfig{RequireExtractAsAuthor: true}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Lint(lintTestProject(t, &tt.config, nil), false); err == nil {
+				t.Error("Lint() succeeded, want error")
+			}
+		})
+	}
+}
+
+func Test_matchPathOrDir(t *testing.T) {
+	tests := []struct {
+		pattern, file string
+		want          bool
+	}{
+		{"src/vendor", "src/vendor/x/y.go", true},
+		{"src/*/testdata", "src/a/testdata/b.txt", true},
+		{"*.pem", "key.pem", true},
+		{"*.pem", "src/key.pem", false},
+		{"src/vendor", "src/vendored.go", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			if got := matchPathOrDir(tt.pattern, tt.file); got != tt.want {
+				t.Errorf("matchPathOrDir() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// lintTestProject creates a temp project dir with the given lint config and patch files.
+func lintTestProject(t *testing.T, lintConfig *LintConfig, patches map[string]string) *FoundConfig {
+	config := &FoundConfig{Config: conventionalConfig, RootDir: t.TempDir()}
+	config.Lint = lintConfig
+	dir := filepath.Join(config.RootDir, config.PatchesDir)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range patches {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return config
+}
+
+// lintTestPatch returns a patch file that adds lines to a new file. If subject is empty, returns
+// only the diff, to append to another patch.
+func lintTestPatch(author, subject, body, file, lines string) string {
+	var s string
+	if subject != "" {
+		s = "From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001\n" +
+			"From: " + author + "\n" +
+			"Date: Thu, 27 Oct 2022 10:22:03 -0700\n" +
+			"Subject: [PATCH] " + subject + "\n\n"
+		if body != "" {
+			s += body + "\n"
+		}
+		s += "---\n"
+	}
+	n := strings.Count(lines, "\n") + 1
+	return s + "diff --git a/" + file + " b/" + file + "\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/" + file + "\n" +
+		fmt.Sprintf("@@ -0,0 +1,%v @@\n", n) +
+		lines + "\n"
+}
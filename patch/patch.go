@@ -15,9 +15,11 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/microsoft/go-infra/executil"
+	"github.com/microsoft/go-infra/stringutil"
 )
 
 type ApplyMode int
@@ -112,6 +114,13 @@ type Header struct {
 	Subject       string
 }
 
+// SubjectLine returns the first line of the subject, without the "[PATCH] " prefix added by
+// "git format-patch".
+func (h *Header) SubjectLine() string {
+	line, _, _ := strings.Cut(strings.TrimSpace(h.Subject), "\n")
+	return strings.TrimPrefix(line, "[PATCH] ")
+}
+
 // Patch is a parsed Git patch file.
 type Patch struct {
 	Header
@@ -189,6 +198,46 @@ func (h *Patch) String() string {
 	return s.String()
 }
 
+// CommandPrefix starts a line in a patch's commit message that contains a command for
+// "git-go-patch extract".
+const CommandPrefix = "github.com/microsoft/go-infra/cmd/git-go-patch command: "
+
+// PatchNumberCommand is the command that sets the number of a patch, followed by the number.
+const PatchNumberCommand = "patch number "
+
+// Commands returns all potential commands in the patch's commit message, with CommandPrefix
+// trimmed off.
+func (h *Patch) Commands() []string {
+	var cmds []string
+	for _, line := range strings.Split(h.Subject, "\n") {
+		if after, found := stringutil.CutPrefix(line, CommandPrefix); found {
+			cmds = append(cmds, after)
+		}
+	}
+	return cmds
+}
+
+// Number returns the number of the patch in its filename, given n, the number it gets if it
+// doesn't have a patch number command. Returns an error if the patch has an unrecognized command or
+// a patch number command with a number less than n.
+func (h *Patch) Number(n int) (int, error) {
+	for _, cmd := range h.Commands() {
+		after, found := stringutil.CutPrefix(cmd, PatchNumberCommand)
+		if !found {
+			return 0, fmt.Errorf("command %#q is not recognized", cmd)
+		}
+		num, err := strconv.Atoi(after)
+		if err != nil {
+			return 0, fmt.Errorf("malformed patch number command arg %q: %w", after, err)
+		}
+		if num < n {
+			return 0, fmt.Errorf("patch number command arg %v too small, expected at least %v", num, n)
+		}
+		n = num
+	}
+	return n, nil
+}
+
 // FindAncestorConfig finds and reads the config file governing dir. Searches dir and all ancestor
 // directories of dir, similar to how ".git" files work.
 //
@@ -0,0 +1,313 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitcmd"
+	"github.com/microsoft/go-infra/stringutil"
+)
+
+// UpstreamCommit is an upstream commit that changes lines a patch depends on.
+type UpstreamCommit struct {
+	Commit  string
+	Subject string
+}
+
+// HunkOverlap is a patch hunk that depends on lines changed by upstream commits.
+type HunkOverlap struct {
+	File string
+	// Start and End are the first and last lines in the old commit that the hunk depends on,
+	// including its context lines. Both are 0 if the hunk creates File.
+	Start, End int
+	Commits    []UpstreamCommit
+}
+
+// PatchOverlap is a patch file with hunks that overlap upstream changes, so the patch may no longer
+// apply.
+type PatchOverlap struct {
+	// Path is the path of the patch file.
+	Path string
+	// Subject is the first line of the patch subject.
+	Subject string
+	Hunks   []HunkOverlap
+}
+
+// PredictConflicts finds the patches in config's patches dir that may conflict when the submodule
+// is updated from oldCommit to newCommit: the patches with hunks that overlap lines changed by the
+// upstream commits in oldCommit..newCommit. Both commits must exist in the submodule. Assumes the
+// patches apply to oldCommit.
+//
+// This is a prediction, not a guarantee. An overlapping change may merge cleanly, for example if
+// upstream made the same change. A patch that doesn't overlap may still conflict, for example if it
+// depends on an earlier patch that conflicts.
+func PredictConflicts(config *FoundConfig, oldCommit, newCommit string) ([]PatchOverlap, error) {
+	var patches []PatchOverlap
+	var tracked []*trackedHunk
+	// applied holds the hunks of the patches read so far, by file path. Each patch's hunk ranges
+	// are in terms of the file after applying the earlier patches, so to find the range in
+	// oldCommit, map them back through the earlier patches.
+	applied := make(map[string][][]*Hunk)
+	files := make(map[string]struct{})
+
+	err := WalkGoPatches(config, func(path string) error {
+		p, err := ReadFile(path)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, PatchOverlap{
+			Path:    path,
+			Subject: p.SubjectLine(),
+		})
+		d, err := p.Diff()
+		if err != nil {
+			return fmt.Errorf("failed to parse %v: %v", path, err)
+		}
+		for _, f := range d.Files {
+			file := oldPath(f)
+			for _, h := range f.Hunks {
+				start, end := h.OldStart, h.OldStart+h.OldLines-1
+				for i := len(applied[file]) - 1; i >= 0; i-- {
+					start, end = mapRange(start, end, applied[file][i], true)
+				}
+				tracked = append(tracked, &trackedHunk{
+					patch:        len(patches) - 1,
+					file:         file,
+					start:        start,
+					end:          end,
+					currentStart: start,
+					currentEnd:   end,
+				})
+			}
+			applied[file] = append(applied[file], f.Hunks)
+			files[file] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	// Use "--no-renames" so a renamed file overlaps every hunk that patches it.
+	args := []string{
+		"log", "--reverse", "--first-parent", "--no-renames", "--patch", "--unified=0",
+		"--format=" + commitLinePrefix + "%H %s",
+		oldCommit + ".." + newCommit,
+		"--",
+	}
+	for f := range files {
+		args = append(args, ":(top,literal)"+f)
+	}
+	sort.Strings(args[len(args)-len(files):])
+	_, submoduleDir := config.FullProjectRoots()
+	out, err := gitcmd.CombinedOutput(submoduleDir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upstream changes: %v", err)
+	}
+	commits, err := parseLogHunks(out)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range commits {
+		for _, f := range c.files {
+			file := oldPath(f)
+			for _, t := range tracked {
+				if t.file != file {
+					continue
+				}
+				if t.overlaps(f.Hunks) {
+					t.commits = append(t.commits, c.UpstreamCommit)
+				}
+				t.currentStart, t.currentEnd = mapRange(t.currentStart, t.currentEnd, f.Hunks, false)
+			}
+		}
+	}
+
+	for _, t := range tracked {
+		if len(t.commits) == 0 {
+			continue
+		}
+		patches[t.patch].Hunks = append(patches[t.patch].Hunks, HunkOverlap{
+			File:    t.file,
+			Start:   t.start,
+			End:     t.end,
+			Commits: t.commits,
+		})
+	}
+	var overlaps []PatchOverlap
+	for _, p := range patches {
+		if len(p.Hunks) > 0 {
+			overlaps = append(overlaps, p)
+		}
+	}
+	return overlaps, nil
+}
+
+// WriteConflictMarkdown writes a Markdown description of the overlaps found by PredictConflicts
+// for the update from oldCommit to newCommit.
+func WriteConflictMarkdown(w io.Writer, oldCommit, newCommit string, overlaps []PatchOverlap) error {
+	var b strings.Builder
+	if len(overlaps) == 0 {
+		fmt.Fprintf(&b, "No patches overlap upstream changes in `%v..%v`.\n", oldCommit, newCommit)
+	} else {
+		fmt.Fprintf(&b, "%v patch(es) overlap upstream changes in `%v..%v` and may conflict:\n\n", len(overlaps), oldCommit, newCommit)
+	}
+	for _, o := range overlaps {
+		fmt.Fprintf(&b, "* `%v`: %v\n", filepath.Base(o.Path), o.Subject)
+		for _, h := range o.Hunks {
+			if h.Start == 0 {
+				fmt.Fprintf(&b, "  * `%v` (new file)\n", h.File)
+			} else {
+				fmt.Fprintf(&b, "  * `%v` lines %v-%v\n", h.File, h.Start, h.End)
+			}
+			for _, c := range h.Commits {
+				fmt.Fprintf(&b, "    * %v %v\n", c.Commit, c.Subject)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// trackedHunk is a patch hunk, and the upstream commits found so far that overlap it.
+type trackedHunk struct {
+	// patch is the index of the patch that contains the hunk.
+	patch int
+	file  string
+	// start and end are the range of lines in the old commit that the hunk depends on.
+	start, end int
+	// currentStart and currentEnd are start and end, updated by each upstream commit processed so
+	// far.
+	currentStart, currentEnd int
+	commits                  []UpstreamCommit
+}
+
+// overlaps reports whether any of the hunks, in the same coordinates as currentStart and currentEnd,
+// change the lines t depends on.
+func (t *trackedHunk) overlaps(hunks []*Hunk) bool {
+	if t.currentStart == 0 {
+		// The patch creates the file, so any upstream change to it conflicts.
+		return len(hunks) > 0
+	}
+	for _, h := range hunks {
+		if h.OldLines == 0 {
+			// Insertion after OldStart. Only conflicts if it's between two lines of the hunk.
+			if t.currentStart <= h.OldStart && h.OldStart < t.currentEnd {
+				return true
+			}
+		} else if h.OldStart <= t.currentEnd && h.OldStart+h.OldLines-1 >= t.currentStart {
+			return true
+		}
+	}
+	return false
+}
+
+// mapRange maps the line range start..end (inclusive) in the old file through hunks to the
+// corresponding range in the new file. If reverse, maps from the new file to the old file instead.
+// If a range endpoint is in a changed part of the file, it's moved to the edge of the change.
+func mapRange(start, end int, hunks []*Hunk, reverse bool) (int, int) {
+	if start == 0 {
+		return 0, 0
+	}
+	newStart, newEnd := mapLine(start, hunks, reverse, true), mapLine(end, hunks, reverse, false)
+	if newEnd < newStart {
+		newEnd = newStart
+	}
+	return newStart, newEnd
+}
+
+func mapLine(line int, hunks []*Hunk, reverse, isStart bool) int {
+	delta := 0
+	for _, h := range hunks {
+		fromStart, fromLen, toStart, toLen := h.OldStart, h.OldLines, h.NewStart, h.NewLines
+		if reverse {
+			fromStart, fromLen, toStart, toLen = toStart, toLen, fromStart, fromLen
+		}
+		if fromLen == 0 {
+			if line > fromStart {
+				delta += toLen
+			}
+			continue
+		}
+		fromEnd := fromStart + fromLen - 1
+		switch {
+		case line > fromEnd:
+			delta += toLen - fromLen
+		case line >= fromStart:
+			if toLen == 0 {
+				// The lines were removed. Map to the line after or before the removal.
+				if isStart {
+					return toStart + 1
+				}
+				return toStart
+			}
+			if isStart {
+				return toStart
+			}
+			return toStart + toLen - 1
+		}
+	}
+	return line + delta
+}
+
+// commitLinePrefix is the "git log" format placeholder that starts each commit's line in the output
+// parsed by parseLogHunks: a NUL character, which can't appear in a diff line.
+const commitLinePrefix = "%x00"
+
+// logCommitHunks is an upstream commit and its diff.
+type logCommitHunks struct {
+	UpstreamCommit
+	files []*FileDiff
+}
+
+// parseLogHunks parses the output of "git log --patch" with commitLinePrefix format.
+func parseLogHunks(out string) ([]logCommitHunks, error) {
+	var commits []logCommitHunks
+	var diff strings.Builder
+	flush := func() error {
+		if len(commits) == 0 {
+			return nil
+		}
+		d, err := ParseDiff(diff.String())
+		if err != nil {
+			return fmt.Errorf("failed to parse diff of %v: %v", commits[len(commits)-1].Commit, err)
+		}
+		commits[len(commits)-1].files = d.Files
+		diff.Reset()
+		return nil
+	}
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if rest, ok := stringutil.CutPrefix(line, "\x00"); ok {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			commit, subject, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			commits = append(commits, logCommitHunks{UpstreamCommit: UpstreamCommit{commit, subject}})
+			continue
+		}
+		diff.WriteString(line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// oldPath returns the path of the file before the change, or after the change if it's new. This is
+// the path a patch hunk's OldStart refers to.
+func oldPath(f *FileDiff) string {
+	if f.OldPath != "" {
+		return f.OldPath
+	}
+	return f.NewPath
+}
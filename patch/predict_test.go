@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/microsoft/go-infra/gitcmd"
+)
+
+func TestPredictConflicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		patchesDir string
+		old, new   string
+		// want is the subjects of the upstream commits that overlap each patch, by patch file name.
+		want map[string][]string
+	}{
+		{
+			"middle conflict", "TestApplyMiddleConflict/before", "v1.0.0", "v1.0.2",
+			map[string][]string{"0002-Change-the-bug.patch": {"Fix 42 bug", "Fix operator bug"}},
+		},
+		{
+			"partial range", "TestApplyMiddleConflict/before", "v1.0.0", "v1.0.1",
+			map[string][]string{"0002-Change-the-bug.patch": {"Fix 42 bug"}},
+		},
+		{"no changes", "TestApplyMiddleConflict/after", "v1.0.2", "v1.0.2", map[string][]string{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			config := tempMoremathProject(t, filepath.Join("testdata", tt.patchesDir))
+			overlaps, err := PredictConflicts(config, tt.old, tt.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][]string)
+			for _, o := range overlaps {
+				for _, h := range o.Hunks {
+					for _, c := range h.Commits {
+						got[filepath.Base(o.Path)] = append(got[filepath.Base(o.Path)], c.Subject)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictConflicts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mapRange(t *testing.T) {
+	// Replace lines 3-4 with 3 lines, and insert 2 lines after line 10.
+	hunks := []*Hunk{
+		{OldStart: 3, OldLines: 2, NewStart: 3, NewLines: 3},
+		{OldStart: 10, OldLines: 0, NewStart: 12, NewLines: 2},
+	}
+	tests := []struct {
+		name               string
+		start, end         int
+		reverse            bool
+		wantStart, wantEnd int
+	}{
+		{"before", 1, 2, false, 1, 2},
+		{"between", 5, 9, false, 6, 10},
+		{"after", 11, 12, false, 14, 15},
+		{"around insertion", 9, 11, false, 10, 14},
+		{"inside replacement", 4, 6, false, 3, 7},
+		{"reverse inside insertion", 12, 13, true, 11, 11},
+		{"reverse after", 14, 15, true, 11, 12},
+		{"new file", 0, 0, false, 0, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := mapRange(tt.start, tt.end, hunks, tt.reverse)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("mapRange() = %v, %v, want %v, %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// tempMoremathProject creates a temp project dir with a clone of moremath as the submodule and a
+// copy of the patches in patchesDir.
+func tempMoremathProject(t *testing.T, patchesDir string) *FoundConfig {
+	root := t.TempDir()
+	config := &FoundConfig{Config: conventionalConfig, RootDir: root}
+	_, submoduleDir := config.FullProjectRoots()
+	pack, err := filepath.Abs(filepath.Join("testdata", "moremath.pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gitcmd.Run(root, "clone", "-q", pack, submoduleDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, config.PatchesDir), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := WalkPatches(patchesDir, func(path string) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(root, config.PatchesDir, filepath.Base(path)), content, 0o666)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
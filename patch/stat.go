@@ -0,0 +1,127 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PatchStat summarizes the changes made by one patch file.
+type PatchStat struct {
+	// Path is the path of the patch file.
+	Path string
+	// Subject is the first line of the patch subject.
+	Subject string
+	// Files is the number of files the patch changes.
+	Files                 int
+	Insertions, Deletions int
+	// Packages are the top-level packages the patch changes, sorted. See StatPackage.
+	Packages []string
+}
+
+// PackageStat summarizes the changes made to one top-level package by a stack of patch files.
+type PackageStat struct {
+	Package string
+	// Patches is the number of patches that change the package.
+	Patches int
+	// Files is the number of distinct files in the package the patches change.
+	Files                 int
+	Insertions, Deletions int
+}
+
+// Stat summarizes the changes made by a stack of patch files.
+type Stat struct {
+	Patches []PatchStat
+	// Packages are the totals for each package changed by the patches, sorted by package.
+	Packages []PackageStat
+}
+
+// Stats summarizes the changes made by each patch file in dir.
+func Stats(dir string) (*Stat, error) {
+	var s Stat
+	packages := make(map[string]*PackageStat)
+	packageFiles := make(map[string]map[string]struct{})
+
+	err := WalkPatches(dir, func(path string) error {
+		p, err := ReadFile(path)
+		if err != nil {
+			return err
+		}
+		d, err := p.Diff()
+		if err != nil {
+			return fmt.Errorf("failed to parse %#q: %v", path, err)
+		}
+		ps := PatchStat{
+			Path:    path,
+			Subject: p.SubjectLine(),
+			Files:   len(d.Files),
+		}
+		// Only count each package once per patch.
+		patchPackages := make(map[string]struct{})
+		for _, f := range d.Files {
+			pkg := StatPackage(f.Path())
+			total := packages[pkg]
+			if total == nil {
+				total = &PackageStat{Package: pkg}
+				packages[pkg] = total
+				packageFiles[pkg] = make(map[string]struct{})
+			}
+			if _, ok := patchPackages[pkg]; !ok {
+				patchPackages[pkg] = struct{}{}
+				ps.Packages = append(ps.Packages, pkg)
+				total.Patches++
+			}
+			packageFiles[pkg][f.Path()] = struct{}{}
+
+			for _, h := range f.Hunks {
+				for _, l := range h.Lines {
+					switch l.Op {
+					case LineAdded:
+						ps.Insertions++
+						total.Insertions++
+					case LineDeleted:
+						ps.Deletions++
+						total.Deletions++
+					}
+				}
+			}
+		}
+		sort.Strings(ps.Packages)
+		s.Patches = append(s.Patches, ps)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for pkg, total := range packages {
+		total.Files = len(packageFiles[pkg])
+		s.Packages = append(s.Packages, *total)
+	}
+	sort.Slice(s.Packages, func(i, j int) bool {
+		return s.Packages[i].Package < s.Packages[j].Package
+	})
+	return &s, nil
+}
+
+// StatPackage returns the top-level package of the file at path, relative to the root of the
+// submodule. For a file in the "src" dir, like the Go repository's "src/crypto/tls/conn.go", this is
+// the first dir inside "src", "crypto". For other files, it's the first dir, like "misc". Files
+// directly inside "src" are in "src", and files in the root are in ".".
+func StatPackage(path string) string {
+	path = filepath.ToSlash(path)
+	if rest := strings.TrimPrefix(path, "src/"); rest != path {
+		if pkg, _, ok := strings.Cut(rest, "/"); ok {
+			return pkg
+		}
+		return "src"
+	}
+	if pkg, _, ok := strings.Cut(path, "/"); ok {
+		return pkg
+	}
+	return "."
+}
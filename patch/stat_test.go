@@ -0,0 +1,66 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package patch
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	s, err := Stats(filepath.Join("testdata", "TestApplyAllNew", "after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range s.Patches {
+		s.Patches[i].Path = filepath.Base(s.Patches[i].Path)
+	}
+	want := &Stat{
+		Patches: []PatchStat{
+			{
+				Path:      "0001-Subtract-subtraction.patch",
+				Subject:   "Subtract subtraction",
+				Files:     2,
+				Deletions: 5,
+				Packages:  []string{"."},
+			},
+			{
+				Path:       "0002-Add-3.patch",
+				Subject:    "Add 3",
+				Files:      1,
+				Insertions: 1,
+				Deletions:  1,
+				Packages:   []string{"."},
+			},
+		},
+		Packages: []PackageStat{
+			{Package: ".", Patches: 2, Files: 2, Insertions: 1, Deletions: 6},
+		},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Stats() = %+v, want %+v", s, want)
+	}
+}
+
+func TestStatPackage(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"src/crypto/tls/conn.go", "crypto"},
+		{"src/cmd/go/main.go", "cmd"},
+		{"src/go.mod", "src"},
+		{"misc/cgo/test/a.go", "misc"},
+		{"README.md", "."},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			if got := StatPackage(tt.path); got != tt.want {
+				t.Errorf("StatPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
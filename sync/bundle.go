@@ -0,0 +1,128 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitcmd"
+)
+
+// remoteSet determines where to fetch from and push to for each remote repository URL in a
+// ConfigEntry. By default, it's the URL with auth inserted. The bundle flags replace remotes with
+// local Git bundle files, so sync can run without network access.
+type remoteSet struct {
+	auther gitcmd.URLAuther
+
+	inputBundles    map[string]string
+	inputBundleDir  string
+	outputBundleDir string
+
+	// pushDir contains a bare repository for each remote that receives pushes when outputBundleDir
+	// is set. After each push, the bare repository's refs are written to the output bundle.
+	pushDir string
+}
+
+func (f *Flags) newRemoteSet(auther gitcmd.URLAuther, dir string) *remoteSet {
+	r := &remoteSet{
+		auther:       auther,
+		inputBundles: f.InputBundles,
+		pushDir:      filepath.Join(dir, ".git", "sync-output-bundles"),
+	}
+	if f.InputBundleDir != nil {
+		r.inputBundleDir = *f.InputBundleDir
+	}
+	if f.OutputBundleDir != nil {
+		r.outputBundleDir = *f.OutputBundleDir
+	}
+	return r
+}
+
+// bundleFileName returns the name of the bundle file for the remote repository at repoURL, based on
+// its host and path. For example, "github.com-microsoft-go.bundle" for
+// "https://github.com/microsoft/go".
+func bundleFileName(repoURL string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	if u, err := url.Parse(name); err == nil && u.Host != "" {
+		name = u.Host + u.Path
+	} else if _, after, ok := strings.Cut(name, "@"); ok {
+		// SCP-like syntax: "git@github.com:microsoft/go".
+		name = after
+	}
+	return strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "-"), "-") + ".bundle"
+}
+
+// inputBundle returns the path of the bundle to use instead of the remote repository at repoURL,
+// or empty string if there is none.
+func (r *remoteSet) inputBundle(repoURL string) string {
+	if p, ok := r.inputBundles[repoURL]; ok {
+		return p
+	}
+	if r.inputBundleDir != "" {
+		p := filepath.Join(r.inputBundleDir, bundleFileName(repoURL))
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// fetchURL returns the location to fetch the remote repository at repoURL from.
+func (r *remoteSet) fetchURL(repoURL string) string {
+	if p := r.inputBundle(repoURL); p != "" {
+		return p
+	}
+	return r.auther.InsertAuth(repoURL)
+}
+
+// pushURL returns the location to push to for the remote repository at repoURL. If bundles are
+// being written, it's a local bare repository: call pushed after a successful push to update the
+// bundle.
+func (r *remoteSet) pushURL(out io.Writer, repoURL string) (string, error) {
+	if r.outputBundleDir == "" {
+		return r.auther.InsertAuth(repoURL), nil
+	}
+	p, err := filepath.Abs(filepath.Join(r.pushDir, strings.TrimSuffix(bundleFileName(repoURL), ".bundle")+".git"))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+		if _, err := gitOutput(out, "", "init", "--quiet", "--bare", p); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// pushed writes the refs pushed so far for repoURL to its output bundle, if bundles are being
+// written. Otherwise, does nothing.
+func (r *remoteSet) pushed(out io.Writer, repoURL string) error {
+	if r.outputBundleDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(r.outputBundleDir, os.ModePerm); err != nil {
+		return err
+	}
+	bundle, err := filepath.Abs(filepath.Join(r.outputBundleDir, bundleFileName(repoURL)))
+	if err != nil {
+		return err
+	}
+	src, err := r.pushURL(out, repoURL)
+	if err != nil {
+		return err
+	}
+	if _, err := gitOutput(out, src, "bundle", "create", bundle, "--all"); err != nil {
+		return fmt.Errorf("failed to write bundle for %v: %w", repoURL, err)
+	}
+	fmt.Fprintf(out, "---- Wrote refs for %v to bundle: %v\n", repoURL, bundle)
+	return nil
+}
@@ -0,0 +1,27 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import "testing"
+
+func Test_bundleFileName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://go.googlesource.com/go", "go.googlesource.com-go.bundle"},
+		{"https://github.com/microsoft/go.git", "github.com-microsoft-go.bundle"},
+		{"https://dnceng@dev.azure.com/dnceng/internal/_git/microsoft-go", "dev.azure.com-dnceng-internal-_git-microsoft-go.bundle"},
+		{"git@github.com:microsoft/go", "github.com-microsoft-go.bundle"},
+		{"/tmp/target/microsoft/go/", "tmp-target-microsoft-go.bundle"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			if got := bundleFileName(tt.url); got != tt.want {
+				t.Errorf("bundleFileName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxChangelogLength is the maximum length of the upstream changelog in a PR description. This
+// leaves room for the rest of the description under maxPRBodyLength.
+const maxChangelogLength = 40000
+
+// maxPRBodyLength is the maximum length of a GitHub PR description, in characters.
+const maxPRBodyLength = 65536
+
+// otherChangelogArea is the area of upstream commits that don't follow the Go commit message
+// convention, "{package}: {description}".
+const otherChangelogArea = "Other"
+
+// changelogCommit is an upstream commit listed in a PR description.
+type changelogCommit struct {
+	Hash    string
+	Subject string
+}
+
+// upstreamChangelog lists the commits in revRange in the repository at dir, newest first.
+func upstreamChangelog(out io.Writer, dir, revRange string) ([]changelogCommit, error) {
+	log, err := gitOutput(out, dir, "log", "--format=%H%x1f%s", revRange)
+	if err != nil {
+		return nil, err
+	}
+	var commits []changelogCommit
+	for _, line := range strings.Split(string(log), "\n") {
+		if line == "" {
+			continue
+		}
+		hash, subject, ok := strings.Cut(line, "\x1f")
+		if !ok {
+			return nil, fmt.Errorf("unexpected 'git log' line: %q", line)
+		}
+		commits = append(commits, changelogCommit{Hash: hash, Subject: subject})
+	}
+	return commits, nil
+}
+
+var (
+	// releaseBranchPrefix matches the "[release-branch.go1.21] " prefix of a backport subject.
+	releaseBranchPrefix = regexp.MustCompile(`^\[[^\]]+\] `)
+	// packageListPrefix matches the package list at the start of a Go commit subject, like
+	// "crypto/tls: " or "cmd/go, cmd/link: ".
+	packageListPrefix = regexp.MustCompile(`^([\w.+/-]+(?:, ?[\w.+/-]+)*): `)
+)
+
+// changelogArea returns the area to group the commit subject in. The area is based on the first
+// package in the subject, like "crypto/tls" in "crypto/tls: fix handshake". Packages are grouped by
+// their first path element, like "crypto/...", except under "cmd", where each command is its own
+// area, like "cmd/go/...".
+func changelogArea(subject string) string {
+	subject = releaseBranchPrefix.ReplaceAllString(subject, "")
+	m := packageListPrefix.FindStringSubmatch(subject)
+	if m == nil {
+		return otherChangelogArea
+	}
+	pkg := strings.TrimSpace(strings.Split(m[1], ",")[0])
+	parts := strings.Split(pkg, "/")
+	switch {
+	case parts[0] == "cmd" && len(parts) > 1:
+		return "cmd/" + parts[1] + "/..."
+	case pkg == "all" || (len(parts) == 1 && strings.Contains(pkg, ".")):
+		// "all" is a pseudo-package for broad changes. A single element with a dot is a file
+		// name, like "go.mod".
+		return pkg
+	}
+	return parts[0] + "/..."
+}
+
+// commitURL returns a web URL of the commit in the repository at repoURL, or empty string if the
+// repository isn't on a known host.
+func commitURL(repoURL, hash string) string {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return ""
+	}
+	u.User = nil
+	switch {
+	case u.Host == "github.com":
+		return u.String() + "/commit/" + hash
+	case strings.HasSuffix(u.Host, ".googlesource.com"):
+		return u.String() + "/+/" + hash
+	}
+	return ""
+}
+
+// changelogPRBody returns a section for the PR description listing the upstream commits, grouped by
+// area. Each commit links to the first repository in repoURLs that has a known web UI. The list is
+// truncated to keep the section under maxChangelogLength.
+func changelogPRBody(commits []changelogCommit, repoURLs ...string) string {
+	return changelogPRSection("Upstream changes", commits, repoURLs...)
+}
+
+// changelogPRSection is changelogPRBody with a custom heading. Used when a PR updates more than one
+// upstream repository.
+func changelogPRSection(heading string, commits []changelogCommit, repoURLs ...string) string {
+	if len(commits) == 0 {
+		return ""
+	}
+	var areas []string
+	byArea := make(map[string][]changelogCommit)
+	for _, c := range commits {
+		a := changelogArea(c.Subject)
+		if _, ok := byArea[a]; !ok {
+			areas = append(areas, a)
+		}
+		byArea[a] = append(byArea[a], c)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		// Keep "Other" last: it's the least informative group.
+		if (areas[i] == otherChangelogArea) != (areas[j] == otherChangelogArea) {
+			return areas[j] == otherChangelogArea
+		}
+		return areas[i] < areas[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\n## %v\n\nThis PR brings in %v upstream commit(s):\n", heading, len(commits))
+	omitted := len(commits)
+	for _, a := range areas {
+		section := fmt.Sprintf("\n### `%v`\n\n", a)
+		for _, c := range byArea[a] {
+			hash := "`" + shortHash(c.Hash) + "`"
+			for _, r := range repoURLs {
+				if u := commitURL(r, c.Hash); u != "" {
+					hash = "[" + hash + "](" + u + ")"
+					break
+				}
+			}
+			line := fmt.Sprintf("* %v %v\n", hash, escapeMarkdown(c.Subject))
+			if b.Len()+len(section)+len(line) > maxChangelogLength {
+				fmt.Fprintf(&b, "\n... and %v more commit(s). Use Git to see the full list.\n", omitted)
+				return strings.TrimSuffix(b.String(), "\n")
+			}
+			b.WriteString(section)
+			section = ""
+			b.WriteString(line)
+			omitted--
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+var markdownSpecialChars = strings.NewReplacer(
+	"\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`", "<", "&lt;", ">", "&gt;", "[", "\\[", "]", "\\]",
+)
+
+// escapeMarkdown escapes s so it shows up as plain text in Markdown.
+func escapeMarkdown(s string) string {
+	return markdownSpecialChars.Replace(s)
+}
+
+// truncatePRBody returns body truncated so it fits in a GitHub PR description.
+func truncatePRBody(body string) string {
+	if utf8.RuneCountInString(body) <= maxPRBodyLength {
+		return body
+	}
+	const indicator = "\n\n... (Truncated: the PR description is too long.)"
+	limit := maxPRBodyLength - utf8.RuneCountInString(indicator)
+	var n int
+	for i := range body {
+		if n == limit {
+			return body[:i] + indicator
+		}
+		n++
+	}
+	return body
+}
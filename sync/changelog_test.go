@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_changelogArea(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{"crypto/tls: fix handshake", "crypto/..."},
+		{"crypto: add package doc", "crypto/..."},
+		{"cmd/go: fix module lookup", "cmd/go/..."},
+		{"cmd/compile/internal/ssa: optimize", "cmd/compile/..."},
+		{"cmd/go, cmd/link: update flags", "cmd/go/..."},
+		{"net/http,net/url: reject bad hosts", "net/..."},
+		{"[release-branch.go1.21] runtime: fix crash", "runtime/..."},
+		{"all: fix typos", "all"},
+		{"go.mod: update golang.org/x dependencies", "go.mod"},
+		{"[release-branch.go1.21] go1.21.1", otherChangelogArea},
+		{"Update README", otherChangelogArea},
+		{"Revert \"runtime: fix crash\"", otherChangelogArea},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.subject, func(t *testing.T) {
+			if got := changelogArea(tt.subject); got != tt.want {
+				t.Errorf("changelogArea() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_commitURL(t *testing.T) {
+	hash := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		repo string
+		want string
+	}{
+		{"https://go.googlesource.com/go", "https://go.googlesource.com/go/+/" + hash},
+		{"https://github.com/golang/go", "https://github.com/golang/go/commit/" + hash},
+		{"https://github.com/golang/go.git", "https://github.com/golang/go/commit/" + hash},
+		{"https://user@github.com/golang/go", "https://github.com/golang/go/commit/" + hash},
+		{"git@github.com:golang/go", ""},
+		{"https://dev.azure.com/dnceng/internal/_git/microsoft-go", ""},
+		{"/tmp/upstream", ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.repo, func(t *testing.T) {
+			if got := commitURL(tt.repo, hash); got != tt.want {
+				t.Errorf("commitURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_changelogPRBody(t *testing.T) {
+	commits := []changelogCommit{
+		{"1111111111111111111111111111111111111111", "runtime: fix *crash*"},
+		{"2222222222222222222222222222222222222222", "Update README"},
+		{"3333333333333333333333333333333333333333", "crypto/tls: fix handshake"},
+		{"4444444444444444444444444444444444444444", "crypto: add package doc"},
+	}
+	got := changelogPRBody(commits, "/tmp/upstream", "https://github.com/golang/go")
+	want := "\n\n## Upstream changes\n\nThis PR brings in 4 upstream commit(s):\n" +
+		"\n### `crypto/...`\n\n" +
+		"* [`33333333`](https://github.com/golang/go/commit/3333333333333333333333333333333333333333) crypto/tls: fix handshake\n" +
+		"* [`44444444`](https://github.com/golang/go/commit/4444444444444444444444444444444444444444) crypto: add package doc\n" +
+		"\n### `runtime/...`\n\n" +
+		"* [`11111111`](https://github.com/golang/go/commit/1111111111111111111111111111111111111111) runtime: fix \\*crash\\*\n" +
+		"\n### `Other`\n\n" +
+		"* [`22222222`](https://github.com/golang/go/commit/2222222222222222222222222222222222222222) Update README"
+	if got != want {
+		t.Errorf("changelogPRBody() = %q, want %q", got, want)
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		var many []changelogCommit
+		for i := 0; i < 2000; i++ {
+			many = append(many, changelogCommit{fmt.Sprintf("%040x", i), fmt.Sprintf("runtime: change %v", i)})
+		}
+		got := changelogPRBody(many, "https://go.googlesource.com/go")
+		if len(got) > maxChangelogLength {
+			t.Errorf("len = %v, want at most %v", len(got), maxChangelogLength)
+		}
+		if !strings.Contains(got, " more commit(s). Use Git to see the full list.") {
+			t.Errorf("missing truncation message:\n%v", got[len(got)-200:])
+		}
+	})
+}
+
+func Test_truncatePRBody(t *testing.T) {
+	if got := truncatePRBody("short"); got != "short" {
+		t.Errorf("truncatePRBody() = %q, want unchanged", got)
+	}
+	long := strings.Repeat("🔃", maxPRBodyLength+1)
+	got := truncatePRBody(long)
+	if n := utf8.RuneCountInString(got); n != maxPRBodyLength {
+		t.Errorf("rune count = %v, want %v", n, maxPRBodyLength)
+	}
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "(Truncated: the PR description is too long.)") {
+		t.Errorf("unexpected truncated body suffix: %q", got[len(got)-100:])
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+// StalePR is an open sync PR that doesn't correspond to a branch in any config entry's
+// AutoSyncBranches. This happens when a branch is removed from the config, for example when a
+// release branch goes out of support.
+type StalePR struct {
+	gitpr.OpenPR
+	// Target is the repository the PR was submitted to. Head is the repository that stores the
+	// PR's head branch.
+	Target string
+	Head   string
+}
+
+// cleanupRepos identifies a set of config entries that submit PRs to the same Target from the same
+// head branch storage repository.
+type cleanupRepos struct {
+	Target string
+	Head   string
+}
+
+// CleanupStalePRs finds the open sync PRs in each Target repository in entries that don't
+// correspond to a branch in any entry's AutoSyncBranches. Closes each one with a comment and
+// deletes its head branch, using a new Git repository at dir. In a dry run, only reports them.
+//
+// A PR into a Target branch that an entry's BranchMap still maps an upstream branch to is not
+// stale, even if the upstream branch isn't in AutoSyncBranches: "./cmd/releasego sync" submits
+// sync PRs for any branch in BranchMap.
+//
+// Only the repositories mentioned in entries are checked: if every entry for a Target repository
+// is removed from the config, its PRs aren't found.
+func CleanupStalePRs(f *Flags, dir string, entries []ConfigEntry, out io.Writer) ([]*StalePR, error) {
+	auther, err := f.ParseAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []cleanupRepos
+	groups := make(map[cleanupRepos][]*ConfigEntry)
+	expected := make(map[cleanupRepos]map[gitpr.PRRefSet]bool)
+	for i := range entries {
+		entry := &entries[i]
+		key := cleanupRepos{Target: entry.Target, Head: entry.PRBranchStorageRepo()}
+		if _, ok := groups[key]; !ok {
+			repos = append(repos, key)
+			expected[key] = make(map[gitpr.PRRefSet]bool)
+		}
+		groups[key] = append(groups[key], entry)
+		for _, upstream := range entry.AutoSyncBranches {
+			target, err := entry.TargetBranch(upstream)
+			if err != nil {
+				return nil, err
+			}
+			for _, purpose := range []string{autoSyncPurpose, autoSyncConflictPurpose} {
+				expected[key][gitpr.PRRefSet{Name: target, Purpose: purpose}] = true
+			}
+		}
+	}
+
+	if err := run(out, exec.Command("git", "init", "--quiet", dir)); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var stale []*StalePR
+	for _, key := range repos {
+		entry := groups[key][0]
+		fmt.Fprintf(out, "---- Finding stale sync PRs in %v\n", key.Target)
+		skipReason, err := f.missingForgeAuth(entry)
+		if err != nil {
+			return nil, err
+		}
+		if skipReason != "" {
+			return nil, fmt.Errorf("unable to find PRs in %v: %v", key.Target, skipReason)
+		}
+		forge, err := f.newForge(out, entry)
+		if err != nil {
+			return nil, err
+		}
+		prs, err := forge.ListOpenPRs(ctx, "dev/"+autoSyncPurpose)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list PRs in %v: %w", key.Target, err)
+		}
+
+		headURL := auther.InsertAuth(key.Head)
+		var headRefs map[string]string
+		for _, pr := range prs {
+			refs, ok := parsePRBranch(pr.HeadBranch)
+			if !ok || refs.Name != pr.BaseBranch {
+				// Not a PR branch created by sync.
+				continue
+			}
+			if refs.Purpose != autoSyncPurpose && refs.Purpose != autoSyncConflictPurpose {
+				continue
+			}
+			if expected[key][refs] {
+				continue
+			}
+			mapped, err := anyMapsToTargetBranch(groups[key], pr.BaseBranch)
+			if err != nil {
+				return nil, err
+			}
+			if mapped {
+				fmt.Fprintf(out, "---- Not stale, base branch is in BranchMap: %v (%v -> %v)\n", pr.URL, pr.HeadBranch, pr.BaseBranch)
+				continue
+			}
+			s := &StalePR{OpenPR: *pr, Target: key.Target, Head: key.Head}
+			stale = append(stale, s)
+			fmt.Fprintf(out, "---- Stale PR: %v (%v -> %v)\n", pr.URL, pr.HeadBranch, pr.BaseBranch)
+			if *f.DryRun {
+				fmt.Fprintln(out, "---- Dry run: not closing PR or deleting branch.")
+				continue
+			}
+
+			body := fmt.Sprintf(
+				"Closing this PR: `%v` is no longer configured for automatic sync. Deleting the PR branch, `%v`.",
+				pr.BaseBranch, pr.HeadBranch)
+			if err := forge.CommentPR(ctx, &pr.PR, body); err != nil {
+				return nil, fmt.Errorf("failed to comment on stale PR %v: %w", pr.URL, err)
+			}
+			if err := forge.ClosePR(ctx, &pr.PR); err != nil {
+				return nil, fmt.Errorf("failed to close stale PR %v: %w", pr.URL, err)
+			}
+
+			if headRefs == nil {
+				if headRefs, err = lsRemote(out, dir, headURL); err != nil {
+					return nil, err
+				}
+			}
+			ref := "refs/heads/" + pr.HeadBranch
+			if headRefs[ref] == "" {
+				fmt.Fprintf(out, "---- Branch %v has already been deleted.\n", pr.HeadBranch)
+				continue
+			}
+			if err := run(out, newDirGitCmd(dir, "push", headURL, "--delete", ref)); err != nil {
+				return nil, fmt.Errorf("failed to delete branch of stale PR %v: %w", pr.URL, err)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// anyMapsToTargetBranch reports whether any of entries maps an upstream branch to target.
+func anyMapsToTargetBranch(entries []*ConfigEntry, target string) (bool, error) {
+	for _, entry := range entries {
+		mapped, err := entry.mapsToTargetBranch(target)
+		if err != nil || mapped {
+			return mapped, err
+		}
+	}
+	return false, nil
+}
+
+// parsePRBranch parses a PR branch name created by gitpr.PRRefSet.PRBranch. Returns false if
+// branch doesn't follow the "dev/{Purpose}/{Name}" convention.
+func parsePRBranch(branch string) (gitpr.PRRefSet, bool) {
+	rest := strings.TrimPrefix(branch, "dev/")
+	if rest == branch {
+		return gitpr.PRRefSet{}, false
+	}
+	purpose, name, ok := strings.Cut(rest, "/")
+	if !ok || purpose == "" || name == "" {
+		return gitpr.PRRefSet{}, false
+	}
+	return gitpr.PRRefSet{Name: name, Purpose: purpose}, true
+}
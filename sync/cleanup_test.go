@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"testing"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+func Test_parsePRBranch(t *testing.T) {
+	tests := []struct {
+		branch string
+		want   gitpr.PRRefSet
+		wantOk bool
+	}{
+		{"dev/auto-sync/microsoft/main", gitpr.PRRefSet{Name: "microsoft/main", Purpose: "auto-sync"}, true},
+		{"dev/auto-sync-conflict/main", gitpr.PRRefSet{Name: "main", Purpose: "auto-sync-conflict"}, true},
+		{"dev/auto-sync", gitpr.PRRefSet{}, false},
+		{"dev/auto-sync/", gitpr.PRRefSet{}, false},
+		{"feature/auto-sync/main", gitpr.PRRefSet{}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.branch, func(t *testing.T) {
+			got, ok := parsePRBranch(tt.branch)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parsePRBranch() = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_mapsToTargetBranch(t *testing.T) {
+	entry := &ConfigEntry{
+		BranchMap: map[string]string{
+			"master":             "microsoft/main",
+			"release-branch.go*": "microsoft/?",
+			"dev.*":              "microsoft/?-dev/?",
+		},
+	}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"microsoft/main", true},
+		{"microsoft/release-branch.go1.21", true},
+		{"microsoft/dev.boringcrypto-dev/dev.boringcrypto", true},
+		{"microsoft/dev.boringcrypto-dev/dev.other", false},
+		{"microsoft/nightly", false},
+		{"microsoft/", false},
+		{"main", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := entry.mapsToTargetBranch(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("mapsToTargetBranch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/microsoft/go-infra/azdo"
+	"github.com/microsoft/go-infra/stringutil"
+)
+
+// maxConflictUpstreamCommits is the maximum number of upstream commits to list per conflicting file
+// in a conflict report. A long-lived conflict may be touched by many upstream commits, but the most
+// recent ones are the most likely to be relevant.
+const maxConflictUpstreamCommits = 20
+
+// maxConflictTargetCommits is the number of Target commits to list per conflicting file in a
+// conflict report.
+const maxConflictTargetCommits = 5
+
+// ConflictReport describes a merge from Upstream into a Target branch that has conflicts that sync
+// can't resolve automatically. It is written as JSON and Markdown files by the conflict-report-dir
+// flag.
+type ConflictReport struct {
+	Upstream       string
+	Target         string
+	UpstreamBranch string
+	TargetBranch   string
+
+	// UpstreamCommit is the upstream commit being merged. TargetCommit is the Target commit it is
+	// being merged into. MergeBase is their merge base: the upstream commit of the last sync.
+	UpstreamCommit string
+	TargetCommit   string
+	MergeBase      string
+
+	Files []ConflictFile
+
+	// ReproCommands are Git commands that reproduce the conflict in a local clone.
+	ReproCommands []string
+}
+
+// ConflictFile is a file with a merge conflict.
+type ConflictFile struct {
+	Path string
+	// UpstreamCommits are the upstream commits that touched the file since MergeBase, newest first.
+	// At most maxConflictUpstreamCommits are included. UpstreamCommitsTruncated is true if more
+	// exist.
+	UpstreamCommits          []ConflictCommit
+	UpstreamCommitsTruncated bool
+	// TargetCommits are the most recent Target commits that touched the file, newest first.
+	TargetCommits []ConflictCommit
+}
+
+// ConflictCommit is a commit that touched a conflicting file.
+type ConflictCommit struct {
+	Hash    string
+	Author  string
+	Date    string
+	Subject string
+}
+
+// newConflictReport creates a report of the unmerged files in the repository at dir. The repository
+// must be in the middle of a merge of upstreamCommit.
+func newConflictReport(out io.Writer, dir string, entry *ConfigEntry, b *SyncResult, files []*unmergedFile) (*ConflictReport, error) {
+	git := func(args ...string) (string, error) {
+		o, err := gitOutput(out, dir, args...)
+		return strings.TrimSpace(string(o)), err
+	}
+	targetCommit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	mergeBase, err := git("merge-base", "HEAD", b.UpstreamCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ConflictReport{
+		Upstream:       entry.Upstream,
+		Target:         entry.Target,
+		UpstreamBranch: b.UpstreamBranch,
+		TargetBranch:   b.TargetBranch,
+		UpstreamCommit: b.UpstreamCommit,
+		TargetCommit:   targetCommit,
+		MergeBase:      mergeBase,
+		ReproCommands: []string{
+			fmt.Sprintf("git fetch %v %v", entry.Target, b.TargetBranch),
+			fmt.Sprintf("git checkout --detach %v", targetCommit),
+			fmt.Sprintf("git fetch %v %v", entry.Upstream, b.UpstreamBranch),
+			fmt.Sprintf("git merge --no-ff %v", b.UpstreamCommit),
+		},
+	}
+	for _, f := range files {
+		cf := ConflictFile{Path: f.Path}
+		cf.UpstreamCommits, err = logCommits(git, maxConflictUpstreamCommits+1, mergeBase+".."+b.UpstreamCommit, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(cf.UpstreamCommits) > maxConflictUpstreamCommits {
+			cf.UpstreamCommits = cf.UpstreamCommits[:maxConflictUpstreamCommits]
+			cf.UpstreamCommitsTruncated = true
+		}
+		cf.TargetCommits, err = logCommits(git, maxConflictTargetCommits, targetCommit, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		r.Files = append(r.Files, cf)
+	}
+	return r, nil
+}
+
+func logCommits(git func(args ...string) (string, error), n int, revRange, path string) ([]ConflictCommit, error) {
+	// Use the unit separator control character between fields: it won't show up in a commit.
+	log, err := git("log", "-n", fmt.Sprint(n), "--format=%H%x1f%an%x1f%aI%x1f%s", revRange, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	var commits []ConflictCommit
+	for _, line := range strings.Split(log, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected 'git log' line: %q", line)
+		}
+		commits = append(commits, ConflictCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+		})
+	}
+	return commits, nil
+}
+
+// Markdown returns the report formatted as Markdown.
+func (r *ConflictReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Sync merge conflict: `%v` into `%v`\n\n", r.UpstreamBranch, r.TargetBranch)
+	fmt.Fprintf(&b, "Merging upstream %v `%v` at `%v` into %v `%v` at `%v` has conflicts that sync can't resolve automatically. ", r.Upstream, r.UpstreamBranch, shortHash(r.UpstreamCommit), r.Target, r.TargetBranch, shortHash(r.TargetCommit))
+	fmt.Fprintf(&b, "The merge base (the upstream commit of the last sync) is `%v`.\n\n", shortHash(r.MergeBase))
+
+	b.WriteString("## Conflicting files\n")
+	for _, f := range r.Files {
+		fmt.Fprintf(&b, "\n### `%v`\n\n", f.Path)
+		b.WriteString("Upstream commits touching this file since the last sync:\n\n")
+		writeMarkdownCommits(&b, f.UpstreamCommits)
+		if f.UpstreamCommitsTruncated {
+			fmt.Fprintf(&b, "* ... (more than %v commits)\n", maxConflictUpstreamCommits)
+		}
+		b.WriteString("\nMost recent Target commits touching this file:\n\n")
+		writeMarkdownCommits(&b, f.TargetCommits)
+	}
+
+	b.WriteString("\n## Reproduce locally\n\nIn a clone of the Target repository, run:\n\n```\n")
+	for _, c := range r.ReproCommands {
+		b.WriteString(c)
+		b.WriteString("\n")
+	}
+	b.WriteString("```\n")
+	return b.String()
+}
+
+func writeMarkdownCommits(b *strings.Builder, commits []ConflictCommit) {
+	if len(commits) == 0 {
+		b.WriteString("* None found.\n")
+		return
+	}
+	for _, c := range commits {
+		fmt.Fprintf(b, "* `%v` %v (%v, %v)\n", shortHash(c.Hash), c.Subject, c.Author, c.Date)
+	}
+}
+
+func shortHash(h string) string {
+	if len(h) > 8 {
+		return h[:8]
+	}
+	return h
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// targetFileName returns a file name for the target repository and branch, starting with prefix.
+// The name doesn't include an extension.
+func targetFileName(prefix, target, branch string) string {
+	// Use the last two parts of the Target URL, which is "{owner}/{repo}" for typical URLs.
+	targetParts := strings.Split(strings.TrimSuffix(strings.TrimSuffix(target, "/"), ".git"), "/")
+	if len(targetParts) > 2 {
+		targetParts = targetParts[len(targetParts)-2:]
+	}
+	return prefix + unsafeFilenameChars.ReplaceAllString(strings.Join(targetParts, "-")+"-"+branch, "-")
+}
+
+// Write writes the report into dir as Markdown and JSON files with a name based on the Target
+// repository and branch, and returns the path of the Markdown file.
+func (r *ConflictReport) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	name := targetFileName("sync-conflict-", r.Target, r.TargetBranch)
+
+	mdPath, err := filepath.Abs(filepath.Join(dir, name+".md"))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(mdPath, []byte(r.Markdown()), 0o666); err != nil {
+		return "", err
+	}
+	if err := stringutil.WriteJSONFile(filepath.Join(dir, name+".json"), r); err != nil {
+		return "", err
+	}
+	return mdPath, nil
+}
+
+// reportConflicts logs a conflict report for the unmerged files, and writes it to the
+// conflict-report-dir flag's directory if specified.
+func (f *Flags) reportConflicts(out io.Writer, dir string, entry *ConfigEntry, b *SyncResult, files []*unmergedFile) error {
+	r, err := newConflictReport(out, dir, entry, b, files)
+	if err != nil {
+		return fmt.Errorf("failed to create conflict report: %w", err)
+	}
+	fmt.Fprintf(out, "---- Conflict report:\n%v\n", r.Markdown())
+	if f.ConflictReportDir == nil || *f.ConflictReportDir == "" {
+		return nil
+	}
+	mdPath, err := r.Write(*f.ConflictReportDir)
+	if err != nil {
+		return fmt.Errorf("failed to write conflict report: %w", err)
+	}
+	fmt.Fprintf(out, "---- Wrote conflict report: %v\n", mdPath)
+	// Write the logging command through out, so it isn't interleaved with the output of other
+	// sync entries running in parallel.
+	azdo.LogCmdUploadSummaryTo(out, mdPath)
+	return nil
+}
+
+// stageConflicts adds the unmerged files to the index so the merge can be committed for a draft
+// conflict PR. ConflictPRMarkers keeps the conflict markers Git wrote to each file, and
+// ConflictPRTheirs uses the upstream version of each file.
+func stageConflicts(out io.Writer, dir string, files []*unmergedFile, mode ConflictPRMode) error {
+	for _, f := range files {
+		if f.Submodule {
+			return fmt.Errorf("can't commit conflicting submodule %#q for a conflict PR", f.Path)
+		}
+		fmt.Fprintf(out, "---- Committing conflicting path %#q for a conflict PR: %v\n", f.Path, mode)
+		switch mode {
+		case ConflictPRMarkers:
+			// Git leaves the file in the worktree with markers, or leaves the modified side of a
+			// modify/delete conflict. If the file isn't there, neither side kept it.
+			if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(f.Path))); err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				if _, err := gitOutput(out, dir, "rm", "--quiet", "--", f.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := gitOutput(out, dir, "add", "--", f.Path); err != nil {
+				return err
+			}
+		case ConflictPRTheirs:
+			stages, err := f.readStages(out, dir)
+			if err != nil {
+				return err
+			}
+			if err := f.stage(out, dir, stages[3]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected conflict PR mode %q", mode)
+		}
+	}
+	return nil
+}
+
+// conflictPRBody returns the section of a draft conflict PR description that explains the PR and
+// lists the conflicting paths as a checklist.
+func conflictPRBody(paths []string, mode ConflictPRMode) string {
+	var b strings.Builder
+	b.WriteString("\n\n⚠️ This merge has conflicts that sync can't resolve automatically. ")
+	if mode == ConflictPRTheirs {
+		b.WriteString("The upstream version of each conflicting file is committed, discarding our changes to it. ")
+	} else {
+		b.WriteString("Each conflicting file is committed with conflict markers. ")
+	}
+	b.WriteString("This PR is a draft, and I won't approve it or enable auto-merge.")
+	b.WriteString("\n\nPlease push fixes to this PR branch, check off each file when it's resolved, then mark the PR as ready for review:\n\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "- [ ] `%v`\n", p)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/microsoft/go-infra/goldentest"
+)
+
+func TestConflictReport_Markdown(t *testing.T) {
+	r := &ConflictReport{
+		Upstream:       "https://go.googlesource.com/go",
+		Target:         "https://github.com/microsoft/go",
+		UpstreamBranch: "master",
+		TargetBranch:   "microsoft/main",
+		UpstreamCommit: "1111111111111111111111111111111111111111",
+		TargetCommit:   "2222222222222222222222222222222222222222",
+		MergeBase:      "3333333333333333333333333333333333333333",
+		Files: []ConflictFile{
+			{
+				Path: "src/crypto/tls/common.go",
+				UpstreamCommits: []ConflictCommit{
+					{"4444444444444444444444444444444444444444", "Gopher", "2022-08-01T10:00:00-07:00", "crypto/tls: add a feature"},
+				},
+				UpstreamCommitsTruncated: true,
+				TargetCommits: []ConflictCommit{
+					{"5555555555555555555555555555555555555555", "Microsoft Gopher", "2022-07-01T10:00:00-07:00", "Use system crypto"},
+				},
+			},
+			{Path: "CODEOWNERS"},
+		},
+		ReproCommands: []string{
+			"git fetch https://github.com/microsoft/go microsoft/main",
+			"git checkout --detach 2222222222222222222222222222222222222222",
+			"git fetch https://go.googlesource.com/go master",
+			"git merge --no-ff 1111111111111111111111111111111111111111",
+		},
+	}
+	goldentest.Check(t, "go test ./sync -run "+t.Name(), filepath.Join("testdata", "conflict-report.golden.md"), r.Markdown())
+}
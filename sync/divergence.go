@@ -0,0 +1,227 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MirrorLag describes how far UpstreamMirror's copy of a branch is from Upstream's.
+type MirrorLag struct {
+	Ref            string
+	UpstreamCommit string
+	MirrorCommit   string
+	// Behind is the number of Upstream commits that aren't in the mirror. Ahead is the number of
+	// mirror commits that aren't in Upstream: if not 0, the mirror has diverged, and it can't catch
+	// up with a fast-forward.
+	Behind int
+	Ahead  int
+	// Lag is how long the mirror has been missing an Upstream commit, based on the committer date of
+	// the oldest missing commit. 0 if the mirror isn't behind.
+	Lag time.Duration
+}
+
+// Diverged returns true if the mirror has commits that aren't in Upstream.
+func (l *MirrorLag) Diverged() bool {
+	return l.Ahead > 0
+}
+
+func (l *MirrorLag) String() string {
+	s := fmt.Sprintf("%v: mirror is %v commit(s) behind", l.Ref, l.Behind)
+	if l.Behind > 0 {
+		s += fmt.Sprintf(" (lag %v)", l.Lag)
+	}
+	if l.Diverged() {
+		s += fmt.Sprintf(", and has diverged with %v commit(s) not in Upstream", l.Ahead)
+	}
+	return s
+}
+
+// MirrorLagThresholds are the limits of acceptable UpstreamMirror lag. A zero value means no limit.
+// Divergence is never acceptable.
+type MirrorLagThresholds struct {
+	MaxCommits int
+	MaxLag     time.Duration
+}
+
+// Problem returns a description of how l is past the thresholds, or empty string if it's acceptable.
+func (t *MirrorLagThresholds) Problem(l *MirrorLag) string {
+	var problems []string
+	if l.Diverged() {
+		problems = append(problems, "mirror has diverged from Upstream")
+	}
+	if t.MaxCommits > 0 && l.Behind > t.MaxCommits {
+		problems = append(problems, fmt.Sprintf("more than %v commit(s) behind", t.MaxCommits))
+	}
+	if t.MaxLag > 0 && l.Lag > t.MaxLag {
+		problems = append(problems, fmt.Sprintf("lagging more than %v", t.MaxLag))
+	}
+	if len(problems) == 0 {
+		return ""
+	}
+	return l.Ref + ": " + strings.Join(problems, ", ")
+}
+
+// MirrorLagThresholds returns the thresholds set by the upstream-mirror flags, or nil if none are
+// set.
+func (f *Flags) MirrorLagThresholds() *MirrorLagThresholds {
+	t := &MirrorLagThresholds{}
+	if f.UpstreamMirrorMaxCommits != nil {
+		t.MaxCommits = *f.UpstreamMirrorMaxCommits
+	}
+	if f.UpstreamMirrorMaxLag != nil {
+		t.MaxLag = *f.UpstreamMirrorMaxLag
+	}
+	if t.MaxCommits <= 0 && t.MaxLag <= 0 {
+		return nil
+	}
+	return t
+}
+
+// measureMirrorLag compares the upstream and mirror revisions of ref in the repository at dir.
+func measureMirrorLag(out io.Writer, dir, ref, upstreamRev, mirrorRev string, now time.Time) (*MirrorLag, error) {
+	git := func(args ...string) (string, error) {
+		o, err := gitOutput(out, dir, args...)
+		return strings.TrimSpace(string(o)), err
+	}
+	var l MirrorLag
+	l.Ref = ref
+	var err error
+	if l.UpstreamCommit, err = git("rev-parse", upstreamRev); err != nil {
+		return nil, err
+	}
+	if l.MirrorCommit, err = git("rev-parse", mirrorRev); err != nil {
+		return nil, err
+	}
+	counts, err := git("rev-list", "--left-right", "--count", l.UpstreamCommit+"..."+l.MirrorCommit)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected 'git rev-list --count' output: %q", counts)
+	}
+	if l.Behind, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, err
+	}
+	if l.Ahead, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+	if l.Behind > 0 {
+		dates, err := git("log", "--format=%ct", l.MirrorCommit+".."+l.UpstreamCommit)
+		if err != nil {
+			return nil, err
+		}
+		// Log is newest first, so the last line is the oldest missing commit.
+		oldest, err := strconv.ParseInt(dates[strings.LastIndexByte(dates, '\n')+1:], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		l.Lag = now.Sub(time.Unix(oldest, 0)).Truncate(time.Second)
+	}
+	return &l, nil
+}
+
+// MirrorCheckReport is the result of comparing an entry's Upstream and UpstreamMirror.
+type MirrorCheckReport struct {
+	Upstream       string
+	UpstreamMirror string
+	Branches       []*MirrorLag
+	// MissingTags are the tags in Upstream that aren't in UpstreamMirror. ChangedTags point at
+	// different objects in each repository.
+	MissingTags []string
+	ChangedTags []MirrorDrift
+	// Problems are the reasons the check failed: lag past the thresholds, divergence, or changed
+	// tags.
+	Problems []string
+}
+
+// CheckUpstreamMirror compares the tips of entry's AutoSyncBranches and AutoMirrorBranches, and all
+// tags, between Upstream and UpstreamMirror, using a new Git repository at dir. Lag past t is
+// reported as a problem. t may be nil to only report divergence and changed tags.
+func CheckUpstreamMirror(f *Flags, dir string, entry *ConfigEntry, t *MirrorLagThresholds, out io.Writer) (*MirrorCheckReport, error) {
+	if entry.UpstreamMirror == "" {
+		return nil, fmt.Errorf("entry with Upstream %v has no UpstreamMirror", entry.Upstream)
+	}
+	if t == nil {
+		t = &MirrorLagThresholds{}
+	}
+	auther, err := f.ParseAuth()
+	if err != nil {
+		return nil, err
+	}
+	remotes := f.newRemoteSet(auther, dir)
+	if err := run(out, exec.Command("git", "init", "--quiet", dir)); err != nil {
+		return nil, err
+	}
+	upstreamURL := remotes.fetchURL(entry.Upstream)
+	mirrorURL := remotes.fetchURL(entry.UpstreamMirror)
+	upstreamRefs, err := lsRemote(out, dir, upstreamURL)
+	if err != nil {
+		return nil, err
+	}
+	mirrorRefs, err := lsRemote(out, dir, mirrorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &MirrorCheckReport{Upstream: entry.Upstream, UpstreamMirror: entry.UpstreamMirror}
+	var branches []string
+	for _, ref := range sortedKeys(upstreamRefs) {
+		if name := strings.TrimPrefix(ref, "refs/tags/"); name != ref {
+			switch mirrorRefs[ref] {
+			case upstreamRefs[ref]:
+			case "":
+				r.MissingTags = append(r.MissingTags, name)
+			default:
+				d := MirrorDrift{Ref: ref, UpstreamCommit: upstreamRefs[ref], MirrorCommit: mirrorRefs[ref]}
+				r.ChangedTags = append(r.ChangedTags, d)
+				r.Problems = append(r.Problems, "tag changed: "+d.String())
+			}
+			continue
+		}
+		name := strings.TrimPrefix(ref, "refs/heads/")
+		if !entryMirrorsBranch(entry, name) {
+			continue
+		}
+		if mirrorRefs[ref] == "" {
+			r.Problems = append(r.Problems, ref+": missing from mirror")
+			continue
+		}
+		branches = append(branches, name)
+	}
+	if len(branches) == 0 {
+		return r, nil
+	}
+
+	fetchUpstream := []string{"fetch", "--no-tags", upstreamURL}
+	fetchMirror := []string{"fetch", "--no-tags", mirrorURL}
+	for _, b := range branches {
+		fetchUpstream = append(fetchUpstream, "+refs/heads/"+b+":refs/upstream/"+b)
+		fetchMirror = append(fetchMirror, "+refs/heads/"+b+":refs/upstream-mirror/"+b)
+	}
+	if err := run(out, newDirGitCmd(dir, fetchUpstream...)); err != nil {
+		return nil, err
+	}
+	if err := run(out, newDirGitCmd(dir, fetchMirror...)); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, b := range branches {
+		l, err := measureMirrorLag(out, dir, "refs/heads/"+b, "refs/upstream/"+b, "refs/upstream-mirror/"+b, now)
+		if err != nil {
+			return nil, err
+		}
+		r.Branches = append(r.Branches, l)
+		if p := t.Problem(l); p != "" {
+			r.Problems = append(r.Problems, p)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMirrorLagThresholds_Problem(t *testing.T) {
+	tests := []struct {
+		name string
+		t    MirrorLagThresholds
+		l    MirrorLag
+		want string
+	}{
+		{"up to date", MirrorLagThresholds{MaxCommits: 1}, MirrorLag{Ref: "main"}, ""},
+		{"no limits", MirrorLagThresholds{}, MirrorLag{Ref: "main", Behind: 100, Lag: time.Hour}, ""},
+		{"within limits", MirrorLagThresholds{MaxCommits: 2, MaxLag: time.Hour}, MirrorLag{Ref: "main", Behind: 2, Lag: time.Hour}, ""},
+		{"commits", MirrorLagThresholds{MaxCommits: 2}, MirrorLag{Ref: "main", Behind: 3}, "main: more than 2 commit(s) behind"},
+		{"lag", MirrorLagThresholds{MaxLag: time.Hour}, MirrorLag{Ref: "main", Behind: 1, Lag: 2 * time.Hour}, "main: lagging more than 1h0m0s"},
+		{"diverged", MirrorLagThresholds{}, MirrorLag{Ref: "main", Ahead: 1}, "main: mirror has diverged from Upstream"},
+		{
+			"all",
+			MirrorLagThresholds{MaxCommits: 1, MaxLag: time.Minute},
+			MirrorLag{Ref: "main", Behind: 2, Ahead: 1, Lag: time.Hour},
+			"main: mirror has diverged from Upstream, more than 1 commit(s) behind, lagging more than 1m0s",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.t.Problem(&tt.l); got != tt.want {
+				t.Errorf("Problem() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
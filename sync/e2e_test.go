@@ -0,0 +1,1685 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-infra/gitcmd"
+	"github.com/microsoft/go-infra/gitpr"
+	"github.com/microsoft/go-infra/stringutil"
+)
+
+// This file implements an offline end-to-end test harness for sync. Upstream, UpstreamMirror, and
+// Target are bare repos on disk, and the GitHub API used by gitpr is served by fakeGitHub.
+
+func TestMakeBranchPRs_E2E_ForkMerge(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Target, "microsoft/main", map[string]string{"eng/build.sh": "echo build"})
+	upstreamCommit := h.commit(h.Upstream, "main", map[string]string{"src/fix.go": "package fix"})
+
+	c := h.entry()
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].PR == nil {
+		t.Fatalf("expected one result with a PR, got %+v", results)
+	}
+	prBranch := "dev/auto-sync/microsoft/main"
+	if got := h.revParse(h.Target, prBranch); got != results[0].Commit {
+		t.Errorf("pushed PR branch commit %v, result commit %v", got, results[0].Commit)
+	}
+	if !h.isAncestor(h.Target, upstreamCommit, prBranch) {
+		t.Errorf("upstream commit %v not merged into %v", upstreamCommit, prBranch)
+	}
+	if got := h.show(h.Target, prBranch, "eng/build.sh"); got != "echo build" {
+		t.Errorf("target-only file content lost in merge: %q", got)
+	}
+
+	prs := h.GitHub.PRs()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 PR, got %v", len(prs))
+	}
+	pr := prs[0]
+	if pr.Head != "microsoft:"+prBranch || pr.Base != "microsoft/main" {
+		t.Errorf("unexpected PR head/base: %v -> %v", pr.Head, pr.Base)
+	}
+	if pr.Approvals != 1 || pr.AutoMergeEnables != 1 {
+		t.Errorf("expected PR to be approved and set to auto-merge once, got %+v", pr)
+	}
+	if !strings.Contains(pr.Body, "This PR brings in 1 upstream commit(s):") || !strings.Contains(pr.Body, "`"+upstreamCommit[:8]+"`") {
+		t.Errorf("PR body doesn't list upstream commit %v:\n%v", upstreamCommit, pr.Body)
+	}
+}
+
+func TestMakeBranchPRs_E2E_AutoResolveTarget(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"CODEOWNERS": "* @golang"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Target, "microsoft/main", map[string]string{"CODEOWNERS": "* @microsoft"})
+	h.commit(h.Upstream, "main", map[string]string{"CODEOWNERS": "* @golang @gopher", "new.txt": "new"})
+
+	c := h.entry()
+	c.AutoResolveTarget = []string{"CODEOWNERS"}
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	prBranch := "dev/auto-sync/microsoft/main"
+	if got := h.show(h.Target, prBranch, "CODEOWNERS"); got != "* @microsoft" {
+		t.Errorf("CODEOWNERS not auto-resolved to Target content: %q", got)
+	}
+	if got := h.show(h.Target, prBranch, "new.txt"); got != "new" {
+		t.Errorf("upstream change not merged: %q", got)
+	}
+}
+
+func init() {
+	RegisterResolver("test-concat", func(path string, base, ours, theirs []byte) ([]byte, error) {
+		return append(append([]byte(nil), theirs...), ours...), nil
+	})
+}
+
+func TestMakeBranchPRs_E2E_AutoResolve(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{
+		"go.mod":         "module example\n\ngo 1.18\n",
+		"CODEOWNERS":     "* @golang\n",
+		"src/VERSION":    "go1.18\n",
+		"src/custom.txt": "base\n",
+	})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Target, "microsoft/main", map[string]string{
+		"go.mod":         "module example\n\ngo 1.18\n\nrequire ours v1.0.0\n",
+		"CODEOWNERS":     "* @microsoft\n",
+		"src/VERSION":    "go1.18-ms\n",
+		"src/custom.txt": "ours\n",
+	})
+	h.commit(h.Upstream, "main", map[string]string{
+		"go.mod":         "module example\n\ngo 1.18\n\nrequire theirs v1.0.0\n",
+		"CODEOWNERS":     "* @golang @gopher\n",
+		"src/VERSION":    "go1.18.1\n",
+		"src/custom.txt": "theirs\n",
+	})
+
+	c := h.entry()
+	c.AutoResolve = []AutoResolveRule{
+		{Pattern: "go.mod", Strategy: ResolveUnion},
+		{Pattern: "CODEOWNERS", Strategy: ResolveOurs},
+		{Pattern: "src/VERSION", Strategy: ResolveTheirs},
+		{Pattern: "src/*.txt", Strategy: ResolveResolver, Resolver: "test-concat"},
+	}
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	prBranch := "dev/auto-sync/microsoft/main"
+	want := map[string]string{
+		"go.mod":         "module example\n\ngo 1.18\n\nrequire ours v1.0.0\nrequire theirs v1.0.0\n",
+		"CODEOWNERS":     "* @microsoft\n",
+		"src/VERSION":    "go1.18.1\n",
+		"src/custom.txt": "theirs\nours\n",
+	}
+	for p, content := range want {
+		if got := h.show(h.Target, prBranch, p); got != content {
+			t.Errorf("%v = %q, want %q", p, got, content)
+		}
+	}
+	body := h.GitHub.PRs()[0].Body
+	for _, line := range []string{
+		"| `go.mod` | `go.mod` | union |",
+		"| `CODEOWNERS` | `CODEOWNERS` | ours |",
+		"| `src/VERSION` | `src/VERSION` | theirs |",
+		"| `src/custom.txt` | `src/*.txt` | resolver test-concat |",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("PR body doesn't contain %q:\n%v", line, body)
+		}
+	}
+}
+
+func TestMakeBranchPRs_E2E_AutoResolveUnmatched(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"a.txt": "base\n", "b.txt": "base\n"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Target, "microsoft/main", map[string]string{"a.txt": "ours\n", "b.txt": "ours\n"})
+	h.commit(h.Upstream, "main", map[string]string{"a.txt": "theirs\n", "b.txt": "theirs\n"})
+
+	upstreamCommit := h.commit(h.Upstream, "main", map[string]string{"c.txt": "c\n"})
+
+	c := h.entry()
+	c.AutoResolve = []AutoResolveRule{{Pattern: "a.txt", Strategy: ResolveOurs}}
+	f := h.flags()
+	*f.ConflictReportDir = filepath.Join(h.dir, "conflicts")
+	if _, err := MakeBranchPRs(f, h.workDir(), c); err == nil {
+		t.Fatal("expected error: b.txt conflict isn't resolved")
+	}
+	if len(h.GitHub.PRs()) != 0 {
+		t.Errorf("expected no PRs")
+	}
+
+	reportPath := filepath.Join(*f.ConflictReportDir, "sync-conflict-microsoft-go-microsoft-main")
+	var r ConflictReport
+	if err := stringutil.ReadJSONFile(reportPath+".json", &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.UpstreamCommit != upstreamCommit || r.TargetCommit != h.revParse(h.Target, "microsoft/main") {
+		t.Errorf("unexpected commits in report: %+v", r)
+	}
+	if len(r.Files) != 1 || r.Files[0].Path != "b.txt" {
+		t.Fatalf("expected only b.txt in report, got %+v", r.Files)
+	}
+	if got := len(r.Files[0].UpstreamCommits); got != 1 {
+		t.Errorf("expected 1 upstream commit touching b.txt since the merge base, got %v", got)
+	}
+	if got := len(r.Files[0].TargetCommits); got != 2 {
+		t.Errorf("expected 2 target commits touching b.txt, got %v", got)
+	}
+	if _, err := os.Stat(reportPath + ".md"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMakeBranchPRs_E2E_ConflictPR(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		mode       ConflictPRMode
+		wantPrefix string
+	}{
+		{ConflictPRMarkers, "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> "},
+		{ConflictPRTheirs, "theirs\n"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.mode), func(t *testing.T) {
+			t.Parallel()
+			h := newSyncHarness(t)
+			h.commit(h.Upstream, "main", map[string]string{"a.txt": "base\n"})
+			h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+			h.commit(h.Target, "microsoft/main", map[string]string{"a.txt": "ours\n"})
+			h.commit(h.Upstream, "main", map[string]string{"a.txt": "theirs\n", "new.txt": "new\n"})
+
+			f := h.flags()
+			*f.ConflictPR = string(tt.mode)
+			results, err := MakeBranchPRs(f, h.workDir(), h.entry())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || !reflect.DeepEqual(results[0].Conflicts, []string{"a.txt"}) {
+				t.Fatalf("expected a.txt conflict in results, got %+v", results)
+			}
+
+			prBranch := "dev/auto-sync-conflict/microsoft/main"
+			if got := h.show(h.Target, prBranch, "a.txt"); !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("a.txt = %q, want prefix %q", got, tt.wantPrefix)
+			}
+			if got := h.show(h.Target, prBranch, "new.txt"); got != "new\n" {
+				t.Errorf("upstream change not merged: %q", got)
+			}
+			if h.exists(h.Target, "dev/auto-sync/microsoft/main", "a.txt") {
+				t.Errorf("expected no push to the auto-merge PR branch")
+			}
+
+			prs := h.GitHub.PRs()
+			if len(prs) != 1 {
+				t.Fatalf("expected 1 PR, got %v", len(prs))
+			}
+			pr := prs[0]
+			if !pr.Draft || !strings.HasSuffix(pr.Head, ":"+prBranch) {
+				t.Errorf("expected draft PR from %v, got %+v", prBranch, pr)
+			}
+			if pr.Approvals != 0 || pr.AutoMergeEnables != 0 {
+				t.Errorf("expected conflict PR not to be approved or set to auto-merge, got %+v", pr)
+			}
+			if !strings.Contains(pr.Body, "- [ ] `a.txt`") {
+				t.Errorf("PR body doesn't contain a.txt checklist item:\n%v", pr.Body)
+			}
+		})
+	}
+}
+
+func TestMakeBranchPRs_E2E_SubmoduleUpdate(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	first := h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.18"})
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	h.setSubmodule(h.Target, "microsoft/main", "go", first)
+
+	// The mirror lags behind upstream by one commit: sync should pick the common commit.
+	common := h.commit(h.Upstream, "main", map[string]string{"fix1.go": "package fix"})
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	h.commit(h.Upstream, "main", map[string]string{"fix2.go": "package fix"})
+
+	c := h.entry()
+	c.UpstreamMirror = h.UpstreamMirror
+	c.SubmoduleTarget = "go"
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].PR == nil {
+		t.Fatalf("expected one result with a PR, got %+v", results)
+	}
+	if got := h.gitlink(h.Target, "dev/auto-sync/microsoft/main", "go"); got != common {
+		t.Errorf("submodule updated to %v, want common commit %v", got, common)
+	}
+	if msg := h.GitHub.PRs()[0].Title; !strings.Contains(msg, "Update submodule") {
+		t.Errorf("unexpected PR title: %q", msg)
+	}
+	if body := h.GitHub.PRs()[0].Body; !strings.Contains(body, "This PR brings in 1 upstream commit(s):") || !strings.Contains(body, "`"+common[:8]+"`") {
+		t.Errorf("PR body doesn't list upstream commit %v:\n%v", common, body)
+	}
+}
+
+func TestMakeBranchPRs_E2E_AdditionalSubmodules(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	crypto := filepath.Join(h.dir, "upstream", "golang", "crypto")
+	h.git("", "init", "--bare", crypto)
+	goCommit := h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.18"})
+	oldCrypto := h.commit(crypto, "master", map[string]string{"README.md": "crypto"})
+	h.setSubmodule(h.Target, "microsoft/main", "go", goCommit)
+	h.setSubmodule(h.Target, "microsoft/main", "crypto", oldCrypto)
+	newCrypto := h.commit(crypto, "master", map[string]string{"sha3.go": "package sha3"})
+
+	c := h.entry()
+	c.SubmoduleTarget = "go"
+	c.AdditionalSubmodules = []AdditionalSubmodule{{Path: "crypto", Upstream: crypto, Branch: "master"}}
+	// Staging hook changes must not touch the submodules, which aren't checked out.
+	c.PostMergeHooks = []Hook{{Command: []string{"sh", "-c", "rm -rf go crypto"}}}
+
+	// Only one submodule is out of date, but that's enough to need a PR.
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].UpToDate || results[0].PR == nil {
+		t.Fatalf("expected one result with a PR, got %+v", results)
+	}
+	if want := map[string]string{"crypto": newCrypto}; !reflect.DeepEqual(results[0].SubmoduleCommits, want) {
+		t.Errorf("SubmoduleCommits = %v, want %v", results[0].SubmoduleCommits, want)
+	}
+	const prBranch = "dev/auto-sync/microsoft/main"
+	if got := h.gitlink(h.Target, prBranch, "go"); got != goCommit {
+		t.Errorf("go submodule = %v, want %v", got, goCommit)
+	}
+	if got := h.gitlink(h.Target, prBranch, "crypto"); got != newCrypto {
+		t.Errorf("crypto submodule = %v, want %v", got, newCrypto)
+	}
+	pr := h.GitHub.PRs()[0]
+	if !strings.Contains(pr.Title, "Update submodules") {
+		t.Errorf("unexpected PR title: %q", pr.Title)
+	}
+	if !strings.Contains(pr.Body, "## Upstream changes in `crypto`") || !strings.Contains(pr.Body, "`"+newCrypto[:8]+"`") {
+		t.Errorf("PR body doesn't list crypto changes:\n%v", pr.Body)
+	}
+
+	// Once every submodule is up to date, the branch is up to date.
+	h.setSubmodule(h.Target, "microsoft/main", "crypto", newCrypto)
+	results, err = MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].UpToDate {
+		t.Errorf("expected up to date result, got %+v", results)
+	}
+}
+
+func TestMakeBranchPRs_E2E_NestedSubmodules(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	text := filepath.Join(h.dir, "upstream", "golang", "text")
+	submoduleRepo := filepath.Join(h.dir, "target", "microsoft", "go-submodule")
+	h.git("", "init", "--bare", text)
+	h.git("", "init", "--bare", submoduleRepo)
+	oldText := h.commit(text, "master", map[string]string{"README.md": "text"})
+	h.setSubmodule(h.Upstream, "main", "src/vendor/text", oldText)
+	goCommit := h.revParse(h.Upstream, "main")
+	h.setSubmodule(h.Target, "microsoft/main", "go", goCommit)
+	newText := h.commit(text, "master", map[string]string{"unicode.go": "package unicode"})
+
+	c := h.entry()
+	c.SubmoduleTarget = "go"
+	c.SubmoduleTargetRepo = submoduleRepo
+	c.AdditionalSubmodules = []AdditionalSubmodule{{Path: "go/src/vendor/text", Upstream: text, Branch: "master"}}
+
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].UpToDate || results[0].PR == nil {
+		t.Fatalf("expected one result with a PR, got %+v", results)
+	}
+	if want := map[string]string{"go/src/vendor/text": newText}; !reflect.DeepEqual(results[0].SubmoduleCommits, want) {
+		t.Errorf("SubmoduleCommits = %v, want %v", results[0].SubmoduleCommits, want)
+	}
+	const prBranch = "dev/auto-sync/microsoft/main"
+	if h.exists(h.Target, prBranch, "go/src/vendor/text") {
+		t.Errorf("nested submodule was added to the Target tree")
+	}
+	// The Target points at a new commit of the submodule that updates the nested submodule.
+	goUpdate := h.gitlink(h.Target, prBranch, "go")
+	if goUpdate == goCommit {
+		t.Fatalf("go submodule wasn't updated")
+	}
+	if !h.refExists(submoduleRepo, "refs/heads/auto-sync-submodule/"+goUpdate) {
+		t.Fatalf("go submodule commit %v wasn't pushed to SubmoduleTargetRepo", goUpdate)
+	}
+	if got := h.revParse(submoduleRepo, goUpdate+"^"); got != goCommit {
+		t.Errorf("go submodule commit parent = %v, want upstream commit %v", got, goCommit)
+	}
+	if got := h.gitlink(submoduleRepo, goUpdate, "src/vendor/text"); got != newText {
+		t.Errorf("nested text submodule = %v, want %v", got, newText)
+	}
+	pr := h.GitHub.PRs()[0]
+	if !strings.Contains(pr.Body, "## Upstream changes in `go/src/vendor/text`") || !strings.Contains(pr.Body, "`"+newText[:8]+"`") {
+		t.Errorf("PR body doesn't list text changes:\n%v", pr.Body)
+	}
+
+	// Merging the PR makes the branch up to date: sync makes the same submodule commit again.
+	h.pushBranch(h.Target, prBranch, h.Target, "microsoft/main")
+	results, err = MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].UpToDate {
+		t.Errorf("expected up to date result, got %+v", results)
+	}
+}
+
+func TestMakeBranchPRs_E2E_Hooks(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.pushBranch(h.Upstream, "main", h.Upstream, "release-branch.go1.20")
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/release-branch.go1.20")
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello, hooks"})
+	h.commit(h.Upstream, "release-branch.go1.20", map[string]string{"a.go": "package a"})
+
+	c := h.entry()
+	c.BranchMap["release-branch.*"] = "microsoft/?"
+	c.AutoSyncBranches = []string{"main", "release-branch.go1.20"}
+	c.PreMergeHooks = []Hook{
+		{Name: "record branch", Command: []string{"sh", "-c", "echo $SYNC_HOOK_STAGE $SYNC_UPSTREAM_BRANCH > pre.txt"}},
+	}
+	c.PostMergeHooks = []Hook{
+		{Command: []string{"sh", "-c", "cp README.md generated.txt"}},
+		{Name: "fail on release", Command: []string{"sh", "-c", `test "$SYNC_UPSTREAM_BRANCH" = main || { echo something went wrong; exit 3; }`}},
+	}
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err == nil || !strings.Contains(err.Error(), "microsoft/release-branch.go1.20") {
+		t.Fatalf("expected hook failure error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if results[0].Error != "" || results[0].PR == nil {
+		t.Errorf("expected main to sync successfully, got %+v", results[0])
+	}
+	if e := results[1].Error; !strings.Contains(e, `post-merge hook "fail on release" failed`) || !strings.Contains(e, "something went wrong") {
+		t.Errorf("release branch error doesn't contain the hook output: %q", e)
+	}
+	if n := len(h.GitHub.PRs()); n != 1 {
+		t.Errorf("expected 1 PR, got %v", n)
+	}
+
+	const prBranch = "dev/auto-sync/microsoft/main"
+	if got := h.show(h.Target, prBranch, "pre.txt"); got != "pre-merge main\n" {
+		t.Errorf("pre.txt = %q", got)
+	}
+	if got := h.show(h.Target, prBranch, "generated.txt"); got != "Hello, hooks" {
+		t.Errorf("post-merge hook didn't run after the merge: generated.txt = %q", got)
+	}
+	if got := h.show(h.Target, prBranch+"^1", "pre.txt"); got != "pre-merge main\n" {
+		t.Errorf("pre-merge hook changes aren't committed before the merge: %q", got)
+	}
+}
+
+func TestMakeBranchPRs_E2E_DryRunPreview(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	first := h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.setSubmodule(h.Target, "microsoft/main", "go", first)
+	next := h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.18.2"})
+
+	c := h.entry()
+	c.SubmoduleTarget = "go"
+	c.GoVersionFileContent = "go1.18.3"
+	f := h.flags()
+	*f.DryRun = true
+	*f.DryRunPatchDir = filepath.Join(h.dir, "patches")
+	var out bytes.Buffer
+	if _, err := makeBranchPRs(f, h.workDir(), c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.GitHub.PRs()) != 0 {
+		t.Errorf("expected no PRs in a dry run")
+	}
+	if h.exists(h.Target, "dev/auto-sync/microsoft/main", "go") {
+		t.Errorf("expected no push in a dry run")
+	}
+
+	preview := out.String()
+	preview = preview[strings.Index(preview, "---- Dry run preview"):]
+	for _, want := range []string{
+		"Upstream commits: " + first + ".." + next + " (1 commit(s))",
+		" go      | 2 +-",
+		"+go1.18.3",
+		"Refspecs to push to " + h.Target + ":\n  --force refs/heads/dev/auto-sync/microsoft/main:refs/heads/dev/auto-sync/microsoft/main",
+	} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("preview doesn't contain %q:\n%v", want, preview)
+		}
+	}
+
+	patch, err := os.ReadFile(filepath.Join(*f.DryRunPatchDir, "sync-microsoft-go-microsoft-main.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "+Subproject commit "+next) {
+		t.Errorf("patch doesn't update submodule to %v:\n%s", next, patch)
+	}
+}
+
+func TestMakeBranchPRs_E2E_DryRunPreviewPreMergeHook(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello, preview"})
+
+	c := h.entry()
+	c.PreMergeHooks = []Hook{
+		{Command: []string{"sh", "-c", "echo go1.21.0 > VERSION"}},
+	}
+	f := h.flags()
+	*f.DryRun = true
+	*f.DryRunPatchDir = filepath.Join(h.dir, "patches")
+	var out bytes.Buffer
+	if _, err := makeBranchPRs(f, h.workDir(), c, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// The preview must include the pre-merge hook changes, which are in the PR but aren't in the
+	// merge commit's diff against its first parent.
+	preview := out.String()
+	preview = preview[strings.Index(preview, "---- Dry run preview"):]
+	for _, want := range []string{
+		" README.md | 2 +-",
+		" VERSION   | 1 +",
+		"+go1.21.0",
+	} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("preview doesn't contain %q:\n%v", want, preview)
+		}
+	}
+
+	patch, err := os.ReadFile(filepath.Join(*f.DryRunPatchDir, "sync-microsoft-go-microsoft-main.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "+go1.21.0") {
+		t.Errorf("patch doesn't contain the pre-merge hook change:\n%s", patch)
+	}
+}
+
+func TestMakeBranchPRs_E2E_Bundles(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	upstreamCommit := h.commit(h.Upstream, "main", map[string]string{"src/fix.go": "package fix"})
+
+	// Use remote URLs that can't be reached, so the sync only works if it uses the bundles.
+	c := h.entry()
+	c.Upstream = "https://go.googlesource.com/go"
+	c.Target = "https://github.com/microsoft/go"
+	inputDir := filepath.Join(h.dir, "input-bundles")
+	if err := os.MkdirAll(inputDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	h.git(h.Upstream, "bundle", "create", filepath.Join(inputDir, "go.googlesource.com-go.bundle"), "--all")
+	targetBundle := filepath.Join(h.dir, "target.bundle")
+	h.git(h.Target, "bundle", "create", targetBundle, "--all")
+
+	f := h.flags()
+	*f.InputBundleDir = inputDir
+	f.InputBundles = map[string]string{c.Target: targetBundle}
+	*f.OutputBundleDir = filepath.Join(h.dir, "output-bundles")
+	results, err := MakeBranchPRs(f, h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Commit == "" || results[0].PR != nil {
+		t.Fatalf("expected one result with a commit and no PR, got %+v", results)
+	}
+	if len(h.GitHub.PRs()) != 0 {
+		t.Errorf("expected no PRs when writing bundles")
+	}
+
+	// Apply the output bundle to the Target repo, as if it was copied back from the build agent.
+	outputBundle := filepath.Join(*f.OutputBundleDir, "github.com-microsoft-go.bundle")
+	prBranch := "dev/auto-sync/microsoft/main"
+	h.git(h.Target, "fetch", outputBundle, "+refs/heads/"+prBranch+":refs/heads/"+prBranch)
+	if got := h.revParse(h.Target, prBranch); got != results[0].Commit {
+		t.Errorf("bundled PR branch commit %v, result commit %v", got, results[0].Commit)
+	}
+	if !h.isAncestor(h.Target, upstreamCommit, prBranch) {
+		t.Errorf("upstream commit %v not merged into %v", upstreamCommit, prBranch)
+	}
+}
+
+func TestMirrorEntry_E2E(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "release-branch.go1.20")
+	h.pushBranch(h.Upstream, "main", h.Upstream, "dev.boringcrypto")
+	release := h.commit(h.Upstream, "release-branch.go1.21", map[string]string{"VERSION": "go1.21.0"})
+	h.git(h.Upstream, "tag", "-a", "-m", "go1.21.0", "go1.21.0", release)
+	main := h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello, mirror"})
+
+	c := h.entry()
+	c.MirrorTarget = h.UpstreamMirror
+	opts := &MirrorOptions{
+		Include: []string{"heads/*", "tags/go1.*"},
+		Exclude: []string{"heads/dev.*"},
+		Prune:   true,
+	}
+	r, err := MirrorEntry(h.flags(), h.workDir(), c, opts, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPushed := []string{"refs/heads/main", "refs/heads/release-branch.go1.21", "refs/tags/go1.21.0"}
+	if !reflect.DeepEqual(r.Pushed, wantPushed) {
+		t.Errorf("Pushed = %v, want %v", r.Pushed, wantPushed)
+	}
+	if want := []string{"refs/heads/release-branch.go1.20"}; !reflect.DeepEqual(r.Pruned, want) {
+		t.Errorf("Pruned = %v, want %v", r.Pruned, want)
+	}
+	if len(r.Drift) != 0 {
+		t.Errorf("unexpected drift: %v", r.Drift)
+	}
+	if got := h.revParse(h.UpstreamMirror, "main"); got != main {
+		t.Errorf("mirror main = %v, want %v", got, main)
+	}
+	if got := h.revParse(h.UpstreamMirror, "go1.21.0^{commit}"); got != release {
+		t.Errorf("mirror tag go1.21.0 = %v, want %v", got, release)
+	}
+	if h.refExists(h.UpstreamMirror, "refs/heads/dev.boringcrypto") {
+		t.Errorf("excluded branch was mirrored")
+	}
+	if h.refExists(h.UpstreamMirror, "refs/heads/release-branch.go1.20") {
+		t.Errorf("branch deleted upstream wasn't pruned")
+	}
+
+	// Running again finds nothing to do.
+	r, err = MirrorEntry(h.flags(), h.workDir(), c, opts, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Pushed) != 0 || len(r.Pruned) != 0 || len(r.Drift) != 0 {
+		t.Errorf("expected no changes, got %+v", r)
+	}
+}
+
+func TestMirrorEntry_E2E_ConfigPatterns(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Upstream, "dev.boringcrypto/go1.21")
+	h.pushBranch(h.Upstream, "main", h.Upstream, "other")
+
+	// Without include patterns, the config's AutoMirrorBranches select the same branches as sync:
+	// like in a refspec, "*" matches "/".
+	c := h.entry()
+	c.MirrorTarget = h.UpstreamMirror
+	c.AutoMirrorBranches = []string{"dev.*"}
+	r, err := MirrorEntry(h.flags(), h.workDir(), c, &MirrorOptions{}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPushed := []string{"refs/heads/dev.boringcrypto/go1.21", "refs/heads/main"}
+	if !reflect.DeepEqual(r.Pushed, wantPushed) {
+		t.Errorf("Pushed = %v, want %v", r.Pushed, wantPushed)
+	}
+}
+
+func TestMakeBranchPRs_E2E_Tags(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	first := h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.git(h.Upstream, "tag", "-a", "-m", "go1.21.0", "go1.21.0", first)
+	h.git(h.Upstream, "tag", "weekly.2023-01-01", first)
+	second := h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.21.1"})
+
+	c := h.entry()
+	c.MirrorTarget = h.UpstreamMirror
+	c.AutoMirrorTags = []string{"go1.*"}
+	c.AutoTargetTags = []string{"go1.*"}
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range []string{h.UpstreamMirror, h.Target} {
+		if got := h.revParse(repo, "refs/tags/go1.21.0^{commit}"); got != first {
+			t.Errorf("go1.21.0 in %v = %v, want %v", repo, got, first)
+		}
+		if h.refExists(repo, "refs/tags/weekly.2023-01-01") {
+			t.Errorf("unmatched tag pushed to %v", repo)
+		}
+	}
+
+	// Move the tag upstream. Sync must refuse to overwrite it.
+	h.git(h.Upstream, "tag", "-f", "-a", "-m", "go1.21.0", "go1.21.0", second)
+	_, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	var rewritten *RewrittenTagError
+	if !errors.As(err, &rewritten) {
+		t.Fatalf("expected RewrittenTagError, got %v", err)
+	}
+	if rewritten.Repo != h.UpstreamMirror || len(rewritten.Tags) != 1 || rewritten.Tags[0].Ref != "refs/tags/go1.21.0" {
+		t.Errorf("unexpected error: %v", rewritten)
+	}
+	if got := h.revParse(h.UpstreamMirror, "refs/tags/go1.21.0^{commit}"); got != first {
+		t.Errorf("go1.21.0 in mirror was overwritten: %v", got)
+	}
+
+	// The mirror command refuses, too.
+	_, err = MirrorEntry(h.flags(), h.workDir(), c, &MirrorOptions{}, os.Stdout)
+	if !errors.As(err, &rewritten) {
+		t.Fatalf("expected RewrittenTagError from MirrorEntry, got %v", err)
+	}
+}
+
+func TestCheckUpstreamMirror_E2E(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	first := h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "release-branch.go1.21")
+	h.git(h.Upstream, "tag", "go1.21.0", first)
+	h.git(h.UpstreamMirror, "tag", "go1.21.0", first)
+	h.git(h.Upstream, "tag", "go1.21.1", first)
+	h.commit(h.Upstream, "main", map[string]string{"a.go": "package a"})
+	h.commit(h.Upstream, "main", map[string]string{"b.go": "package b"})
+	diverged := h.commit(h.UpstreamMirror, "release-branch.go1.21", map[string]string{"c.go": "package c"})
+	h.commit(h.Upstream, "release-branch.go1.21", map[string]string{"d.go": "package d"})
+	// Like in a refspec, "*" in AutoMirrorBranches matches "/".
+	h.pushBranch(h.Upstream, "main", h.Upstream, "release-branch.go1.22/rc")
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "release-branch.go1.22/rc")
+
+	c := h.entry()
+	c.UpstreamMirror = h.UpstreamMirror
+	c.AutoMirrorBranches = []string{"release-branch.*"}
+
+	r, err := CheckUpstreamMirror(h.flags(), h.workDir(), c, &MirrorLagThresholds{MaxCommits: 5}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Branches) != 3 {
+		t.Fatalf("expected 3 branches, got %v", r.Branches)
+	}
+	if l := r.Branches[0]; l.Ref != "refs/heads/main" || l.Behind != 2 || l.Diverged() {
+		t.Errorf("unexpected main lag: %+v", l)
+	}
+	if l := r.Branches[1]; l.Ref != "refs/heads/release-branch.go1.21" || l.Behind != 1 || !l.Diverged() {
+		t.Errorf("unexpected release branch lag: %+v", l)
+	}
+	if l := r.Branches[2]; l.Ref != "refs/heads/release-branch.go1.22/rc" || l.Behind != 0 || l.Diverged() {
+		t.Errorf("unexpected release candidate branch lag: %+v", l)
+	}
+	if want := []string{"go1.21.1"}; !reflect.DeepEqual(r.MissingTags, want) {
+		t.Errorf("MissingTags = %v, want %v", r.MissingTags, want)
+	}
+	// Only the divergence is a problem: main is within the threshold.
+	if len(r.Problems) != 1 || !strings.Contains(r.Problems[0], "diverged") {
+		t.Errorf("unexpected problems: %v", r.Problems)
+	}
+
+	// Exceed the commit threshold, and move a tag.
+	h.git(h.UpstreamMirror, "tag", "-f", "go1.21.0", diverged)
+	r, err = CheckUpstreamMirror(h.flags(), h.workDir(), c, &MirrorLagThresholds{MaxCommits: 1}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.ChangedTags) != 1 || r.ChangedTags[0].Ref != "refs/tags/go1.21.0" {
+		t.Errorf("unexpected changed tags: %v", r.ChangedTags)
+	}
+	want := []string{
+		"tag changed: refs/tags/go1.21.0: upstream " + first + ", mirror " + diverged,
+		"refs/heads/main: more than 1 commit(s) behind",
+		"refs/heads/release-branch.go1.21: mirror has diverged from Upstream",
+	}
+	if !reflect.DeepEqual(r.Problems, want) {
+		t.Errorf("Problems = %v, want %v", r.Problems, want)
+	}
+}
+
+func TestMakeBranchPRs_E2E_UpstreamMirrorLag(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	h.commit(h.Upstream, "main", map[string]string{"a.go": "package a"})
+	h.commit(h.Upstream, "main", map[string]string{"b.go": "package b"})
+
+	c := h.entry()
+	c.UpstreamMirror = h.UpstreamMirror
+	f := h.flags()
+	*f.UpstreamMirrorMaxCommits = 1
+	_, err := MakeBranchPRs(f, h.workDir(), c)
+	if err == nil || !strings.Contains(err.Error(), "more than 1 commit(s) behind") {
+		t.Fatalf("expected lag error, got %v", err)
+	}
+	if len(h.GitHub.PRs()) != 0 {
+		t.Errorf("sync submitted a PR despite the lagging mirror")
+	}
+
+	*f.UpstreamMirrorMaxCommits = 2
+	if _, err := MakeBranchPRs(f, h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanupStalePRs_E2E(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.pushBranch(h.Upstream, "main", h.Upstream, "release-branch.go1.20")
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/release-branch.go1.20")
+	h.pushBranch(h.Upstream, "main", h.Upstream, "release-branch.go1.21")
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/release-branch.go1.21")
+	h.commit(h.Upstream, "main", map[string]string{"a.go": "package a"})
+	h.commit(h.Upstream, "release-branch.go1.20", map[string]string{"b.go": "package b"})
+	h.commit(h.Upstream, "release-branch.go1.21", map[string]string{"c.go": "package c"})
+
+	c := h.entry()
+	c.BranchMap["release-branch.go1.20"] = "microsoft/?"
+	c.BranchMap["release-branch.go1.21"] = "microsoft/?"
+	c.AutoSyncBranches = []string{"main", "release-branch.go1.20"}
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+	// Like "./cmd/releasego sync", submit a PR for a branch that's in BranchMap but not in
+	// AutoSyncBranches.
+	release := *c
+	release.AutoSyncBranches = []string{"release-branch.go1.21"}
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), &release); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.GitHub.PRs()); n != 3 {
+		t.Fatalf("expected 3 PRs, got %v", n)
+	}
+
+	// The go1.20 release branch goes out of support.
+	c.AutoSyncBranches = []string{"main"}
+	delete(c.BranchMap, "release-branch.go1.20")
+	f := h.flags()
+	*f.DryRun = true
+	stale, err := CleanupStalePRs(f, h.workDir(), []ConfigEntry{*c}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0].HeadBranch != "dev/auto-sync/microsoft/release-branch.go1.20" || stale[0].Target != h.Target {
+		t.Fatalf("unexpected stale PRs: %+v", stale)
+	}
+	if pr := h.GitHub.PRs()[1]; pr.Closed || len(pr.Comments) != 0 {
+		t.Errorf("dry run changed PR: %+v", pr)
+	}
+
+	stale, err = CleanupStalePRs(h.flags(), h.workDir(), []ConfigEntry{*c}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 {
+		t.Fatalf("expected 1 stale PR, got %+v", stale)
+	}
+	prs := h.GitHub.PRs()
+	for _, i := range []int{0, 2} {
+		if prs[i].Closed || len(prs[i].Comments) != 0 {
+			t.Errorf("active PR was changed: %+v", prs[i])
+		}
+	}
+	if !prs[1].Closed || len(prs[1].Comments) != 1 || !strings.Contains(prs[1].Comments[0], "no longer configured") {
+		t.Errorf("stale PR wasn't closed with a comment: %+v", prs[1])
+	}
+	if h.refExists(h.Target, "refs/heads/dev/auto-sync/microsoft/release-branch.go1.20") {
+		t.Errorf("stale PR branch wasn't deleted")
+	}
+	for _, b := range []string{"microsoft/main", "microsoft/release-branch.go1.21"} {
+		if !h.refExists(h.Target, "refs/heads/dev/auto-sync/"+b) {
+			t.Errorf("active PR branch %v was deleted", b)
+		}
+	}
+
+	// Running again finds nothing.
+	stale, err = CleanupStalePRs(h.flags(), h.workDir(), []ConfigEntry{*c}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("expected no stale PRs, got %+v", stale)
+	}
+}
+
+func TestMakeBranchPRs_E2E_FakeForge(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Upstream, "main", map[string]string{"a.go": "package a"})
+
+	forge := &gitpr.FakeForge{}
+	f := h.flags()
+	f.NewForge = func(entry *ConfigEntry) (gitpr.Forge, error) { return forge, nil }
+
+	c := h.entry()
+	results, err := MakeBranchPRs(f, h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].PRCreated || results[0].PR == nil {
+		t.Fatalf("expected a created PR, got %+v", results)
+	}
+	prs := forge.PRs()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 PR, got %+v", prs)
+	}
+	if r := prs[0].Request; r.HeadBranch != "dev/auto-sync/microsoft/main" || r.BaseBranch != "microsoft/main" || r.Draft {
+		t.Errorf("unexpected PR request: %+v", r)
+	}
+	if !prs[0].Approved || !prs[0].AutoMerge {
+		t.Errorf("expected PR to be approved with auto-merge: %+v", prs[0])
+	}
+	if len(h.GitHub.PRs()) != 0 {
+		t.Errorf("expected no PRs in the fake GitHub API")
+	}
+
+	// A new upstream commit updates the existing PR.
+	h.commit(h.Upstream, "main", map[string]string{"b.go": "package b"})
+	results, err = MakeBranchPRs(f, h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].PRReused || results[0].PR.Number != prs[0].Number {
+		t.Fatalf("expected the PR to be reused, got %+v", results)
+	}
+	if n := len(forge.PRs()); n != 1 {
+		t.Errorf("expected 1 PR, got %v", n)
+	}
+
+	// The branch is removed from the config, so cleanup closes the PR with a comment.
+	c.AutoSyncBranches = nil
+	c.BranchMap = map[string]string{}
+	if _, err := CleanupStalePRs(f, h.workDir(), []ConfigEntry{*c}, os.Stdout); err != nil {
+		t.Fatal(err)
+	}
+	if pr := forge.PRs()[0]; !pr.Closed || len(pr.Comments) != 1 {
+		t.Errorf("expected PR to be closed with a comment: %+v", pr)
+	}
+}
+
+func TestMakeBranchPRs_E2E_VersionFiles(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	first := h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.setSubmodule(h.Target, "microsoft/main", "go", first)
+	h.commit(h.Target, "microsoft/main", map[string]string{"MICROSOFT_REVISION": "3"})
+	h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.18.2"})
+
+	c := h.entry()
+	c.SubmoduleTarget = "go"
+	c.GoVersionFileContent = "go1.18.3"
+	c.GoMicrosoftRevisionFileContent = "1"
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	prBranch := "dev/auto-sync/microsoft/main"
+	if got := h.show(h.Target, prBranch, "VERSION"); got != "go1.18.3" {
+		t.Errorf("VERSION = %q, want go1.18.3", got)
+	}
+	if h.exists(h.Target, prBranch, "MICROSOFT_REVISION") {
+		t.Errorf("MICROSOFT_REVISION should be removed for revision 1")
+	}
+}
+
+func TestMakeBranchPRs_E2E_ReusePR(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	h.commit(h.Upstream, "main", map[string]string{"a.txt": "a"})
+
+	c := h.entry()
+	if _, err := MakeBranchPRs(h.flags(), h.workDir(), c); err != nil {
+		t.Fatal(err)
+	}
+	latest := h.commit(h.Upstream, "main", map[string]string{"b.txt": "b"})
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prs := h.GitHub.PRs()
+	if len(prs) != 1 {
+		t.Fatalf("expected the existing PR to be reused, got %v PRs", len(prs))
+	}
+	if results[0].PR == nil || results[0].PR.Number != prs[0].Number {
+		t.Errorf("result PR %+v doesn't match existing PR %v", results[0].PR, prs[0].Number)
+	}
+	if prs[0].Approvals != 1 || prs[0].AutoMergeEnables != 2 {
+		t.Errorf("expected 1 approval and 2 auto-merge enables, got %+v", prs[0])
+	}
+	if !h.isAncestor(h.Target, latest, "dev/auto-sync/microsoft/main") {
+		t.Errorf("PR branch not updated with latest upstream commit %v", latest)
+	}
+}
+
+func TestMakeBranchPRs_E2E_UpToDate(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+
+	results, err := MakeBranchPRs(h.flags(), h.workDir(), h.entry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].PR != nil {
+		t.Fatalf("expected one result without a PR, got %+v", results)
+	}
+	if !results[0].UpToDate {
+		t.Errorf("expected result to be up to date")
+	}
+	if got, want := results[0].Commit, h.revParse(h.Target, "microsoft/main"); got != want {
+		t.Errorf("up to date commit = %v, want %v", got, want)
+	}
+	if len(h.GitHub.PRs()) != 0 {
+		t.Errorf("expected no PRs")
+	}
+}
+
+func TestMakeBranchPRs_E2E_Precheck(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	upstream := h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.18"})
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	h.setSubmodule(h.Target, "microsoft/main", "go", upstream)
+
+	c := h.entry()
+	c.UpstreamMirror = h.UpstreamMirror
+	c.SubmoduleTarget = "go"
+
+	// Every branch is up to date, so sync shouldn't even create its repository.
+	dir := h.workDir()
+	results, err := MakeBranchPRs(h.flags(), dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SyncResult{{
+		Upstream:       h.Upstream,
+		Target:         h.Target,
+		UpstreamBranch: "main",
+		TargetBranch:   "microsoft/main",
+		UpstreamCommit: upstream,
+		TargetCommit:   h.revParse(h.Target, "microsoft/main"),
+		Commit:         h.revParse(h.Target, "microsoft/main"),
+		UpToDate:       true,
+	}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("precheck results = %+v, want %+v", results, want)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected precheck to skip creating %v, got %v", dir, err)
+	}
+
+	// The full sync must agree.
+	f := h.flags()
+	*f.NoPrecheck = true
+	dir = h.workDir()
+	results, err = MakeBranchPRs(f, dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("full sync results = %+v, want %+v", results, want)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected full sync to create %v: %v", dir, err)
+	}
+
+	// The mirror is behind, so the common commit can't be found without fetching. The full sync
+	// finds out the branch is still up to date.
+	h.commit(h.Upstream, "main", map[string]string{"fix.go": "package fix"})
+	dir = h.workDir()
+	results, err = MakeBranchPRs(h.flags(), dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].UpToDate {
+		t.Fatalf("expected one up to date result, got %+v", results)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected full sync to create %v: %v", dir, err)
+	}
+
+	// Once the mirror catches up, the precheck finds the new commit and sync submits a PR.
+	h.pushBranch(h.Upstream, "main", h.UpstreamMirror, "main")
+	results, err = MakeBranchPRs(h.flags(), h.workDir(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].PR == nil {
+		t.Fatalf("expected one result with a PR, got %+v", results)
+	}
+}
+
+func TestMakeBranchPRs_E2E_PrecheckPinnedCommitTags(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	upstream := h.commit(h.Upstream, "main", map[string]string{"VERSION": "go1.21.0"})
+	h.git(h.Upstream, "tag", "go1.21.0", upstream)
+	h.setSubmodule(h.Target, "microsoft/main", "go", upstream)
+
+	// The branch is pinned, so the precheck doesn't need Upstream's branches, but it still needs
+	// Upstream's tags to find out the tag hasn't been pushed to Target yet.
+	c := h.entry()
+	c.SubmoduleTarget = "go"
+	c.SourceBranchLatestCommit = map[string]string{"main": upstream}
+	c.AutoTargetTags = []string{"go1.*"}
+	dir := h.workDir()
+	results, err := MakeBranchPRs(h.flags(), dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].UpToDate {
+		t.Errorf("expected up to date result, got %+v", results)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected full sync to create %v: %v", dir, err)
+	}
+	if got := h.revParse(h.Target, "refs/tags/go1.21.0"); got != upstream {
+		t.Errorf("go1.21.0 in Target = %v, want %v", got, upstream)
+	}
+}
+
+func TestMakePRs_E2E_JSONReport(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	h.commit(h.Upstream, "main", map[string]string{"README.md": "Hello"})
+	h.pushBranch(h.Upstream, "main", h.Target, "microsoft/main")
+	upstreamCommit := h.commit(h.Upstream, "main", map[string]string{"a.txt": "a"})
+
+	broken := h.entry()
+	broken.Upstream = filepath.Join(h.dir, "missing", "golang", "go")
+	f := h.flags()
+	*f.SyncConfig = h.writeConfig(*h.entry(), *broken)
+	*f.JSONReport = filepath.Join(h.dir, "report.json")
+
+	if err := MakePRs(f); err == nil {
+		t.Fatal("expected error from broken entry")
+	}
+
+	var report []SyncResult
+	if err := stringutil.ReadJSONFile(*f.JSONReport, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("expected 2 results, got %+v", report)
+	}
+	r := report[0]
+	if r.UpstreamBranch != "main" || r.TargetBranch != "microsoft/main" || r.UpstreamCommit != upstreamCommit {
+		t.Errorf("unexpected branch info: %+v", r)
+	}
+	if !r.PRCreated || r.PRReused || r.UpToDate || r.PR == nil || r.PR.URL == "" || r.Error != "" {
+		t.Errorf("expected a created PR: %+v", r)
+	}
+	if r.Commit != h.revParse(h.Target, "dev/auto-sync/microsoft/main") {
+		t.Errorf("commit %v isn't the pushed PR branch commit", r.Commit)
+	}
+	if r.TargetCommit != h.revParse(h.Target, "microsoft/main") {
+		t.Errorf("target commit %v isn't the Target branch commit", r.TargetCommit)
+	}
+	if r := report[1]; r.Upstream != broken.Upstream || r.Error == "" || r.PR != nil {
+		t.Errorf("expected an entry error: %+v", r)
+	}
+}
+
+func TestMakePRs_E2E_ReportIssueError(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	broken := h.entry()
+	broken.Upstream = filepath.Join(h.dir, "missing", "golang", "go")
+	f := h.flags()
+	*f.SyncConfig = h.writeConfig(*broken)
+	// Reporting to the issue fails, because the repo is missing. Writing the JSON report fails,
+	// because its dir is a file.
+	*f.ReportIssue = 1
+	*f.JSONReport = filepath.Join(*f.SyncConfig, "report.json")
+
+	err := MakePRs(f)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"completed sync with errors in 1 of 1 entries", broken.Upstream, "failed to write sync JSON report", "failed to report sync results to issue"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't contain %q: %v", want, err)
+		}
+	}
+}
+
+func TestMakePRs_E2E_Parallel(t *testing.T) {
+	t.Parallel()
+	h := newSyncHarness(t)
+	for _, b := range []string{"main", "release-branch.go1.18", "release-branch.go1.19"} {
+		h.commit(h.Upstream, b, map[string]string{"README.md": "Hello"})
+		h.pushBranch(h.Upstream, b, h.Target, "microsoft/"+b)
+		h.commit(h.Upstream, b, map[string]string{"branch.txt": b})
+	}
+
+	entries := make([]ConfigEntry, 0, 4)
+	for _, b := range []string{"main", "release-branch.go1.18", "missing", "release-branch.go1.19"} {
+		c := h.entry()
+		c.BranchMap = map[string]string{b: "microsoft/" + b}
+		c.AutoSyncBranches = []string{b}
+		entries = append(entries, *c)
+	}
+	f := h.flags()
+	*f.SyncConfig = h.writeConfig(entries...)
+	*f.JSONReport = filepath.Join(h.dir, "report.json")
+	*f.Parallel = 3
+
+	err := MakePRs(f)
+	if err == nil || !strings.Contains(err.Error(), "1 of 4 entries") || !strings.Contains(err.Error(), "sync 3/4") {
+		t.Fatalf("expected aggregated error for entry 3/4, got: %v", err)
+	}
+
+	var report []SyncResult
+	if err := stringutil.ReadJSONFile(*f.JSONReport, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 4 {
+		t.Fatalf("expected 4 results, got %+v", report)
+	}
+	for i, r := range report {
+		if i == 2 {
+			if r.Error == "" {
+				t.Errorf("expected error in result %v: %+v", i, r)
+			}
+			continue
+		}
+		if want := "microsoft/" + entries[i].AutoSyncBranches[0]; r.TargetBranch != want || !r.PRCreated {
+			t.Errorf("result %v: expected PR for %v, got %+v", i, want, r)
+		}
+	}
+	if got := len(h.GitHub.PRs()); got != 3 {
+		t.Errorf("expected 3 PRs, got %v", got)
+	}
+}
+
+// syncHarness is a set of bare repos and a fake GitHub API that a sync test can run against.
+type syncHarness struct {
+	t   *testing.T
+	dir string
+
+	// Upstream, UpstreamMirror, and Target are paths to bare repos. The paths end in
+	// "/{owner}/{repo}", so they can be parsed as if they're GitHub URLs.
+	Upstream, UpstreamMirror, Target string
+
+	GitHub *fakeGitHub
+
+	// scratch maps a bare repo path to a non-bare clone used to make commits.
+	scratch map[string]string
+	work    int
+}
+
+func newSyncHarness(t *testing.T) *syncHarness {
+	d := t.TempDir()
+	h := &syncHarness{
+		t:              t,
+		dir:            d,
+		Upstream:       filepath.Join(d, "upstream", "golang", "go"),
+		UpstreamMirror: filepath.Join(d, "mirror", "golang", "go"),
+		Target:         filepath.Join(d, "target", "microsoft", "go"),
+		GitHub:         newFakeGitHub(t),
+		scratch:        make(map[string]string),
+	}
+	for _, r := range []string{h.Upstream, h.UpstreamMirror, h.Target} {
+		h.git("", "init", "--bare", r)
+	}
+	h.GitHub.repos["microsoft/go"] = h.Target
+	return h
+}
+
+// entry returns a basic config entry that syncs "main" to "microsoft/main".
+func (h *syncHarness) entry() *ConfigEntry {
+	return &ConfigEntry{
+		Upstream: h.Upstream,
+		Target:   h.Target,
+		BranchMap: map[string]string{
+			"main": "microsoft/main",
+		},
+		AutoSyncBranches: []string{"main"},
+		MainBranch:       "microsoft/main",
+	}
+}
+
+// flags returns flags for a non-dry-run sync that submits PRs to the fake GitHub API.
+func (h *syncHarness) flags() *Flags {
+	falseBool := false
+	none := string(GitAuthNone)
+	var emptyString string
+	user, pat, reviewerPAT := "microsoft-golang-bot", "fake-pat", "fake-reviewer-pat"
+	tempGitDir := filepath.Join(h.dir, "temp-git")
+	parallel := 1
+	return &Flags{
+		DryRun:                   &falseBool,
+		InitialCloneDir:          &emptyString,
+		GitHubUser:               &user,
+		GitHubPAT:                &pat,
+		GitHubPATReviewer:        &reviewerPAT,
+		AzDODncengPAT:            &emptyString,
+		AzDODncengPATReviewer:    &emptyString,
+		SyncConfig:               new(string),
+		TempGitDir:               &tempGitDir,
+		CreateBranches:           &falseBool,
+		GitAuthString:            &none,
+		JSONReport:               new(string),
+		Parallel:                 &parallel,
+		ConflictReportDir:        new(string),
+		ConflictPR:               new(string),
+		DryRunPatchDir:           new(string),
+		InputBundleDir:           new(string),
+		OutputBundleDir:          new(string),
+		UpstreamMirrorMaxCommits: new(int),
+		UpstreamMirrorMaxLag:     new(time.Duration),
+		ReportRepo:               new(string),
+		ReportIssue:              new(int),
+		ReportMention:            new(string),
+		NoPrecheck:               new(bool),
+		NewForge: func(entry *ConfigEntry) (gitpr.Forge, error) {
+			target, err := gitpr.ParseRemoteURL(entry.Target)
+			if err != nil {
+				return nil, err
+			}
+			head, err := gitpr.ParseRemoteURL(entry.PRBranchStorageRepo())
+			if err != nil {
+				return nil, err
+			}
+			return &gitpr.GitHubForge{
+				Target:      target,
+				Head:        head,
+				APIURL:      h.GitHub.URL(),
+				User:        user,
+				PAT:         pat,
+				ReviewerPAT: reviewerPAT,
+			}, nil
+		},
+	}
+}
+
+// writeConfig writes entries to a new sync config file and returns its path.
+func (h *syncHarness) writeConfig(entries ...ConfigEntry) string {
+	h.work++
+	p := filepath.Join(h.dir, fmt.Sprintf("sync-config-%v.json", h.work))
+	if err := stringutil.WriteJSONFile(p, entries); err != nil {
+		h.t.Fatal(err)
+	}
+	return p
+}
+
+// workDir returns a new path for sync to use as its temporary repository.
+func (h *syncHarness) workDir() string {
+	h.work++
+	return filepath.Join(h.dir, "work", fmt.Sprint(h.work))
+}
+
+// commit writes files to branch in the bare repo, commits, and pushes. Creates the branch if it
+// doesn't exist. Returns the new commit hash.
+func (h *syncHarness) commit(repo, branch string, files map[string]string) string {
+	s := h.checkout(repo, branch)
+	for name, content := range files {
+		p := filepath.Join(s, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			h.t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o666); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+	h.git(s, "add", "-A")
+	h.git(s, "commit", "-m", fmt.Sprintf("Update %v files", len(files)))
+	h.git(s, "push", "origin", "HEAD:refs/heads/"+branch)
+	return h.revParse(repo, branch)
+}
+
+// setSubmodule sets the submodule at path to commit in branch, creating the submodule if
+// necessary, and pushes the result.
+func (h *syncHarness) setSubmodule(repo, branch, path, commit string) {
+	s := h.checkout(repo, branch)
+	modules := fmt.Sprintf("[submodule %q]\n\tpath = %v\n\turl = %v\n", path, path, h.Upstream)
+	if err := os.WriteFile(filepath.Join(s, ".gitmodules"), []byte(modules), 0o666); err != nil {
+		h.t.Fatal(err)
+	}
+	h.git(s, "add", ".gitmodules")
+	h.git(s, "update-index", "--add", "--cacheinfo", "160000,"+commit+","+path)
+	h.git(s, "commit", "-m", "Update submodule")
+	h.git(s, "push", "origin", "HEAD:refs/heads/"+branch)
+}
+
+// pushBranch copies a branch from one bare repo to another.
+func (h *syncHarness) pushBranch(src, srcBranch, dst, dstBranch string) {
+	h.git(src, "push", "--force", dst, "refs/heads/"+srcBranch+":refs/heads/"+dstBranch)
+}
+
+// checkout returns a scratch clone of repo with branch checked out and up to date.
+func (h *syncHarness) checkout(repo, branch string) string {
+	s, ok := h.scratch[repo]
+	if !ok {
+		s = filepath.Join(h.dir, "scratch", fmt.Sprint(len(h.scratch)))
+		h.git("", "init", s)
+		h.git(s, "remote", "add", "origin", repo)
+		h.scratch[repo] = s
+	}
+	h.git(s, "fetch", "--no-tags", "--prune", "--recurse-submodules=no", "origin", "+refs/heads/*:refs/remotes/origin/*")
+	if _, err := gitcmd.RevParse(s, "refs/remotes/origin/"+branch); err == nil {
+		h.git(s, "checkout", "-f", "-B", branch, "refs/remotes/origin/"+branch)
+	} else {
+		h.git(s, "checkout", "-f", "--orphan", branch)
+		h.git(s, "rm", "-rf", "--ignore-unmatch", "-q", ".")
+	}
+	return s
+}
+
+func (h *syncHarness) revParse(repo, rev string) string {
+	out, err := gitcmd.RevParse(repo, rev)
+	if err != nil {
+		h.t.Fatalf("unable to rev-parse %v in %v: %v", rev, repo, err)
+	}
+	return out
+}
+
+func (h *syncHarness) show(repo, rev, path string) string {
+	out, err := gitcmd.Show(repo, rev+":"+path)
+	if err != nil {
+		h.t.Fatalf("unable to show %v:%v in %v: %v", rev, path, repo, err)
+	}
+	return out
+}
+
+func (h *syncHarness) exists(repo, rev, path string) bool {
+	_, err := gitcmd.CombinedOutput(repo, "cat-file", "-e", rev+":"+path)
+	return err == nil
+}
+
+func (h *syncHarness) refExists(repo, ref string) bool {
+	_, err := gitcmd.CombinedOutput(repo, "rev-parse", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+func (h *syncHarness) gitlink(repo, rev, path string) string {
+	out, err := gitcmd.CombinedOutput(repo, "ls-tree", rev, path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	// Format, from Git docs: "<mode> SP <type> SP <object> TAB <file>"
+	fields := strings.Fields(out)
+	if len(fields) < 3 || fields[1] != "commit" {
+		h.t.Fatalf("%v:%v is not a submodule: %q", rev, path, out)
+	}
+	return fields[2]
+}
+
+func (h *syncHarness) isAncestor(repo, ancestor, rev string) bool {
+	return gitcmd.Run(repo, "merge-base", "--is-ancestor", ancestor, rev) == nil
+}
+
+func (h *syncHarness) git(dir string, args ...string) {
+	if err := gitcmd.Run(dir, args...); err != nil {
+		h.t.Fatalf("git %v failed: %v", args, err)
+	}
+}
+
+// fakeGitHub serves the subset of the GitHub REST and GraphQL APIs used by gitpr.
+type fakeGitHub struct {
+	server *httptest.Server
+
+	mu  gosync.Mutex
+	prs []*fakeGitHubPR
+	// repos maps "{owner}/{repo}" to a bare repo that serves the contents API.
+	repos map[string]string
+}
+
+// fakeGitHubPR is the state of a PR submitted to fakeGitHub.
+type fakeGitHubPR struct {
+	gitpr.GitHubRequest
+	Number int
+	// OwnerRepo is the "{owner}/{repo}" the PR was submitted to.
+	OwnerRepo string
+
+	Approvals        int
+	AutoMergeEnables int
+	Comments         []string
+	Closed           bool
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	g := &fakeGitHub{repos: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/", g.handlePulls)
+	mux.HandleFunc("/graphql", g.handleGraphQL)
+	g.server = httptest.NewServer(mux)
+	t.Cleanup(g.server.Close)
+	return g
+}
+
+// URL is the base API URL of the server.
+func (g *fakeGitHub) URL() string {
+	return g.server.URL
+}
+
+// PRs returns a copy of the PRs that have been submitted.
+func (g *fakeGitHub) PRs() []fakeGitHubPR {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prs := make([]fakeGitHubPR, 0, len(g.prs))
+	for _, pr := range g.prs {
+		prs = append(prs, *pr)
+	}
+	return prs
+}
+
+func (g *fakeGitHub) handlePulls(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/repos/")
+	if parts := strings.SplitN(path, "/", 4); len(parts) == 4 && parts[2] == "contents" && r.Method == http.MethodGet {
+		g.handleContents(w, r, parts[0]+"/"+parts[1], parts[3])
+		return
+	}
+	if !strings.HasSuffix(path, "/pulls") || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	ownerRepo := strings.TrimSuffix(path, "/pulls")
+	var req gitpr.GitHubRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, pr := range g.prs {
+		if !pr.Closed && pr.OwnerRepo == ownerRepo && pr.Head == req.Head && pr.Base == req.Base {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"message": "Validation Failed",
+				"errors": []map[string]string{
+					{"message": "A pull request already exists for " + req.Head + "."},
+				},
+			})
+			return
+		}
+	}
+	pr := &fakeGitHubPR{
+		GitHubRequest: req,
+		Number:        len(g.prs) + 1,
+		OwnerRepo:     ownerRepo,
+	}
+	g.prs = append(g.prs, pr)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"html_url": pr.htmlURL(),
+		"node_id":  pr.nodeID(),
+		"number":   pr.Number,
+	})
+}
+
+// handleContents serves the contents API by reading the tree of the repo's bare repo. Only the
+// "type" and "sha" of the entry are included in the response.
+func (g *fakeGitHub) handleContents(w http.ResponseWriter, r *http.Request, ownerRepo, path string) {
+	g.mu.Lock()
+	dir, ok := g.repos[ownerRepo]
+	g.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	o, err := exec.Command("git", "-C", dir, "ls-tree", r.URL.Query().Get("ref"), "--", path).Output()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// Format: "<mode> SP <type> SP <object> TAB <file>"
+	fields := strings.Fields(string(o))
+	if len(fields) < 3 {
+		http.NotFound(w, r)
+		return
+	}
+	switch fields[1] {
+	case "commit":
+		writeJSON(w, http.StatusOK, map[string]string{"type": "submodule", "sha": fields[2]})
+	case "tree":
+		writeJSON(w, http.StatusOK, []interface{}{})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"type": "file", "sha": fields[2]})
+	}
+}
+
+func (g *fakeGitHub) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string
+		Variables map[string]interface{}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch {
+	case strings.Contains(req.Query, "pullRequests("):
+		nodes := []interface{}{}
+		for _, pr := range g.prs {
+			headOwner, headBranch, _ := strings.Cut(pr.Head, ":")
+			if pr.Closed {
+				continue
+			}
+			// Without a head branch filter, this is a query for all the user's open PRs.
+			if headRefName, ok := req.Variables["headRefName"]; ok && (headBranch != headRefName || pr.Base != req.Variables["baseRefName"]) {
+				continue
+			}
+			baseOwner, _, _ := strings.Cut(pr.OwnerRepo, "/")
+			nodes = append(nodes, map[string]interface{}{
+				"title":               pr.Title,
+				"id":                  pr.nodeID(),
+				"number":              pr.Number,
+				"url":                 pr.htmlURL(),
+				"headRefName":         headBranch,
+				"baseRefName":         pr.Base,
+				"headRepositoryOwner": map[string]string{"login": headOwner},
+				"baseRepository": map[string]interface{}{
+					"owner":         map[string]string{"login": baseOwner},
+					"nameWithOwner": pr.OwnerRepo,
+				},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"user": map[string]interface{}{
+					"pullRequests": map[string]interface{}{
+						"nodes":    nodes,
+						"pageInfo": map[string]bool{"hasNextPage": false},
+					},
+				},
+			},
+		})
+		return
+
+	case strings.Contains(req.Query, "addPullRequestReview("):
+		g.updatePR(w, req.Variables, func(pr *fakeGitHubPR) { pr.Approvals++ })
+	case strings.Contains(req.Query, "enablePullRequestAutoMerge("):
+		g.updatePR(w, req.Variables, func(pr *fakeGitHubPR) { pr.AutoMergeEnables++ })
+	case strings.Contains(req.Query, "closePullRequest("):
+		g.updatePR(w, req.Variables, func(pr *fakeGitHubPR) { pr.Closed = true })
+	case strings.Contains(req.Query, "addComment("):
+		g.updatePR(w, req.Variables, func(pr *fakeGitHubPR) { pr.Comments = append(pr.Comments, req.Variables["body"].(string)) })
+	default:
+		http.Error(w, "unsupported GraphQL query", http.StatusBadRequest)
+	}
+}
+
+// updatePR finds the PR with the "nodeID" variable and updates it with fn. Must be called with
+// g.mu held.
+func (g *fakeGitHub) updatePR(w http.ResponseWriter, variables map[string]interface{}, fn func(pr *fakeGitHubPR)) {
+	for _, pr := range g.prs {
+		if pr.nodeID() == variables["nodeID"] {
+			fn(pr)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{}})
+			return
+		}
+	}
+	http.Error(w, "PR not found", http.StatusNotFound)
+}
+
+func (pr *fakeGitHubPR) nodeID() string {
+	return fmt.Sprintf("PR_%v", pr.Number)
+}
+
+func (pr *fakeGitHubPR) htmlURL() string {
+	return fmt.Sprintf("https://github.com/%v/pull/%v", pr.OwnerRepo, pr.Number)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		panic(err)
+	}
+}
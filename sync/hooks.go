@@ -0,0 +1,95 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+// maxHookErrorOutput is the maximum number of bytes of hook output to include in a hook error. The
+// full output is in the log.
+const maxHookErrorOutput = 8000
+
+// HookError is the error returned when a hook command fails.
+type HookError struct {
+	// Stage is "pre-merge" or "post-merge".
+	Stage string
+	Hook  Hook
+	Err   error
+	// Output is the combined stdout and stderr of the command, truncated to the last
+	// maxHookErrorOutput bytes.
+	Output string
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%v hook %q failed: %v\n%v", e.Stage, e.Hook.DisplayName(), e.Err, e.Output)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// runHooks runs each hook in the Git repository at dir in order, then stages the changes they made.
+// Returns *HookError if a hook fails.
+func runHooks(out io.Writer, dir, stage string, hooks []Hook, entry *ConfigEntry, b *gitpr.SyncPRRefSet) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	env := append(
+		os.Environ(),
+		"SYNC_HOOK_STAGE="+stage,
+		"SYNC_UPSTREAM="+entry.Upstream,
+		"SYNC_UPSTREAM_BRANCH="+b.UpstreamName,
+		"SYNC_TARGET="+entry.Target,
+		"SYNC_TARGET_BRANCH="+b.Name,
+	)
+	for _, h := range hooks {
+		fmt.Fprintf(out, "---- Running %v hook %q: %v\n", stage, h.DisplayName(), h.Command)
+		if len(h.Command) == 0 {
+			return &HookError{Stage: stage, Hook: h, Err: errors.New("no command")}
+		}
+		var output bytes.Buffer
+		c := exec.Command(h.Command[0], h.Command[1:]...)
+		c.Dir = dir
+		c.Env = env
+		c.Stdout = io.MultiWriter(out, &output)
+		c.Stderr = c.Stdout
+		if err := c.Run(); err != nil {
+			o := output.String()
+			if len(o) > maxHookErrorOutput {
+				o = "... (Truncated: see the log for the full output.)\n" + o[len(o)-maxHookErrorOutput:]
+			}
+			return &HookError{Stage: stage, Hook: h, Err: err, Output: o}
+		}
+	}
+	return stageHookChanges(out, dir)
+}
+
+// stageHookChanges stages all changes in the worktree of the repository at dir, except submodules.
+// Sync sets submodule commits directly in the index without checking them out, so staging the
+// worktree's submodule dirs would revert or remove them.
+func stageHookChanges(out io.Writer, dir string) error {
+	files, err := gitOutput(out, dir, "ls-files", "--stage")
+	if err != nil {
+		return err
+	}
+	args := []string{"add", "--all", "--", ":/"}
+	for _, line := range strings.Split(string(files), "\n") {
+		// Format: "<mode> SP <object> SP <stage> TAB <file>"
+		info, path, ok := strings.Cut(line, "\t")
+		if ok && strings.HasPrefix(info, "160000 ") {
+			args = append(args, ":(exclude,top,literal)"+path)
+		}
+	}
+	_, err = gitOutput(out, dir, args...)
+	return err
+}
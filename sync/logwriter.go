@@ -0,0 +1,65 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"bytes"
+	"io"
+	gosync "sync"
+)
+
+// prefixWriter writes each line to an underlying writer with a prefix, so the interleaved output of
+// concurrent sync entries can be told apart. Writes to the underlying writer are serialized by a
+// mutex that may be shared between multiple prefixWriters, and only complete lines are written.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *gosync.Mutex
+	prefix []byte
+
+	// buf holds the incomplete last line written so far. Only accessed while holding mu.
+	buf []byte
+}
+
+func newPrefixWriter(w io.Writer, mu *gosync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, mu: mu, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes the incomplete last line, if any, followed by a newline.
+func (p *prefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	if _, err := p.w.Write(p.prefix); err != nil {
+		return err
+	}
+	_, err := p.w.Write(line)
+	return err
+}
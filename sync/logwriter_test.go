@@ -0,0 +1,45 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"strings"
+	gosync "sync"
+	"testing"
+)
+
+func Test_prefixWriter(t *testing.T) {
+	var b strings.Builder
+	var mu gosync.Mutex
+	one := newPrefixWriter(&b, &mu, "[1/2] ")
+	two := newPrefixWriter(&b, &mu, "[2/2] ")
+
+	writes := []struct {
+		w *prefixWriter
+		s string
+	}{
+		{one, "Hello, "},
+		{two, "first line\nsecond "},
+		{one, "world!\n"},
+		{two, "line\nno newline"},
+	}
+	for _, w := range writes {
+		if _, err := w.w.Write([]byte(w.s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, w := range []*prefixWriter{one, two} {
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "[2/2] first line\n" +
+		"[1/2] Hello, world!\n" +
+		"[2/2] second line\n" +
+		"[2/2] no newline\n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// MirrorOptions configures a standalone mirror of a config entry's Upstream to its MirrorTarget.
+type MirrorOptions struct {
+	// Include and Exclude are glob patterns matched against ref names without the "refs/" prefix,
+	// like "heads/release-branch.go*" or "tags/go1.*". A ref is mirrored if it matches an Include
+	// pattern and no Exclude pattern. If Include is empty, the entry's AutoSyncBranches,
+	// AutoMirrorBranches, and AutoMirrorTags are included.
+	Include []string
+	Exclude []string
+	// Prune deletes refs from MirrorTarget that are selected by the patterns but don't exist in
+	// Upstream.
+	Prune bool
+}
+
+// MirrorResult is the result of mirroring a config entry.
+type MirrorResult struct {
+	Upstream     string
+	MirrorTarget string
+	// Pushed and Pruned are the full names of the refs that were updated and deleted in
+	// MirrorTarget. In a dry run, these are the refs that would have been changed.
+	Pushed []string
+	Pruned []string
+	// Drift lists the selected refs that are still different between Upstream and MirrorTarget
+	// after mirroring. Not checked in a dry run.
+	Drift []MirrorDrift
+}
+
+// MirrorDrift is a ref that doesn't match between Upstream and MirrorTarget.
+type MirrorDrift struct {
+	Ref string
+	// UpstreamCommit and MirrorCommit are the object each repository's ref points at, or empty
+	// string if the ref doesn't exist.
+	UpstreamCommit string
+	MirrorCommit   string
+}
+
+func (d MirrorDrift) String() string {
+	show := func(s string) string {
+		if s == "" {
+			return "(missing)"
+		}
+		return s
+	}
+	return fmt.Sprintf("%v: upstream %v, mirror %v", d.Ref, show(d.UpstreamCommit), show(d.MirrorCommit))
+}
+
+// mirrorFetchNamespace is the local ref namespace that upstream refs are fetched into before being
+// pushed to the mirror.
+const mirrorFetchNamespace = "refs/mirror/"
+
+// MirrorEntry mirrors the refs selected by opts from entry's Upstream to its MirrorTarget, using a
+// new Git repository at dir. After mirroring, checks that the selected refs match in both repos.
+func MirrorEntry(f *Flags, dir string, entry *ConfigEntry, opts *MirrorOptions, out io.Writer) (*MirrorResult, error) {
+	if entry.MirrorTarget == "" {
+		return nil, fmt.Errorf("entry with Upstream %v has no MirrorTarget", entry.Upstream)
+	}
+	auther, err := f.ParseAuth()
+	if err != nil {
+		return nil, err
+	}
+	remotes := f.newRemoteSet(auther, dir)
+
+	selected := func(ref string) (bool, error) {
+		name := strings.TrimPrefix(ref, "refs/")
+		var match bool
+		var err error
+		if len(opts.Include) == 0 {
+			match, err = entryMirrorsRef(entry, ref)
+		} else {
+			match, err = matchAny(opts.Include, name)
+		}
+		if err != nil || !match {
+			return false, err
+		}
+		excluded, err := matchAny(opts.Exclude, name)
+		return !excluded, err
+	}
+
+	if err := run(out, exec.Command("git", "init", "--quiet", dir)); err != nil {
+		return nil, err
+	}
+	upstreamURL := remotes.fetchURL(entry.Upstream)
+	mirrorURL, err := remotes.pushURL(out, entry.MirrorTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamRefs, err := lsRemote(out, dir, upstreamURL)
+	if err != nil {
+		return nil, err
+	}
+	mirrorRefs, err := lsRemote(out, dir, mirrorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &MirrorResult{Upstream: entry.Upstream, MirrorTarget: entry.MirrorTarget}
+	rewritten := &RewrittenTagError{Repo: entry.MirrorTarget}
+	fetch := []string{"fetch", "--no-tags", upstreamURL}
+	push := []string{"push", mirrorURL}
+	for _, ref := range sortedKeys(upstreamRefs) {
+		ok, err := selected(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || upstreamRefs[ref] == mirrorRefs[ref] {
+			continue
+		}
+		if strings.HasPrefix(ref, "refs/tags/") && mirrorRefs[ref] != "" {
+			rewritten.Tags = append(rewritten.Tags, MirrorDrift{Ref: ref, UpstreamCommit: upstreamRefs[ref], MirrorCommit: mirrorRefs[ref]})
+			continue
+		}
+		local := mirrorFetchNamespace + strings.TrimPrefix(ref, "refs/")
+		fetch = append(fetch, "+"+ref+":"+local)
+		push = append(push, local+":"+ref)
+		r.Pushed = append(r.Pushed, ref)
+	}
+	if len(rewritten.Tags) > 0 {
+		return nil, rewritten
+	}
+	if opts.Prune {
+		for _, ref := range sortedKeys(mirrorRefs) {
+			if _, ok := upstreamRefs[ref]; ok {
+				continue
+			}
+			ok, err := selected(ref)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				push = append(push, ":"+ref)
+				r.Pruned = append(r.Pruned, ref)
+			}
+		}
+	}
+
+	if len(r.Pushed) == 0 && len(r.Pruned) == 0 {
+		fmt.Fprintf(out, "---- Mirror %v is up to date with %v.\n", entry.MirrorTarget, entry.Upstream)
+	} else {
+		if len(r.Pushed) > 0 {
+			if err := run(out, newDirGitCmd(dir, fetch...)); err != nil {
+				return nil, err
+			}
+		}
+		if *f.DryRun {
+			push = append(push, "-n")
+		}
+		if err := run(out, newDirGitCmd(dir, push...)); err != nil {
+			return nil, err
+		}
+		if !*f.DryRun {
+			if err := remotes.pushed(out, entry.MirrorTarget); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if *f.DryRun {
+		fmt.Fprintln(out, "---- Dry run: skipping mirror verification.")
+		return r, nil
+	}
+
+	// Check the result. A ref may have been updated upstream during the mirror, or pushing to the
+	// mirror may have been partially blocked by the server. Either way, it's worth reporting.
+	mirrorRefs, err = lsRemote(out, dir, mirrorURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range sortedUnion(upstreamRefs, mirrorRefs) {
+		ok, err := selected(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || upstreamRefs[ref] == mirrorRefs[ref] {
+			continue
+		}
+		if upstreamRefs[ref] == "" && !opts.Prune {
+			// Extra refs in the mirror are expected unless pruning.
+			continue
+		}
+		r.Drift = append(r.Drift, MirrorDrift{Ref: ref, UpstreamCommit: upstreamRefs[ref], MirrorCommit: mirrorRefs[ref]})
+	}
+	return r, nil
+}
+
+// lsRemote returns the branches and tags in the remote repository at url, mapped to the object
+// each ref points at.
+func lsRemote(out io.Writer, dir, url string) (map[string]string, error) {
+	o, err := gitOutput(out, dir, "ls-remote", "--heads", "--tags", url)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(string(o), "\n") {
+		if line == "" {
+			continue
+		}
+		hash, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected 'git ls-remote' line: %q", line)
+		}
+		// Skip the peeled commit of annotated tags: mirroring the tag object mirrors it, too.
+		if strings.HasSuffix(ref, "^{}") {
+			continue
+		}
+		refs[ref] = hash
+	}
+	return refs, nil
+}
+
+func newDirGitCmd(dir string, args ...string) *exec.Cmd {
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	return c
+}
+
+// entryMirrorsRef reports whether sync mirrors ref, a full ref name, from entry's Upstream to its
+// MirrorTarget: a branch in AutoSyncBranches or AutoMirrorBranches, or a tag in AutoMirrorTags.
+// Matches the patterns the same way sync does.
+func entryMirrorsRef(entry *ConfigEntry, ref string) (bool, error) {
+	if name := strings.TrimPrefix(ref, "refs/heads/"); name != ref {
+		return entryMirrorsBranch(entry, name), nil
+	}
+	if name := strings.TrimPrefix(ref, "refs/tags/"); name != ref {
+		return matchAny(entry.AutoMirrorTags, name)
+	}
+	return false, nil
+}
+
+// entryMirrorsBranch reports whether sync mirrors the upstream branch name: whether it's in entry's
+// AutoSyncBranches, or matches an AutoMirrorBranches refspec pattern. See mirrorBranches.
+func entryMirrorsBranch(entry *ConfigEntry, name string) bool {
+	for _, b := range entry.AutoSyncBranches {
+		if b == name {
+			return true
+		}
+	}
+	for _, pattern := range entry.AutoMirrorBranches {
+		if refspecPatternMatch(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		match, err := path.Match(p, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob pattern %q: %w", p, err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func sortedUnion(a, b map[string]string) []string {
+	keys := sortedKeys(a)
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
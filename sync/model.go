@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+
+	"github.com/microsoft/go-infra/stringutil"
 )
 
 // ConfigEntry is one entry in a sync config file. The file contains a JSON list of objects that
@@ -30,12 +32,14 @@ type ConfigEntry struct {
 	// Upstream.
 	UpstreamMirror string
 
-	// Target is the GitHub repository to merge into, then submit the PR onto. It must be an https
-	// github.com URL. Other arguments passed to the sync tool may transform this URL into a
-	// different URL that works with authentication.
+	// Target is the repository to merge into, then submit the PR onto. It must be an https
+	// github.com URL or an https Azure DevOps Repos URL. The kind of URL determines which forge API
+	// sync uses to submit the PR. Other arguments passed to the sync tool may transform this URL
+	// into a different URL that works with authentication.
 	Target string
-	// Head is the GitHub repository to store the merged branch on. If not specified, defaults to
-	// the value of Target. This can be used to run the PR from a GitHub fork.
+	// Head is the repository to store the merged branch on. If not specified, defaults to the value
+	// of Target. This can be used to run the PR from a GitHub fork. Azure DevOps Targets don't
+	// support a different Head.
 	Head string
 	// MirrorTarget	is an optional Git repository to push the upstream branch to. All mirroring
 	// operations must succeed before sync continues with this sync config entry. The mirror target
@@ -60,6 +64,19 @@ type ConfigEntry struct {
 	// ignores this list to keep release activity separate from unrelated branch mirroring.
 	AutoMirrorBranches []string
 
+	// AutoMirrorTags is a list of glob patterns of upstream tag names, like "go1.*", to push to
+	// MirrorTarget. Tags are pushed before any branch is synced. "./cmd/releasego sync" ignores
+	// this list, like AutoMirrorBranches.
+	//
+	// Upstream release tags are never expected to change. If a tag already exists in the
+	// destination and points at a different object than in Upstream, sync fails rather than
+	// overwriting it.
+	AutoMirrorTags []string
+	// AutoTargetTags is like AutoMirrorTags, but pushes the tags to Target, which must be a fork of
+	// Upstream. If a tag already exists in Target and points at a different object than in
+	// Upstream, sync fails rather than overwriting it.
+	AutoTargetTags []string
+
 	// MainBranch is the main/master branch of the target repository. When creating a new release
 	// branch, it is forked from the tip of this branch.
 	MainBranch string
@@ -76,11 +93,40 @@ type ConfigEntry struct {
 	// some cases this isn't possible. In these cases, Target has in-place modifications that must
 	// be auto-resolved during the sync process.
 	AutoResolveTarget []string
+	// AutoResolve is a list of rules that resolve merge conflicts in files matching a pattern. When
+	// the merge from Upstream conflicts, sync resolves each conflicting file using the first rule
+	// that matches it, then lists the auto-resolved files in the PR description. Unlike
+	// AutoResolveTarget, these rules only apply to files that have conflicts.
+	AutoResolve []AutoResolveRule
 	// SubmoduleTarget is the path of a submodule in the Target repo to update with the latest
 	// version of Upstream and UpstreamMirror (if specified). If this option is not specified
 	// (default), that indicates the entire Upstream repository should be merged into the Target
 	// repository.
 	SubmoduleTarget string
+	// SubmoduleTargetRepo is the Git repository to push commits of SubmoduleTarget to. Sync makes
+	// these commits when an AdditionalSubmodules path is inside SubmoduleTarget: the nested
+	// submodule is updated by a commit on top of the upstream commit. The URL of SubmoduleTarget in
+	// .gitmodules must be able to fetch from this repository. Required if a path is nested.
+	SubmoduleTargetRepo string
+	// AdditionalSubmodules is a list of other submodules to update in the same commit and PR as
+	// SubmoduleTarget. Each one tracks its own upstream repository. Use this when submodules must
+	// move in lockstep, either siblings in the Target repo or submodules nested inside
+	// SubmoduleTarget. Requires SubmoduleTarget. The branch is up to date only if every submodule
+	// is up to date.
+	AdditionalSubmodules []AdditionalSubmodule
+
+	// PreMergeHooks are commands that sync runs in order in the root of its temporary clone of
+	// each Target branch before the merge from Upstream (or the submodule update). Their changes
+	// are committed before the merge. Use hooks to update files that depend on the upstream code,
+	// like go.sum files or generated docs. Submodules aren't checked out.
+	//
+	// Hooks run with these environment variables: SYNC_HOOK_STAGE ("pre-merge" or "post-merge"),
+	// SYNC_UPSTREAM, SYNC_UPSTREAM_BRANCH, SYNC_TARGET, and SYNC_TARGET_BRANCH. If a hook fails,
+	// the branch isn't synced and its sync result contains the hook's output.
+	PreMergeHooks []Hook
+	// PostMergeHooks are like PreMergeHooks, but run after the merge from Upstream (or the
+	// submodule update). Their changes are included in the merge commit.
+	PostMergeHooks []Hook
 
 	// GoVersionFileContent	is empty, or the Go version that the microsoft/go build should use
 	// after the sync. Should be in the upstream format, e.g. go1.17.10 and go1.18. Sync examines
@@ -94,6 +140,93 @@ type ConfigEntry struct {
 	GoMicrosoftRevisionFileContent string
 }
 
+// AutoResolveRule is a rule that resolves merge conflicts in files matching a pattern.
+type AutoResolveRule struct {
+	// Pattern is a glob pattern matched against the slash-separated path of a conflicting file,
+	// relative to the root of the repository. If the pattern doesn't contain "/", it is matched
+	// against the file name instead, in any directory.
+	Pattern string
+	// Strategy is the way to resolve the conflict: "ours" keeps the Target version of the file,
+	// "theirs" takes the Upstream version, "union" keeps the lines from both sides, and "resolver"
+	// runs the Go func registered with RegisterResolver as Resolver.
+	Strategy ResolveStrategy
+	// Resolver is the name of the registered resolver to run if Strategy is "resolver".
+	Resolver string
+}
+
+// AdditionalSubmodule is a submodule to update along with SubmoduleTarget. See
+// ConfigEntry.AdditionalSubmodules.
+type AdditionalSubmodule struct {
+	// Path is the path of the submodule in the Target repo. If it's inside SubmoduleTarget, the
+	// submodule is updated in a new commit of SubmoduleTarget. See
+	// ConfigEntry.SubmoduleTargetRepo.
+	Path string
+	// Upstream is the Git repository to take updates from.
+	Upstream string
+	// UpstreamMirror is an optional mirror of Upstream. Like ConfigEntry.UpstreamMirror, the
+	// submodule is only updated to a commit that is in both.
+	UpstreamMirror string
+	// Branch is the branch in Upstream to update the submodule to. If empty, uses the branch with
+	// the same name as the branch being synced from the config entry's Upstream.
+	Branch string
+}
+
+// UpstreamBranch returns the branch in s.Upstream that corresponds to upstreamBranch, the branch
+// being synced from the config entry's Upstream.
+func (s *AdditionalSubmodule) UpstreamBranch(upstreamBranch string) string {
+	if s.Branch != "" {
+		return s.Branch
+	}
+	return upstreamBranch
+}
+
+// Hook is a command that sync runs while syncing a branch. See ConfigEntry.PreMergeHooks.
+type Hook struct {
+	// Name describes the hook in logs and errors. Optional.
+	Name string
+	// Command is the program to run followed by its arguments. It isn't run by a shell. A program
+	// path that contains "/" is relative to the root of the repository.
+	Command []string
+}
+
+// DisplayName returns the name of the hook, or its command if it has no name.
+func (h Hook) DisplayName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return strings.Join(h.Command, " ")
+}
+
+// ResolveStrategy is a way to resolve a merge conflict. See AutoResolveRule.Strategy.
+type ResolveStrategy string
+
+// Resolve strategies supported by AutoResolveRule.
+const (
+	ResolveOurs     ResolveStrategy = "ours"
+	ResolveTheirs   ResolveStrategy = "theirs"
+	ResolveUnion    ResolveStrategy = "union"
+	ResolveResolver ResolveStrategy = "resolver"
+)
+
+// nestedSubmodulePath returns the path of the submodule at path relative to c.SubmoduleTarget, and
+// whether it's inside SubmoduleTarget.
+func (c *ConfigEntry) nestedSubmodulePath(path string) (string, bool) {
+	if c.SubmoduleTarget == "" {
+		return "", false
+	}
+	return stringutil.CutPrefix(path, c.SubmoduleTarget+"/")
+}
+
+// hasNestedSubmodules reports whether any of c.AdditionalSubmodules is inside SubmoduleTarget.
+func (c *ConfigEntry) hasNestedSubmodules() bool {
+	for i := range c.AdditionalSubmodules {
+		if _, ok := c.nestedSubmodulePath(c.AdditionalSubmodules[i].Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // PRBranchStorageRepo returns the repo to store the PR branch on.
 func (c *ConfigEntry) PRBranchStorageRepo() string {
 	if c.Head != "" {
@@ -122,3 +255,36 @@ func (c *ConfigEntry) TargetBranch(upstream string) (string, error) {
 	}
 	return foundTarget, nil
 }
+
+// mapsToTargetBranch reports whether c's BranchMap maps any upstream branch name to target. This is
+// the reverse of TargetBranch, for branches that may not be in AutoSyncBranches.
+func (c *ConfigEntry) mapsToTargetBranch(target string) (bool, error) {
+	for pattern, t := range c.BranchMap {
+		// t is parts[0] + upstream + parts[1] + upstream + ... + parts[n], so the length of
+		// target determines the length of the upstream branch name.
+		parts := strings.Split(t, "?")
+		n := len(parts) - 1
+		if n == 0 {
+			if t == target {
+				return true, nil
+			}
+			continue
+		}
+		upstreamLen := (len(target) - (len(t) - n)) / n
+		if upstreamLen <= 0 || len(parts[0])+upstreamLen > len(target) {
+			continue
+		}
+		upstream := target[len(parts[0]) : len(parts[0])+upstreamLen]
+		if strings.ReplaceAll(t, "?", upstream) != target {
+			continue
+		}
+		found, err := filepath.Match(pattern, upstream)
+		if err != nil {
+			return false, err
+		}
+		if found {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,264 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+// precheckUpToDate checks whether every branch of entry is already up to date without fetching
+// anything, using "git ls-remote" and the forge API to read the submodule commits (gitlinks) in the
+// Target branches. Returns the sync results if every branch is up to date. Returns nil if any
+// branch may need work, or if the entry uses a feature that can't be checked this way, so the
+// caller needs to run the full sync.
+//
+// Only submodule updates are checked: finding out whether an upstream commit is already merged
+// into a Target branch requires the commit history.
+func (f *Flags) precheckUpToDate(out io.Writer, remotes *remoteSet, entry *ConfigEntry, branches []*gitpr.SyncPRRefSet) ([]SyncResult, error) {
+	if reason, err := f.precheckSkipReason(remotes, entry); err != nil || reason != "" {
+		if reason != "" {
+			fmt.Fprintf(out, "---- Skipping up-to-date precheck: %v.\n", reason)
+		}
+		return nil, err
+	}
+	fmt.Fprintf(out, "---- Checking whether %v is up to date before fetching.\n", entry.Target)
+
+	// Cache ls-remote results, because the same repository may be used more than once, for example
+	// as both the Upstream and an AdditionalSubmodules Upstream.
+	refs := make(map[string]map[string]string)
+	repoRefs := func(repo string) (map[string]string, error) {
+		if refs[repo] == nil {
+			r, err := lsRemote(out, "", remotes.fetchURL(repo))
+			if err != nil {
+				return nil, err
+			}
+			refs[repo] = r
+		}
+		return refs[repo], nil
+	}
+	lsRemoteBranch := func(repo, branch string) (string, error) {
+		r, err := repoRefs(repo)
+		if err != nil {
+			return "", err
+		}
+		return r["refs/heads/"+branch], nil
+	}
+	// latestCommit returns the latest commit of branch that sync would update a submodule to, or
+	// empty string if it can't be determined without fetching.
+	latestCommit := func(upstream, mirror, branch string) (string, error) {
+		commit, err := lsRemoteBranch(upstream, branch)
+		if err != nil || commit == "" || mirror == "" {
+			return commit, err
+		}
+		mirrorCommit, err := lsRemoteBranch(mirror, branch)
+		if err != nil {
+			return "", err
+		}
+		if mirrorCommit != commit {
+			// Sync would use the latest common commit, and finding it requires the history.
+			fmt.Fprintf(out, "---- Upstream and upstream mirror commits of %v do not match: %v != %v\n", branch, commit, mirrorCommit)
+			return "", nil
+		}
+		return commit, nil
+	}
+
+	forge, err := f.newForge(out, entry)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	// needsWork logs why a branch needs the full sync.
+	needsWork := func(format string, args ...interface{}) ([]SyncResult, error) {
+		fmt.Fprintf(out, "---- Precheck found work to do: "+format+"\n", args...)
+		return nil, nil
+	}
+
+	results := make([]SyncResult, 0, len(branches))
+	for _, b := range branches {
+		targetCommit, err := lsRemoteBranch(entry.Target, b.Name)
+		if err != nil {
+			return nil, err
+		}
+		if targetCommit == "" {
+			return needsWork("branch %v doesn't exist in Target", b.Name)
+		}
+
+		newCommit := b.Commit
+		if newCommit == "" {
+			if newCommit, err = latestCommit(entry.Upstream, entry.UpstreamMirror, b.UpstreamName); err != nil {
+				return nil, err
+			}
+			if newCommit == "" {
+				return needsWork("unable to determine the upstream commit of %v", b.UpstreamName)
+			}
+		}
+		r := SyncResult{
+			Upstream:       entry.Upstream,
+			Target:         entry.Target,
+			UpstreamBranch: b.UpstreamName,
+			TargetBranch:   b.Name,
+			UpstreamCommit: newCommit,
+			TargetCommit:   targetCommit,
+			Commit:         targetCommit,
+			UpToDate:       true,
+		}
+
+		gitlink, err := forge.Gitlink(ctx, targetCommit, entry.SubmoduleTarget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read submodule %v in %v: %w", entry.SubmoduleTarget, b.Name, err)
+		}
+		if gitlink != newCommit {
+			return needsWork("submodule %v in %v is %q, not %v", entry.SubmoduleTarget, b.Name, gitlink, newCommit)
+		}
+
+		for i := range entry.AdditionalSubmodules {
+			s := &entry.AdditionalSubmodules[i]
+			newCommit, err := latestCommit(s.Upstream, s.UpstreamMirror, s.UpstreamBranch(b.UpstreamName))
+			if err != nil {
+				return nil, err
+			}
+			if newCommit == "" {
+				return needsWork("unable to determine the upstream commit of submodule %v", s.Path)
+			}
+			gitlink, err := forge.Gitlink(ctx, targetCommit, s.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read submodule %v in %v: %w", s.Path, b.Name, err)
+			}
+			if gitlink != newCommit {
+				return needsWork("submodule %v in %v is %q, not %v", s.Path, b.Name, gitlink, newCommit)
+			}
+			if r.SubmoduleCommits == nil {
+				r.SubmoduleCommits = make(map[string]string, len(entry.AdditionalSubmodules))
+			}
+			r.SubmoduleCommits[s.Path] = newCommit
+		}
+		results = append(results, r)
+	}
+
+	// Sync also mirrors branches and tags before updating the Target. Make sure there's nothing to
+	// push, so skipping the full sync doesn't skip the mirror. If every branch is pinned by
+	// SourceBranchLatestCommit, Upstream hasn't been listed yet.
+	upstreamRefs, err := repoRefs(entry.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if entry.MirrorTarget != "" {
+		mirrorRefs, err := repoRefs(entry.MirrorTarget)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range mirrorBranches(upstreamRefs, entry, branches) {
+			if mirrorRefs[ref] != upstreamRefs[ref] {
+				return needsWork("MirrorTarget %v is %q, not %v", ref, mirrorRefs[ref], upstreamRefs[ref])
+			}
+		}
+		if len(entry.AutoMirrorTags) > 0 {
+			ref, err := missingTag(upstreamRefs, mirrorRefs, entry.AutoMirrorTags)
+			if err != nil {
+				return nil, err
+			}
+			if ref != "" {
+				return needsWork("MirrorTarget tag %v doesn't match Upstream", ref)
+			}
+		}
+	}
+	if len(entry.AutoTargetTags) > 0 {
+		targetRefs, err := repoRefs(entry.Target)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := missingTag(upstreamRefs, targetRefs, entry.AutoTargetTags)
+		if err != nil {
+			return nil, err
+		}
+		if ref != "" {
+			return needsWork("Target tag %v doesn't match Upstream", ref)
+		}
+	}
+
+	return results, nil
+}
+
+// precheckSkipReason returns the reason the up-to-date precheck can't be used for entry, or empty
+// string if it can.
+func (f *Flags) precheckSkipReason(remotes *remoteSet, entry *ConfigEntry) (string, error) {
+	switch {
+	case f.NoPrecheck != nil && *f.NoPrecheck:
+		return "no-precheck specified", nil
+	case entry.SubmoduleTarget == "":
+		return "only submodule updates can be checked", nil
+	case len(remotes.inputBundles) > 0 || remotes.inputBundleDir != "" || remotes.outputBundleDir != "":
+		return "using Git bundles", nil
+	case len(entry.PreMergeHooks) > 0 || len(entry.PostMergeHooks) > 0:
+		return "hooks may change files", nil
+	case entry.GoVersionFileContent != "" || entry.GoMicrosoftRevisionFileContent != "":
+		// The VERSION file depends on the VERSION file in the upstream commit.
+		return "version files are configured", nil
+	case entry.hasNestedSubmodules():
+		// Sync commits nested submodules on top of the upstream commit, so the SubmoduleTarget
+		// commit isn't in Upstream.
+		return "nested submodules are configured", nil
+	}
+	reason, err := f.missingForgeAuth(entry)
+	if err != nil || reason == "" {
+		return "", err
+	}
+	return "unable to use the forge API: " + reason, nil
+}
+
+// mirrorBranches returns the refs in upstreamRefs that sync pushes to entry's MirrorTarget: the
+// synced branches, and the branches that match AutoMirrorBranches.
+func mirrorBranches(upstreamRefs map[string]string, entry *ConfigEntry, branches []*gitpr.SyncPRRefSet) []string {
+	var mirrored []string
+	for _, b := range branches {
+		mirrored = append(mirrored, "refs/heads/"+b.UpstreamName)
+	}
+	for _, ref := range sortedKeys(upstreamRefs) {
+		name := strings.TrimPrefix(ref, "refs/heads/")
+		if name == ref {
+			continue
+		}
+		for _, pattern := range entry.AutoMirrorBranches {
+			if refspecPatternMatch(pattern, name) {
+				mirrored = append(mirrored, ref)
+				break
+			}
+		}
+	}
+	return mirrored
+}
+
+// refspecPatternMatch reports whether name matches a refspec pattern. Like in a Git refspec, the
+// pattern may contain one "*", which matches any text, including "/".
+func refspecPatternMatch(pattern, name string) bool {
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == name
+	}
+	return len(name) >= len(prefix)+len(suffix) && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix)
+}
+
+// missingTag returns the first upstream tag that matches patterns and is missing or different in
+// destRefs, or empty string if all of them match.
+func missingTag(upstreamRefs, destRefs map[string]string, patterns []string) (string, error) {
+	for _, ref := range sortedKeys(upstreamRefs) {
+		name := strings.TrimPrefix(ref, "refs/tags/")
+		if name == ref {
+			continue
+		}
+		match, err := matchAny(patterns, name)
+		if err != nil {
+			return "", err
+		}
+		if match && destRefs[ref] != upstreamRefs[ref] {
+			return ref, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+func Test_refspecPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"master", "master", true},
+		{"master", "main", false},
+		{"release-branch.go*", "release-branch.go1.20", true},
+		{"release-branch.go*", "release-branch.go", true},
+		{"release-branch.go*", "dev.boringcrypto", false},
+		{"dev/*/main", "dev/a/b/main", true},
+		{"a*a", "a", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := refspecPatternMatch(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("refspecPatternMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mirrorBranches(t *testing.T) {
+	upstreamRefs := map[string]string{
+		"refs/heads/master":                "a",
+		"refs/heads/release-branch.go1.19": "b",
+		"refs/heads/release-branch.go1.20": "c",
+		"refs/heads/dev.boringcrypto":      "d",
+		"refs/tags/release-branch.go1.20":  "e",
+	}
+	entry := &ConfigEntry{AutoMirrorBranches: []string{"release-branch.go*"}}
+	branches := []*gitpr.SyncPRRefSet{{UpstreamName: "master"}}
+	want := []string{"refs/heads/master", "refs/heads/release-branch.go1.19", "refs/heads/release-branch.go1.20"}
+	if got := mirrorBranches(upstreamRefs, entry, branches); !reflect.DeepEqual(got, want) {
+		t.Errorf("mirrorBranches() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// versionFiles are the files that control the version of a Microsoft Go build. A dry run preview
+// shows their full diff.
+var versionFiles = []string{"VERSION", "MICROSOFT_REVISION"}
+
+// previewDryRun logs what a real run would push for each changed branch: the upstream commit range,
+// a diffstat against the Target branch, changes to versionFiles, and the push refspecs. If the
+// dry-run-patch-dir flag is set, also writes each branch's changes as a patch file.
+func (f *Flags) previewDryRun(out io.Writer, dir string, entry *ConfigEntry, branches []changedBranch) error {
+	git := func(args ...string) (string, error) {
+		o, err := gitOutput(out, dir, args...)
+		return strings.TrimRight(string(o), "\n"), err
+	}
+	var b strings.Builder
+	for _, c := range branches {
+		// Diff against the Target branch rather than the first parent of the sync commit, which may
+		// be a commit with pre-merge hook changes.
+		base := c.BaseCommit
+
+		fmt.Fprintf(&b, "\n== %v -> %v (%v)\n", c.Refs.UpstreamName, c.Refs.Name, c.Refs.PRBranch())
+		if c.UpstreamRange == "" {
+			b.WriteString("Upstream commits: unknown\n")
+		} else {
+			count, err := git("rev-list", "--count", c.UpstreamRange)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "Upstream commits: %v (%v commit(s))\n", c.UpstreamRange, count)
+		}
+
+		stat, err := git("diff", "--stat", base, c.Result.Commit)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "Diffstat against %v:\n%v\n", c.Refs.Name, stat)
+
+		versionDiff, err := git(append([]string{"diff", base, c.Result.Commit, "--"}, versionFiles...)...)
+		if err != nil {
+			return err
+		}
+		if versionDiff == "" {
+			versionDiff = "None."
+		}
+		fmt.Fprintf(&b, "%v changes:\n%v\n", strings.Join(versionFiles, "/"), versionDiff)
+
+		fmt.Fprintf(&b, "Refspecs to push to %v:\n  --force %v\n", entry.PRBranchStorageRepo(), c.Refs.PRBranchRefspec())
+		if c.SubmoduleRefspec != "" {
+			fmt.Fprintf(&b, "Refspecs to push to %v:\n  %v\n", entry.SubmoduleTargetRepo, c.SubmoduleRefspec)
+		}
+
+		if f.DryRunPatchDir != nil && *f.DryRunPatchDir != "" {
+			patch, err := gitOutput(out, dir, "diff", "--binary", base, c.Result.Commit)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(*f.DryRunPatchDir, os.ModePerm); err != nil {
+				return err
+			}
+			p, err := filepath.Abs(filepath.Join(*f.DryRunPatchDir, targetFileName("sync-", entry.Target, c.Refs.Name)+".patch"))
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(p, patch, 0o666); err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "Wrote patch: %v\n", p)
+		}
+	}
+	fmt.Fprintf(out, "---- Dry run preview of the changes to push:\n%v\n", b.String())
+	return nil
+}
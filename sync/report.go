@@ -0,0 +1,146 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/microsoft/go-infra/azdo"
+	"github.com/microsoft/go-infra/buildreport"
+	"github.com/microsoft/go-infra/githubutil"
+)
+
+// ReportToIssue updates the tracking issue specified by the report-repo and report-issue flags with
+// the results of each entry, if specified. entryResults holds the results of each entry in entries,
+// as returned by CompleteResults. If a branch has newly failed, also posts a comment on the issue
+// that mentions report-mention.
+func (f *Flags) ReportToIssue(entries []ConfigEntry, entryResults [][]SyncResult, startTime time.Time) error {
+	if f.ReportIssue == nil || *f.ReportIssue == 0 {
+		return nil
+	}
+	owner, repoName, err := githubutil.ParseRepoFlag(f.ReportRepo)
+	if err != nil {
+		return fmt.Errorf("failed to parse report-repo: %w", err)
+	}
+
+	runURL := azdo.GetEnvBuildURL()
+	now := time.Now().UTC()
+	var states []buildreport.State
+	for i := range entries {
+		states = append(states, resultStates(&entries[i], entryResults[i], runURL, startTime, now)...)
+	}
+	if *f.DryRun {
+		fmt.Printf("---- Dry run: not reporting %v result(s) to issue %v#%v.\n", len(states), *f.ReportRepo, *f.ReportIssue)
+		return nil
+	}
+
+	fmt.Printf("---- Reporting %v result(s) to issue %v#%v\n", len(states), *f.ReportRepo, *f.ReportIssue)
+	ctx := context.Background()
+	previous, err := buildreport.UpdateIssueBodyReturnPrevious(ctx, owner, repoName, *f.GitHubPAT, *f.ReportIssue, states...)
+	if err != nil {
+		return fmt.Errorf("failed to update sync report issue: %w", err)
+	}
+
+	newFailures := newlyFailed(previous, states)
+	if len(newFailures) == 0 {
+		return nil
+	}
+	notification := fmt.Sprintf("Sync failed for %v branch(es)!", len(newFailures))
+	if f.ReportMention != nil && *f.ReportMention != "" {
+		notification += " " + *f.ReportMention
+	}
+	notification += "\n\n"
+	if err := buildreport.Comment(ctx, owner, repoName, *f.GitHubPAT, *f.ReportIssue, notification, newFailures...); err != nil {
+		return fmt.Errorf("failed to comment on sync report issue: %w", err)
+	}
+	return nil
+}
+
+// resultStates returns the tracking issue rows for the results of entry. runURL is the URL of the
+// current sync run, or empty string if unknown. There is one row per target branch, and each row's
+// ID is stable from run to run, so a later run updates the same row.
+//
+// If sync failed before determining which branches to sync, each of entry's AutoSyncBranches gets
+// a failed row, so the failure shows up alongside the branch's earlier results.
+func resultStates(entry *ConfigEntry, results []SyncResult, runURL string, startTime, now time.Time) []buildreport.State {
+	if len(results) == 1 && results[0].TargetBranch == "" && results[0].Error != "" {
+		var expanded []SyncResult
+		for _, upstream := range entry.AutoSyncBranches {
+			target, err := entry.TargetBranch(upstream)
+			if err != nil || target == "" {
+				target = upstream
+			}
+			r := results[0]
+			r.UpstreamBranch = upstream
+			r.TargetBranch = target
+			expanded = append(expanded, r)
+		}
+		results = expanded
+	}
+
+	states := make([]buildreport.State, 0, len(results))
+	for i := range results {
+		r := &results[i]
+		repo := reportRepoName(r.Target)
+		s := buildreport.State{
+			ID:         repo + ":" + r.TargetBranch,
+			Name:       "Sync to " + repo,
+			URL:        runURL,
+			Status:     resultStatus(r),
+			StartTime:  startTime,
+			LastUpdate: now,
+		}
+		// Link to the PR if there is one, because that's where the remaining work is. If the PR
+		// couldn't be submitted, the run log is more useful.
+		if r.PR != nil && r.PR.URL != "" && r.Error == "" {
+			s.URL = r.PR.URL
+		}
+		states = append(states, s)
+	}
+	return states
+}
+
+// resultStatus returns the tracking issue status symbol for r. A branch with an open PR is in
+// progress: it's only up to date once the PR is merged and a later sync finds no changes.
+func resultStatus(r *SyncResult) string {
+	switch {
+	case r.Error != "", len(r.Conflicts) > 0:
+		return buildreport.SymbolFailed
+	case r.UpToDate:
+		return buildreport.SymbolSucceeded
+	default:
+		return buildreport.SymbolInProgress
+	}
+}
+
+// reportRepoName returns a short name for the repository at repoURL to display in the tracking
+// issue: the URL without its scheme and host, or repoURL itself if it can't be parsed.
+func reportRepoName(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return repoURL
+	}
+	return strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+}
+
+// newlyFailed returns the failed states in current that weren't already failed in previous.
+func newlyFailed(previous, current []buildreport.State) []buildreport.State {
+	wasFailed := make(map[string]bool)
+	for _, s := range previous {
+		if s.Status == buildreport.SymbolFailed {
+			wasFailed[s.ID] = true
+		}
+	}
+	var failed []buildreport.State
+	for _, s := range current {
+		if s.Status == buildreport.SymbolFailed && !wasFailed[s.ID] {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
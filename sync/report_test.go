@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-infra/buildreport"
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+func Test_resultStates(t *testing.T) {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start.Add(time.Minute)
+	entry := &ConfigEntry{
+		Upstream:         "https://go.googlesource.com/go",
+		Target:           "https://github.com/microsoft/go",
+		AutoSyncBranches: []string{"master", "release-branch.go1.20"},
+		BranchMap:        map[string]string{"*": "microsoft/?"},
+	}
+	const runURL = "https://example.org/run"
+	const prURL = "https://github.com/microsoft/go/pull/1"
+	state := func(branch, url, status string) buildreport.State {
+		return buildreport.State{
+			ID:         "microsoft/go:" + branch,
+			Name:       "Sync to microsoft/go",
+			URL:        url,
+			Status:     status,
+			StartTime:  start,
+			LastUpdate: now,
+		}
+	}
+	tests := []struct {
+		name    string
+		results []SyncResult
+		want    []buildreport.State
+	}{
+		{
+			"up to date",
+			[]SyncResult{{Target: entry.Target, TargetBranch: "microsoft/main", UpToDate: true}},
+			[]buildreport.State{state("microsoft/main", runURL, buildreport.SymbolSucceeded)},
+		},
+		{
+			"pr",
+			[]SyncResult{{Target: entry.Target, TargetBranch: "microsoft/main", PR: &gitpr.PR{URL: prURL}}},
+			[]buildreport.State{state("microsoft/main", prURL, buildreport.SymbolInProgress)},
+		},
+		{
+			"conflict pr",
+			[]SyncResult{{Target: entry.Target, TargetBranch: "microsoft/main", PR: &gitpr.PR{URL: prURL}, Conflicts: []string{"a"}}},
+			[]buildreport.State{state("microsoft/main", prURL, buildreport.SymbolFailed)},
+		},
+		{
+			"pr error",
+			[]SyncResult{{Target: entry.Target, TargetBranch: "microsoft/main", PR: &gitpr.PR{URL: prURL}, Error: "failed"}},
+			[]buildreport.State{state("microsoft/main", runURL, buildreport.SymbolFailed)},
+		},
+		{
+			"entry error",
+			[]SyncResult{{Upstream: entry.Upstream, Target: entry.Target, Error: "failed"}},
+			[]buildreport.State{
+				state("microsoft/master", runURL, buildreport.SymbolFailed),
+				state("microsoft/release-branch.go1.20", runURL, buildreport.SymbolFailed),
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultStates(entry, tt.results, runURL, start, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resultStates() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newlyFailed(t *testing.T) {
+	previous := []buildreport.State{
+		{ID: "a", Status: buildreport.SymbolFailed},
+		{ID: "b", Status: buildreport.SymbolSucceeded},
+	}
+	current := []buildreport.State{
+		{ID: "a", Status: buildreport.SymbolFailed},
+		{ID: "b", Status: buildreport.SymbolFailed},
+		{ID: "c", Status: buildreport.SymbolFailed},
+		{ID: "d", Status: buildreport.SymbolInProgress},
+	}
+	want := []buildreport.State{current[1], current[2]}
+	if got := newlyFailed(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("newlyFailed() = %#v, want %#v", got, want)
+	}
+}
+
+func Test_reportRepoName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/microsoft/go", "microsoft/go"},
+		{"https://github.com/microsoft/go.git", "microsoft/go"},
+		{"https://dev.azure.com/dnceng/internal/_git/microsoft-go", "dnceng/internal/_git/microsoft-go"},
+		{"/tmp/target.git", "/tmp/target.git"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			if got := reportRepoName(tt.url); got != tt.want {
+				t.Errorf("reportRepoName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
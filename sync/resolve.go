@@ -0,0 +1,289 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+)
+
+// Resolver resolves a merge conflict in the file at path, given the content of the file in the
+// merge base, in Target ("ours"), and in Upstream ("theirs"). A nil slice means the file doesn't
+// exist on that side of the merge. Returns the resolved content, or nil to delete the file.
+type Resolver func(path string, base, ours, theirs []byte) ([]byte, error)
+
+var (
+	resolversMu gosync.RWMutex
+	resolvers   = make(map[string]Resolver)
+)
+
+// RegisterResolver makes a resolver available to AutoResolveRule by name. It is intended to be
+// called from an init func. Panics if name is empty, r is nil, or name is already registered.
+func RegisterResolver(name string, r Resolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	if name == "" || r == nil {
+		panic("sync: RegisterResolver requires a name and a resolver")
+	}
+	if _, ok := resolvers[name]; ok {
+		panic("sync: RegisterResolver called twice for resolver " + name)
+	}
+	resolvers[name] = r
+}
+
+func lookupResolver(name string) (Resolver, bool) {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	r, ok := resolvers[name]
+	return r, ok
+}
+
+// Match returns true if the rule's pattern matches the slash-separated path p.
+func (r *AutoResolveRule) Match(p string) (bool, error) {
+	if strings.Contains(r.Pattern, "/") {
+		return path.Match(r.Pattern, p)
+	}
+	return path.Match(r.Pattern, path.Base(p))
+}
+
+// validate returns a description of the problem with the rule, or empty string.
+func (r *AutoResolveRule) validate() string {
+	if _, err := path.Match(r.Pattern, ""); err != nil || r.Pattern == "" {
+		return fmt.Sprintf("invalid glob pattern %q", r.Pattern)
+	}
+	switch r.Strategy {
+	case ResolveOurs, ResolveTheirs, ResolveUnion:
+		if r.Resolver != "" {
+			return fmt.Sprintf("Resolver is only used by the %q strategy", ResolveResolver)
+		}
+	case ResolveResolver:
+		if _, ok := lookupResolver(r.Resolver); !ok {
+			return fmt.Sprintf("no resolver registered with name %q", r.Resolver)
+		}
+	default:
+		return fmt.Sprintf("unknown strategy %q", r.Strategy)
+	}
+	return ""
+}
+
+// resolvedPath is a conflicting path that was resolved automatically, and the rule that did it.
+type resolvedPath struct {
+	Path string
+	Rule *AutoResolveRule
+}
+
+// unmergedFile is a file with a merge conflict in the Git index.
+type unmergedFile struct {
+	Path string
+	// Stages is the blob hash of each stage of the file in the index: 1 is the merge base, 2 is
+	// "ours", and 3 is "theirs". An empty string means the stage doesn't exist.
+	Stages [4]string
+	// Submodule is true if any stage is a submodule.
+	Submodule bool
+}
+
+// autoResolveConflicts resolves each conflicting file in the repository at dir using the first
+// matching rule, then adds the result to the index. Conflicting files that don't match any rule are
+// left as they are. Returns the resolved paths.
+func autoResolveConflicts(out io.Writer, dir string, rules []AutoResolveRule) ([]resolvedPath, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	files, err := unmergedFiles(out, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []resolvedPath
+	for _, f := range files {
+		rule, err := matchResolveRule(rules, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			fmt.Fprintf(out, "---- No auto-resolve rule matches conflicting path %#q\n", f.Path)
+			continue
+		}
+		if f.Submodule {
+			return nil, fmt.Errorf("auto-resolve rule %q matches %#q, but submodule conflicts aren't supported", rule.Pattern, f.Path)
+		}
+		fmt.Fprintf(out, "---- Auto-resolving conflicting path %#q using rule %q: %v\n", f.Path, rule.Pattern, rule.Strategy)
+
+		stages, err := f.readStages(out, dir)
+		if err != nil {
+			return nil, err
+		}
+		content, err := resolveContent(out, f.Path, rule, stages[1], stages[2], stages[3])
+		if err != nil {
+			return nil, fmt.Errorf("failed to auto-resolve %#q using rule %q: %w", f.Path, rule.Pattern, err)
+		}
+		if err := f.stage(out, dir, content); err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, resolvedPath{Path: f.Path, Rule: rule})
+	}
+	return resolved, nil
+}
+
+// readStages returns the content of each stage of the file. A nil slice means the stage doesn't
+// exist.
+func (f *unmergedFile) readStages(out io.Writer, dir string) ([4][]byte, error) {
+	var stages [4][]byte
+	for i := 1; i <= 3; i++ {
+		if f.Stages[i] == "" {
+			continue
+		}
+		var err error
+		if stages[i], err = gitOutput(out, dir, "cat-file", "blob", f.Stages[i]); err != nil {
+			return stages, err
+		}
+	}
+	return stages, nil
+}
+
+// stage writes content to the file in the worktree and adds it to the index, resolving the
+// conflict. If content is nil, removes the file instead.
+func (f *unmergedFile) stage(out io.Writer, dir string, content []byte) error {
+	if content == nil {
+		_, err := gitOutput(out, dir, "rm", "--quiet", "--", f.Path)
+		return err
+	}
+	p := filepath.Join(dir, filepath.FromSlash(f.Path))
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, content, 0o666); err != nil {
+		return err
+	}
+	_, err := gitOutput(out, dir, "add", "--", f.Path)
+	return err
+}
+
+func matchResolveRule(rules []AutoResolveRule, p string) (*AutoResolveRule, error) {
+	for i := range rules {
+		match, err := rules[i].Match(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auto-resolve pattern %q: %w", rules[i].Pattern, err)
+		}
+		if match {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func resolveContent(out io.Writer, p string, rule *AutoResolveRule, base, ours, theirs []byte) ([]byte, error) {
+	switch rule.Strategy {
+	case ResolveOurs:
+		return ours, nil
+	case ResolveTheirs:
+		return theirs, nil
+	case ResolveUnion:
+		if ours == nil || theirs == nil {
+			return nil, fmt.Errorf("%q strategy can't resolve a file that was deleted on one side", ResolveUnion)
+		}
+		return mergeFileUnion(out, base, ours, theirs)
+	case ResolveResolver:
+		r, ok := lookupResolver(rule.Resolver)
+		if !ok {
+			return nil, fmt.Errorf("no resolver registered with name %q", rule.Resolver)
+		}
+		return r(p, base, ours, theirs)
+	}
+	return nil, fmt.Errorf("unknown strategy %q", rule.Strategy)
+}
+
+// mergeFileUnion merges the content with "git merge-file --union", which resolves conflicts by
+// keeping the lines from both sides.
+func mergeFileUnion(out io.Writer, base, ours, theirs []byte) ([]byte, error) {
+	d, err := os.MkdirTemp("", "sync-union-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(d)
+
+	names := []string{"ours", "base", "theirs"}
+	for i, content := range [][]byte{ours, base, theirs} {
+		if err := os.WriteFile(filepath.Join(d, names[i]), content, 0o666); err != nil {
+			return nil, err
+		}
+	}
+	return gitOutput(out, d, "merge-file", "-p", "--union", "ours", "base", "theirs")
+}
+
+// unmergedFiles lists the files with merge conflicts in the repository at dir.
+func unmergedFiles(out io.Writer, dir string) ([]*unmergedFile, error) {
+	ls, err := gitOutput(out, dir, "ls-files", "--unmerged", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var files []*unmergedFile
+	byPath := make(map[string]*unmergedFile)
+	s := bufio.NewScanner(bytes.NewReader(ls))
+	s.Split(splitNull)
+	for s.Scan() {
+		// Format, from Git docs: "<mode> SP <object> SP <stage> TAB <file>"
+		info, p, ok := strings.Cut(s.Text(), "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || len(fields[2]) != 1 || fields[2][0] < '1' || fields[2][0] > '3' {
+			return nil, fmt.Errorf("unexpected 'git ls-files --unmerged' line: %q", s.Text())
+		}
+		f, ok := byPath[p]
+		if !ok {
+			f = &unmergedFile{Path: p}
+			byPath[p] = f
+			files = append(files, f)
+		}
+		f.Stages[fields[2][0]-'0'] = fields[1]
+		if fields[0] == "160000" {
+			f.Submodule = true
+		}
+	}
+	return files, s.Err()
+}
+
+func splitNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// gitOutput runs a Git command in dir and returns its stdout. Stderr is written to out.
+func gitOutput(out io.Writer, dir string, args ...string) ([]byte, error) {
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Stderr = out
+	fmt.Fprintf(out, "---- Running command: %v %v\n", c.Path, c.Args)
+	return c.Output()
+}
+
+// autoResolvedPRBody returns a section for the PR description listing the resolved paths.
+func autoResolvedPRBody(resolved []resolvedPath) string {
+	if len(resolved) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nThese conflicting files were automatically resolved by AutoResolve rules in the sync configuration:\n\n")
+	b.WriteString("| Path | Rule | Strategy |\n| --- | --- | --- |\n")
+	for _, r := range resolved {
+		strategy := string(r.Rule.Strategy)
+		if r.Rule.Strategy == ResolveResolver {
+			strategy += " " + r.Rule.Resolver
+		}
+		fmt.Fprintf(&b, "| `%v` | `%v` | %v |\n", r.Path, r.Rule.Pattern, strategy)
+	}
+	return b.String()
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/go-infra/goldentest"
+)
+
+// TestConfigSchema generates the JSON Schema of the sync config file format from ConfigEntry and
+// its doc comments, and checks that the published copy is up to date.
+func TestConfigSchema(t *testing.T) {
+	entrySchema, err := schemaType(reflect.TypeOf(ConfigEntry{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entrySchema["required"] = []string{"Upstream", "Target", "BranchMap"}
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "Sync configuration",
+		"description": "A list of sync config entries. Generated from sync.ConfigEntry by TestConfigSchema in github.com/microsoft/go-infra/sync.",
+		"type":        "array",
+		"items":       entrySchema,
+	}
+	got, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldentest.Check(
+		t, "go test ./sync -run "+t.Name(),
+		filepath.Join("..", "docs", "automation", "sync-config.schema.json"),
+		string(got)+"\n")
+}
+
+// schemaEnums lists the valid values of string types that are used like enums.
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(ResolveStrategy("")): {
+		string(ResolveOurs), string(ResolveTheirs), string(ResolveUnion), string(ResolveResolver),
+	},
+}
+
+// schemaType returns the JSON Schema of t. Struct types must be declared in model.go, which is
+// parsed to find field descriptions.
+func schemaType(t reflect.Type) (map[string]interface{}, error) {
+	switch {
+	case t.Kind() == reflect.String:
+		s := map[string]interface{}{"type": "string"}
+		if enum, ok := schemaEnums[t]; ok {
+			s["enum"] = enum
+		}
+		return s, nil
+	case t.Kind() == reflect.Slice:
+		items, err := schemaType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		}, nil
+	case t.Kind() == reflect.Struct:
+		docs, err := fieldDocs("model.go", t.Name())
+		if err != nil {
+			return nil, err
+		}
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			p, err := schemaType(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %v: %v", field.Name, err)
+			}
+			p["description"] = docs[field.Name]
+			properties[field.Name] = p
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}, nil
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]string{"type": "string"},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
+
+// fieldDocs parses the Go file and returns the doc comment of each field in the named struct, with
+// line breaks joined into a single paragraph per blank-line-separated section.
+func fieldDocs(file, typeName string) (map[string]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]string)
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || spec.Name.Name != typeName {
+			return true
+		}
+		for _, field := range spec.Type.(*ast.StructType).Fields.List {
+			var doc string
+			if field.Doc != nil {
+				paragraphs := strings.Split(strings.TrimSpace(field.Doc.Text()), "\n\n")
+				for i, p := range paragraphs {
+					paragraphs[i] = strings.Join(strings.Fields(p), " ")
+				}
+				doc = strings.Join(paragraphs, "\n\n")
+			}
+			for _, name := range field.Names {
+				docs[name.Name] = doc
+			}
+		}
+		return false
+	})
+	return docs, nil
+}
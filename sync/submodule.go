@@ -0,0 +1,227 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+// submoduleUpdate is the new commit of one of a config entry's AdditionalSubmodules.
+type submoduleUpdate struct {
+	Path   string
+	Commit string
+}
+
+// submoduleLocalBranch is the name of the local branch that upstreamBranch is fetched into for the
+// additional submodule at index i in the config entry. source is "upstream" or "upstream-mirror".
+func submoduleLocalBranch(i int, source, upstreamBranch string) string {
+	return fmt.Sprintf("fetched-submodule/%v/%v/%v", i, source, upstreamBranch)
+}
+
+// fetchAdditionalSubmodules fetches the branch of each of entry's AdditionalSubmodules that
+// corresponds to each synced branch, from the submodule's Upstream and UpstreamMirror.
+func fetchAdditionalSubmodules(out io.Writer, dir string, remotes *remoteSet, entry *ConfigEntry, branches []*gitpr.SyncPRRefSet) error {
+	for i := range entry.AdditionalSubmodules {
+		s := &entry.AdditionalSubmodules[i]
+		fetch := func(repo, source string) error {
+			args := []string{"fetch", "--no-tags", remotes.fetchURL(repo)}
+			for _, b := range branches {
+				args = append(args, fmt.Sprintf(
+					"refs/heads/%v:refs/heads/%v",
+					s.UpstreamBranch(b.UpstreamName), submoduleLocalBranch(i, source, b.UpstreamName)))
+			}
+			return run(out, newDirGitCmd(dir, args...))
+		}
+		if err := fetch(s.Upstream, "upstream"); err != nil {
+			return err
+		}
+		if s.UpstreamMirror != "" {
+			if err := fetch(s.UpstreamMirror, "upstream-mirror"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateAdditionalSubmodules sets each of entry's AdditionalSubmodules in the Git index of the
+// repository at dir to the latest commit of its upstream branch that corresponds to upstreamBranch.
+// The branches must already be fetched by fetchAdditionalSubmodules. Submodules nested inside
+// SubmoduleTarget aren't in the index: pass the updates to commitNestedSubmodules. Returns the new
+// commits and PR description sections that list the upstream changes.
+func updateAdditionalSubmodules(out io.Writer, dir string, entry *ConfigEntry, upstreamBranch string) ([]submoduleUpdate, string, error) {
+	git := func(args ...string) (string, error) {
+		o, err := gitOutput(out, dir, args...)
+		return strings.TrimSpace(string(o)), err
+	}
+	var updates []submoduleUpdate
+	var body string
+	for i := range entry.AdditionalSubmodules {
+		s := &entry.AdditionalSubmodules[i]
+		fmt.Fprintf(out, "---- Updating submodule %#q from %v\n", s.Path, s.Upstream)
+		newCommit, err := git("rev-parse", submoduleLocalBranch(i, "upstream", upstreamBranch))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to find upstream commit for submodule %v: %w", s.Path, err)
+		}
+		// Like the main submodule, only update to a commit that is in both Upstream and
+		// UpstreamMirror.
+		if s.UpstreamMirror != "" {
+			mirrorCommit, err := git("rev-parse", submoduleLocalBranch(i, "upstream-mirror", upstreamBranch))
+			if err != nil {
+				return nil, "", err
+			}
+			if newCommit != mirrorCommit {
+				fmt.Fprintf(out, "--- Upstream and upstream mirror commits do not match: %v != %v\n", newCommit, mirrorCommit)
+				if newCommit, err = git("merge-base", newCommit, mirrorCommit); err != nil {
+					return nil, "", err
+				}
+				fmt.Fprintf(out, "---- Common commit of upstream and upstream mirror: %v\n", newCommit)
+			}
+		}
+
+		// The changelog is only informational, so skip it if the history isn't available.
+		if oldCommit, err := currentSubmoduleCommit(out, dir, entry, s.Path); err != nil {
+			fmt.Fprintf(out, "---- Unable to find current submodule commit, skipping upstream changelog: %v\n", err)
+		} else if changelog, err := upstreamChangelog(out, dir, oldCommit+".."+newCommit); err != nil {
+			fmt.Fprintf(out, "---- Unable to list upstream commits, skipping upstream changelog: %v\n", err)
+		} else {
+			body += changelogPRSection(fmt.Sprintf("Upstream changes in `%v`", s.Path), changelog, s.Upstream, s.UpstreamMirror)
+		}
+
+		if _, ok := entry.nestedSubmodulePath(s.Path); !ok {
+			if _, err := git("update-index", "--add", "--cacheinfo", fmt.Sprintf("160000,%v,%v", newCommit, s.Path)); err != nil {
+				return nil, "", err
+			}
+		}
+		updates = append(updates, submoduleUpdate{Path: s.Path, Commit: newCommit})
+	}
+	return updates, body, nil
+}
+
+// currentSubmoduleCommit returns the commit of the submodule at path in HEAD of the repository at
+// dir. If path is inside entry's SubmoduleTarget, reads it from the SubmoduleTarget commit, which
+// must be in the repository.
+func currentSubmoduleCommit(out io.Writer, dir string, entry *ConfigEntry, path string) (string, error) {
+	git := func(args ...string) (string, error) {
+		o, err := gitOutput(out, dir, args...)
+		return strings.TrimSpace(string(o)), err
+	}
+	rel, ok := entry.nestedSubmodulePath(path)
+	if !ok {
+		return git("rev-parse", "HEAD:"+path)
+	}
+	submoduleCommit, err := git("rev-parse", "HEAD:"+entry.SubmoduleTarget)
+	if err != nil {
+		return "", err
+	}
+	return git("rev-parse", submoduleCommit+":"+rel)
+}
+
+// fetchSubmoduleTargetCommit fetches the SubmoduleTarget commit in HEAD of the repository at dir
+// from entry's SubmoduleTargetRepo, if it isn't in the repository yet. It may be a commit that sync
+// made to update nested submodules, so it isn't in Upstream. The commit is only used to list
+// upstream changes, so failures are logged rather than returned.
+func fetchSubmoduleTargetCommit(out io.Writer, dir string, remotes *remoteSet, entry *ConfigEntry) {
+	o, err := gitOutput(out, dir, "rev-parse", "HEAD:"+entry.SubmoduleTarget)
+	if err != nil {
+		fmt.Fprintf(out, "---- Unable to find current submodule commit: %v\n", err)
+		return
+	}
+	commit := strings.TrimSpace(string(o))
+	if _, err := gitOutput(out, dir, "cat-file", "-e", commit+"^{commit}"); err == nil {
+		return
+	}
+	if err := run(out, newDirGitCmd(dir, "fetch", "--no-tags", remotes.fetchURL(entry.SubmoduleTargetRepo), commit)); err != nil {
+		fmt.Fprintf(out, "---- Unable to fetch current submodule commit %v: %v\n", commit, err)
+	}
+}
+
+// nestedSubmoduleBranch is the branch in SubmoduleTargetRepo that sync pushes commit to. Each
+// commit has its own branch, so every commit that a Target branch has ever used stays available.
+func nestedSubmoduleBranch(commit string) string {
+	return "auto-sync-submodule/" + commit
+}
+
+// commitNestedSubmodules makes a commit on top of submoduleCommit, a commit of entry's
+// SubmoduleTarget in the repository at dir, that sets the submodules in updates that are nested
+// inside SubmoduleTarget. Returns the new commit, or submoduleCommit if there are no nested
+// submodules or they already match.
+//
+// The commit uses the date of submoduleCommit, so it's the same for every sync that makes the same
+// update with the same Git identity. This keeps an up to date Target branch up to date.
+func commitNestedSubmodules(out io.Writer, dir string, entry *ConfigEntry, submoduleCommit string, updates []submoduleUpdate) (string, error) {
+	var nested []submoduleUpdate
+	for _, u := range updates {
+		if rel, ok := entry.nestedSubmodulePath(u.Path); ok {
+			nested = append(nested, submoduleUpdate{Path: rel, Commit: u.Commit})
+		}
+	}
+	if len(nested) == 0 {
+		return submoduleCommit, nil
+	}
+	fmt.Fprintf(out, "---- Committing nested submodules in %v on top of %v\n", entry.SubmoduleTarget, submoduleCommit)
+
+	gitDir, err := gitOutput(out, dir, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	// Use a separate index to avoid touching the Target branch index.
+	index := filepath.Join(strings.TrimSpace(string(gitDir)), "sync-nested-submodules-index")
+	if err := os.Remove(index); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	defer os.Remove(index)
+	date, err := gitOutput(out, dir, "log", "-n", "1", "--format=%cd", "--date=raw", submoduleCommit)
+	if err != nil {
+		return "", err
+	}
+	git := func(args ...string) (string, error) {
+		c := newDirGitCmd(dir, args...)
+		c.Env = append(
+			os.Environ(),
+			"GIT_INDEX_FILE="+index,
+			"GIT_AUTHOR_DATE="+strings.TrimSpace(string(date)),
+			"GIT_COMMITTER_DATE="+strings.TrimSpace(string(date)))
+		c.Stderr = out
+		fmt.Fprintf(out, "---- Running command: %v %v\n", c.Path, c.Args)
+		o, err := c.Output()
+		return strings.TrimSpace(string(o)), err
+	}
+
+	if _, err := git("read-tree", submoduleCommit); err != nil {
+		return "", err
+	}
+	message := "Update nested submodules\n"
+	for _, u := range nested {
+		if _, err := git("update-index", "--add", "--cacheinfo", fmt.Sprintf("160000,%v,%v", u.Commit, u.Path)); err != nil {
+			return "", err
+		}
+		message += fmt.Sprintf("\n\t%v to %v", u.Path, u.Commit[:8])
+	}
+	tree, err := git("write-tree")
+	if err != nil {
+		return "", err
+	}
+	oldTree, err := git("rev-parse", submoduleCommit+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	if tree == oldTree {
+		fmt.Fprintf(out, "---- Nested submodules are already up to date in %v.\n", submoduleCommit)
+		return submoduleCommit, nil
+	}
+	commit, err := git("commit-tree", tree, "-p", submoduleCommit, "-m", message)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(out, "---- Committed nested submodules: %v\n", commit)
+	return commit, nil
+}
@@ -5,19 +5,24 @@ package sync
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	gosync "sync"
+	"time"
 
 	"github.com/microsoft/go-infra/azdo"
 	"github.com/microsoft/go-infra/executil"
 	"github.com/microsoft/go-infra/gitcmd"
+	"github.com/microsoft/go-infra/githubutil"
 	"github.com/microsoft/go-infra/gitpr"
 	"github.com/microsoft/go-infra/stringutil"
 )
@@ -30,7 +35,8 @@ type Flags struct {
 	GitHubPAT         *string
 	GitHubPATReviewer *string
 
-	AzDODncengPAT *string
+	AzDODncengPAT         *string
+	AzDODncengPATReviewer *string
 
 	SyncConfig *string
 	TempGitDir *string
@@ -38,9 +44,49 @@ type Flags struct {
 	CreateBranches *bool
 
 	GitAuthString *string
+
+	JSONReport *string
+
+	Parallel *int
+
+	ConflictReportDir *string
+	ConflictPR        *string
+
+	DryRunPatchDir *string
+
+	// InputBundles maps remote repository URLs to Git bundle files to fetch from instead.
+	InputBundles    map[string]string
+	InputBundleDir  *string
+	OutputBundleDir *string
+
+	UpstreamMirrorMaxCommits *int
+	UpstreamMirrorMaxLag     *time.Duration
+
+	ReportRepo    *string
+	ReportIssue   *int
+	ReportMention *string
+
+	NoPrecheck *bool
+
+	// NewForge, if set, is used instead of gitpr.NewForge to create the forge that hosts an entry's
+	// Target repo. This is not a flag: it lets tests submit PRs to a fake forge.
+	NewForge func(entry *ConfigEntry) (gitpr.Forge, error)
 }
 
 func BindFlags(workingDirectory string) *Flags {
+	inputBundles := make(map[string]string)
+	flag.Func(
+		"input-bundle",
+		"Fetch from the Git bundle file at PATH instead of the remote repository URL. Format: URL=PATH. May be specified multiple times.",
+		func(s string) error {
+			u, p, ok := strings.Cut(s, "=")
+			if !ok || u == "" || p == "" {
+				return fmt.Errorf("expected URL=PATH, got %q", s)
+			}
+			inputBundles[u] = p
+			return nil
+		})
+
 	return &Flags{
 		DryRun: flag.Bool("n", false, "Enable dry run: do not push, do not submit PR."),
 		InitialCloneDir: flag.String(
@@ -52,7 +98,8 @@ func BindFlags(workingDirectory string) *Flags {
 		GitHubPAT:         flag.String("github-pat", "", "Submit the PR with this GitHub PAT, if specified."),
 		GitHubPATReviewer: flag.String("github-pat-reviewer", "", "Approve the PR and turn on auto-merge with this PAT, if specified. Required, if github-pat specified."),
 
-		AzDODncengPAT: flag.String("azdo-dnceng-pat", "", "Use this Azure DevOps PAT to authenticate to dnceng project HTTPS Git URLs."),
+		AzDODncengPAT:         flag.String("azdo-dnceng-pat", "", "Use this Azure DevOps PAT to authenticate to dnceng project HTTPS Git URLs, and to submit PRs to AzDO Target repos."),
+		AzDODncengPATReviewer: flag.String("azdo-dnceng-pat-reviewer", "", "Approve AzDO PRs and set them to auto-complete with this PAT, if specified. Required to submit PRs to AzDO Target repos."),
 
 		SyncConfig: flag.String("c", "eng/sync-config.json", "The sync configuration file to run."),
 		TempGitDir: flag.String(
@@ -73,9 +120,96 @@ func BindFlags(workingDirectory string) *Flags {
 				" none - Leave GitHub URLs as they are. Git may use HTTPS authentication in this case.\n"+
 				" ssh - Change the GitHub URL to SSH format.\n"+
 				" pat - Add the 'github-user' and 'github-pat' values into the URL.\n"),
+
+		JSONReport: flag.String(
+			"json-report", "",
+			"Write the result of each config entry and branch to this path as a JSON list of SyncResult."),
+
+		Parallel: flag.Int(
+			"parallel", 1,
+			"The maximum number of config entries to sync concurrently. Each entry uses its own temporary repository.\n"+
+				"If more than 1, each line of output is prefixed with the number of the entry that produced it."),
+
+		ConflictReportDir: flag.String(
+			"conflict-report-dir", "",
+			"If a merge has conflicts that can't be resolved automatically, write a Markdown and JSON conflict report into this directory.\n"+
+				"The Markdown report is uploaded as an AzDO build summary."),
+
+		ConflictPR: flag.String(
+			"conflict-pr", string(ConflictPROff),
+			// Indent one space, to line up with the automatic ' (default "off")'.
+			"What to do if a merge has conflicts that can't be resolved automatically. String options:\n"+
+				" off - Fail the sync of the branch.\n"+
+				" markers - Commit the conflicting files with conflict markers and submit a draft PR from a separate branch.\n"+
+				" theirs - Commit the upstream version of the conflicting files and submit a draft PR from a separate branch.\n"+
+				"A draft conflict PR is never approved or set to auto-merge. It lists the conflicting files as a checklist."),
+
+		DryRunPatchDir: flag.String(
+			"dry-run-patch-dir", "",
+			"In a dry run, write the changes that would be pushed for each branch into this directory as a patch file."),
+
+		InputBundles: inputBundles,
+		InputBundleDir: flag.String(
+			"input-bundle-dir", "",
+			"A directory of Git bundle files to fetch from instead of remote repositories. The bundle for a repository is named after its\n"+
+				"host and path, like 'github.com-microsoft-go.bundle' for https://github.com/microsoft/go. Remotes without a bundle are fetched normally."),
+		OutputBundleDir: flag.String(
+			"output-bundle-dir", "",
+			"Instead of pushing to remote repositories, write the refs that would be pushed into a Git bundle per remote in this directory.\n"+
+				"Bundles are named the same way as in input-bundle-dir. PRs aren't submitted."),
+
+		UpstreamMirrorMaxCommits: flag.Int(
+			"upstream-mirror-max-commits", 0,
+			"Fail if UpstreamMirror is missing more than this many commits from an Upstream branch. 0 means no limit.\n"+
+				"If this or upstream-mirror-max-lag is set, sync checks each branch's UpstreamMirror before using it, and also fails if\n"+
+				"the mirror has diverged from Upstream."),
+		UpstreamMirrorMaxLag: flag.Duration(
+			"upstream-mirror-max-lag", 0,
+			"Fail if UpstreamMirror has been missing an Upstream commit for longer than this, based on the commit's committer date.\n"+
+				"0 means no limit. See upstream-mirror-max-commits."),
+
+		ReportRepo: flag.String(
+			"report-repo", "",
+			"The GitHub repository, in owner/repo form, of the report-issue to report sync results to. The repo's wiki must be enabled."),
+		ReportIssue: flag.Int(
+			"report-issue", 0,
+			"Report the result of each synced branch in a table in the description of this GitHub issue in report-repo, using github-pat.\n"+
+				"When a branch fails, also comment on the issue. 0 means don't report."),
+		ReportMention: flag.String(
+			"report-mention", "",
+			"Mention these users or teams, e.g. '@microsoft/golang-compiler', in the report-issue comment about failed branches."),
+
+		NoPrecheck: flag.Bool(
+			"no-precheck", false,
+			"Always fetch and check each branch for changes. By default, if a submodule update entry's branches and mirrors can be\n"+
+				"shown to be up to date using 'git ls-remote' and the forge API, sync skips fetching them."),
 	}
 }
 
+// ConflictPRMode is a way to handle a merge that has conflicts that can't be resolved automatically.
+type ConflictPRMode string
+
+const (
+	// ConflictPROff fails the sync of the branch.
+	ConflictPROff ConflictPRMode = "off"
+	// ConflictPRMarkers commits the conflicting files with conflict markers and submits a draft PR.
+	ConflictPRMarkers ConflictPRMode = "markers"
+	// ConflictPRTheirs commits the upstream version of the conflicting files and submits a draft PR.
+	ConflictPRTheirs ConflictPRMode = "theirs"
+)
+
+// ParseConflictPR returns the mode specified by the conflict-pr flag.
+func (f *Flags) ParseConflictPR() (ConflictPRMode, error) {
+	if f.ConflictPR == nil || *f.ConflictPR == "" {
+		return ConflictPROff, nil
+	}
+	switch m := ConflictPRMode(*f.ConflictPR); m {
+	case ConflictPROff, ConflictPRMarkers, ConflictPRTheirs:
+		return m, nil
+	}
+	return "", fmt.Errorf("conflict-pr value %q is not an accepted value", *f.ConflictPR)
+}
+
 // AzDOVariableFlags is a set of flags that a sync command runner can set to make sync emit AzDO
 // Pipeline log commands to return the results of a sync operation into a form that can be used in
 // later steps in the pipeline. See BindAzDOVariableFlags for flag descriptions.
@@ -129,8 +263,9 @@ func (f *Flags) ParseAuth() (gitcmd.URLAuther, error) {
 		return gitcmd.MultiAuther{
 			Authers: []gitcmd.URLAuther{
 				gitcmd.GitHubPATAuther{
-					User: *f.GitHubUser,
-					PAT:  *f.GitHubPAT,
+					User:   *f.GitHubUser,
+					PAT:    *f.GitHubPAT,
+					WebURL: githubutil.WebURL(githubutil.APIURL()),
 				},
 				gitcmd.AzDOPATAuther{
 					PAT: *f.AzDODncengPAT,
@@ -141,6 +276,55 @@ func (f *Flags) ParseAuth() (gitcmd.URLAuther, error) {
 	return nil, fmt.Errorf("git-auth value %q is not an accepted value.\n", *f.GitAuthString)
 }
 
+// newForge creates the forge that hosts entry's Target repo, using the credentials in f. The forge
+// writes its logs to out.
+func (f *Flags) newForge(out io.Writer, entry *ConfigEntry) (gitpr.Forge, error) {
+	if f.NewForge != nil {
+		return f.NewForge(entry)
+	}
+	return gitpr.NewForge(out, entry.Target, entry.PRBranchStorageRepo(), &gitpr.ForgeAuth{
+		GitHubUser:        *f.GitHubUser,
+		GitHubPAT:         *f.GitHubPAT,
+		GitHubPATReviewer: *f.GitHubPATReviewer,
+		AzDOPAT:           *f.AzDODncengPAT,
+		AzDOPATReviewer:   *f.AzDODncengPATReviewer,
+	})
+}
+
+// missingForgeAuth returns a description of the missing credential flag that prevents sync from
+// submitting PRs to entry's Target repo, or empty string if nothing is missing.
+func (f *Flags) missingForgeAuth(entry *ConfigEntry) (string, error) {
+	if f.NewForge != nil {
+		return "", nil
+	}
+	kind, err := gitpr.DetectForgeKind(entry.Target)
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case gitpr.ForgeGitHub:
+		switch {
+		case *f.GitHubUser == "":
+			return "github-user not provided", nil
+		case *f.GitHubPAT == "":
+			return "github-pat not provided", nil
+		case *f.GitHubPATReviewer == "":
+			// In theory, if we have githubPAT but no reviewer, we can submit the PR but skip
+			// reviewing it/enabling auto-merge. However, this doesn't seem very useful, so it isn't
+			// implemented.
+			return "github-pat-reviewer not provided", nil
+		}
+	case gitpr.ForgeAzDO:
+		switch {
+		case *f.AzDODncengPAT == "":
+			return "azdo-dnceng-pat not provided", nil
+		case *f.AzDODncengPATReviewer == "":
+			return "azdo-dnceng-pat-reviewer not provided", nil
+		}
+	}
+	return "", nil
+}
+
 func (f *Flags) MakeGitWorkDir() (string, error) {
 	d, err := executil.MakeWorkDir(*f.TempGitDir)
 	if err != nil {
@@ -149,6 +333,22 @@ func (f *Flags) MakeGitWorkDir() (string, error) {
 	return d, nil
 }
 
+// WriteJSONReport writes results to the path specified by the json-report flag, if specified.
+func (f *Flags) WriteJSONReport(results []SyncResult) error {
+	if f.JSONReport == nil || *f.JSONReport == "" {
+		return nil
+	}
+	if results == nil {
+		// Write "[]" rather than "null" to make the report easier to consume.
+		results = []SyncResult{}
+	}
+	if err := stringutil.WriteJSONFile(*f.JSONReport, results); err != nil {
+		return fmt.Errorf("failed to write sync JSON report: %w", err)
+	}
+	fmt.Printf("---- Wrote sync JSON report: %v\n", *f.JSONReport)
+	return nil
+}
+
 func (f *Flags) ReadConfig() ([]ConfigEntry, error) {
 	var entries []ConfigEntry
 	if err := stringutil.ReadJSONFile(*f.SyncConfig, &entries); err != nil {
@@ -165,6 +365,13 @@ func (f *Flags) ReadConfig() ([]ConfigEntry, error) {
 // issues, but other tools have hit some, and it seems reasonable to set a limit ahead of time.
 const maxDiffLinesToDisplay = 200
 
+// prBodyGreeting and prBodyDocs are the first and last parts of the introduction at the top of each
+// sync PR description.
+const (
+	prBodyGreeting = "Hi! I'm a bot, and this is an automatically generated upstream sync PR. 🔃"
+	prBodyDocs     = "\n\nFor more information, visit [sync documentation in microsoft/go-infra](https://github.com/microsoft/go-infra/tree/main/docs/automation/sync.md)."
+)
+
 var (
 	// maxUpstreamCommitMessageInSnippet is the maximum number of characters to include in the
 	// commit message snippet for a submodule update commit message. The snippet gives context to
@@ -187,6 +394,12 @@ const (
 	GitAuthPAT  GitAuthOption = "pat"
 )
 
+// PR branch purposes used by sync. See gitpr.PRRefSet.
+const (
+	autoSyncPurpose         = "auto-sync"
+	autoSyncConflictPurpose = "auto-sync-conflict"
+)
+
 var errWouldCreateBranchButCurrentlyDryRun = errors.New("would have pushed a new branch to the target repository to kick off a new version, but this is a dry run. Cannot continue")
 
 func MakePRs(f *Flags) error {
@@ -209,27 +422,82 @@ func MakePRs(f *Flags) error {
 		return err
 	}
 
-	success := true
+	startTime := time.Now().UTC()
+	parallel := 1
+	if f.Parallel != nil && *f.Parallel > 1 {
+		parallel = *f.Parallel
+	}
 
-	for i, entry := range entries {
+	// Run the entries using a bounded number of goroutines. Each entry's results and error are
+	// stored at its index, so the report and aggregated error are in config file order no matter
+	// which entry finishes first.
+	entryResults := make([][]SyncResult, len(entries))
+	entryErrs := make([]error, len(entries))
+	var logMutex gosync.Mutex
+	var wg gosync.WaitGroup
+	sem := make(chan struct{}, parallel)
+
+	for i := range entries {
+		i, entry := i, &entries[i]
 		syncNum := fmt.Sprintf("%v/%v", i+1, len(entries))
-		fmt.Printf("=== Beginning sync %v, from %v -> %v\n", syncNum, entry.Upstream, entry.Target)
 
-		fmt.Printf("--- Repository for PR branch: %v\n", entry.PRBranchStorageRepo())
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// When running in parallel, prefix each line with the sync number to make it possible to
+			// follow each entry's progress in the combined log.
+			var out io.Writer = os.Stdout
+			if parallel > 1 {
+				pw := newPrefixWriter(os.Stdout, &logMutex, "["+syncNum+"] ")
+				defer pw.Flush()
+				out = pw
+			}
 
-		// Give each entry a unique dir to avoid interfering with others upon failure.
-		repositoryDir := path.Join(currentRunGitDir, strconv.Itoa(i))
+			fmt.Fprintf(out, "=== Beginning sync %v, from %v -> %v\n", syncNum, entry.Upstream, entry.Target)
+			fmt.Fprintf(out, "--- Repository for PR branch: %v\n", entry.PRBranchStorageRepo())
 
-		if _, err := MakeBranchPRs(f, repositoryDir, &entry); err != nil {
-			// Let sync process continue if an error happens with the current entry.
-			fmt.Println(err)
-			fmt.Printf("=== Failed sync %v\n", syncNum)
-			success = false
-		}
+			// Give each entry a unique dir to avoid interfering with others upon failure.
+			repositoryDir := path.Join(currentRunGitDir, strconv.Itoa(i))
+
+			results, err := makeBranchPRs(f, repositoryDir, entry, out)
+			if err != nil {
+				// Let sync process continue if an error happens with the current entry.
+				fmt.Fprintln(out, err)
+				fmt.Fprintf(out, "=== Failed sync %v\n", syncNum)
+			}
+			entryResults[i] = CompleteResults(entry, results, err)
+			entryErrs[i] = err
+		}()
 	}
+	wg.Wait()
 
-	if !success {
-		return fmt.Errorf("completed sync with errors")
+	var allResults []SyncResult
+	for _, r := range entryResults {
+		allResults = append(allResults, r...)
+	}
+	// Report every failed entry, not only the first. Keep them even if writing a report fails, so
+	// the log still says which entries failed.
+	var errs []string
+	var failures []string
+	for i, err := range entryErrs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("sync %v/%v, from %v -> %v: %v", i+1, len(entries), entries[i].Upstream, entries[i].Target, err))
+		}
+	}
+	if len(failures) > 0 {
+		errs = append(errs, fmt.Sprintf("completed sync with errors in %v of %v entries:\n%v", len(failures), len(entries), strings.Join(failures, "\n")))
+	}
+	if err := f.WriteJSONReport(allResults); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := f.ReportToIssue(entries, entryResults, startTime); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to report sync results to issue: %v", err))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
 	}
 	return nil
 }
@@ -242,48 +510,108 @@ type changedBranch struct {
 	PRTitle string
 	PRBody  string
 
+	// BaseCommit is the Target branch commit that the change is based on. The PR contains every
+	// change from BaseCommit to Result.Commit, including pre-merge hook changes.
+	BaseCommit string
+
+	// UpstreamRange is the range of upstream commits brought in by the change, "{old}..{new}", or
+	// empty string if it's unknown.
+	UpstreamRange string
+
+	// SubmoduleRefspec pushes the SubmoduleTarget commit that sync made to update nested submodules
+	// to SubmoduleTargetRepo, or is empty string if there's no such commit.
+	SubmoduleRefspec string
+
+	// Conflicts lists the files that were committed with unresolved conflicts. If not empty, the PR
+	// is submitted as a draft from a separate branch, and isn't approved or set to auto-merge.
+	Conflicts []string
+
 	// Result is a pointer to the SyncResult to update with PR info once a PR is submitted for this
 	// changed branch.
 	Result *SyncResult
 }
 
-// SyncResult is the result of a sync call.
+// SyncResult is the result of a sync call for one branch. It is also the format of each item in the
+// JSON report written by the json-report flag.
 type SyncResult struct {
-	// PR is the GitHub PR creation response if a PR is necessary. If the target repo is already up
+	// Upstream and Target are the repositories of the config entry that was synced.
+	Upstream string
+	Target   string
+	// UpstreamBranch is the upstream branch that was synced into TargetBranch. These are empty if
+	// sync failed before determining which branches to sync.
+	UpstreamBranch string
+	TargetBranch   string
+
+	// UpstreamCommit is the upstream commit that the sync brought into the target branch. For a
+	// submodule update, this is the new submodule commit.
+	UpstreamCommit string
+	// SubmoduleCommits maps the path of each of the config entry's AdditionalSubmodules to its
+	// submodule commit, like UpstreamCommit.
+	SubmoduleCommits map[string]string `json:",omitempty"`
+
+	// PR is the PR that was created or reused if a PR is necessary. If the target repo is already up
 	// to date, this is nil. If this is the result of a dry run, PR may be nil even if a PR is
 	// necessary, because a PR wasn't created.
-	PR *gitpr.GitHubResponse
+	PR *gitpr.PR
+	// PRCreated is true if PR was newly created by this sync. PRReused is true if PR already
+	// existed, and this sync updated its branch.
+	PRCreated bool
+	PRReused  bool
+
+	// TargetCommit is the commit of TargetBranch that the sync started from. If a PR is necessary,
+	// the PR changes TargetCommit to Commit.
+	TargetCommit string
 	// Commit is the commit hash that contains the updated result. This is either the commit that
 	// was pushed for the PR, or a commit that already exists in the target repo.
 	Commit string
+	// UpToDate is true if the target branch already contained the sync result, so no PR is needed.
+	UpToDate bool
+	// Conflicts lists the files that were committed with unresolved conflicts in a draft conflict PR.
+	// See the conflict-pr flag.
+	Conflicts []string `json:",omitempty"`
+
+	// Error is the error that prevented the sync from completing, or empty string.
+	Error string `json:",omitempty"`
+}
+
+// CompleteResults returns the results to report for entry after a MakeBranchPRs call that returned
+// results and err. If MakeBranchPRs failed before producing any branch results, returns a single
+// result for the entry that contains the error.
+func CompleteResults(entry *ConfigEntry, results []SyncResult, err error) []SyncResult {
+	if err == nil || len(results) > 0 {
+		return results
+	}
+	return []SyncResult{
+		{
+			Upstream: entry.Upstream,
+			Target:   entry.Target,
+			Error:    err.Error(),
+		},
+	}
 }
 
 // MakeBranchPRs creates sync changes for each branch in the given entry and submits them as PRs.
 // Multiple branches are processed at the same time in order to efficiently use Git: it is better to
 // tell Git to fetch/push multiple branches at the same time than run the operations individually.
-// Returns an error, or the sync results of each branch.
+// Returns an error, or the sync results of each branch. If only PR submission or a hook fails,
+// returns the results along with the error, and the results of the failed branches contain the PR
+// or hook error. If a precheck finds that every branch is already up to date, returns without
+// creating dir. See precheckUpToDate.
 func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, error) {
+	return makeBranchPRs(f, dir, entry, os.Stdout)
+}
+
+// makeBranchPRs implements MakeBranchPRs, writing log output and Git command output to out.
+func makeBranchPRs(f *Flags, dir string, entry *ConfigEntry, out io.Writer) ([]SyncResult, error) {
 	auther, err := f.ParseAuth()
 	if err != nil {
 		return nil, err
 	}
-
-	if *f.InitialCloneDir == "" {
-		if err := run(exec.Command("git", "init", dir)); err != nil {
-			return nil, err
-		}
-	} else {
-		if err := run(exec.Command("git", "clone", *f.InitialCloneDir, dir)); err != nil {
-			return nil, err
-		}
-	}
-
-	// newGitCmd creates a "git {args}" command that runs in the temp fetch repo Git dir.
-	newGitCmd := func(args ...string) *exec.Cmd {
-		c := exec.Command("git", args...)
-		c.Dir = dir
-		return c
+	conflictPR, err := f.ParseConflictPR()
+	if err != nil {
+		return nil, err
 	}
+	remotes := f.newRemoteSet(auther, dir)
 
 	branches := make([]*gitpr.SyncPRRefSet, 0, len(entry.AutoSyncBranches))
 	for _, upstream := range entry.AutoSyncBranches {
@@ -298,7 +626,7 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 			UpstreamName: upstream,
 			PRRefSet: gitpr.PRRefSet{
 				Name:    target,
-				Purpose: "auto-sync",
+				Purpose: autoSyncPurpose,
 			},
 		}
 		if commit, ok := entry.SourceBranchLatestCommit[upstream]; ok {
@@ -306,6 +634,34 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 		}
 		branches = append(branches, nb)
 	}
+
+	// Most scheduled runs find that every branch is already up to date. If that can be determined
+	// without fetching, skip the rest.
+	if results, err := f.precheckUpToDate(out, remotes, entry, branches); err != nil {
+		return nil, err
+	} else if results != nil {
+		fmt.Fprintln(out, "Checked branches for changes to sync before fetching: none found.")
+		fmt.Fprintln(out, "Success.")
+		return results, nil
+	}
+
+	if *f.InitialCloneDir == "" {
+		if err := run(out, exec.Command("git", "init", dir)); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := run(out, exec.Command("git", "clone", *f.InitialCloneDir, dir)); err != nil {
+			return nil, err
+		}
+	}
+
+	// newGitCmd creates a "git {args}" command that runs in the temp fetch repo Git dir.
+	newGitCmd := func(args ...string) *exec.Cmd {
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		return c
+	}
+
 	// Auto-mirrored branches are simpler: always get the latest commits to
 	// push to the mirror repo with the same branch name.
 	autoMirrorBranches := make([]*gitpr.MirrorRefSet, 0, len(entry.AutoMirrorBranches))
@@ -321,8 +677,12 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 		}
 
 		for _, b := range branches {
-			check := newGitCmd("ls-remote", "--exit-code", "--heads", entry.Target, "refs/heads/"+b.Name)
-			if err := run(check); err != nil {
+			lsRemoteURL := entry.Target
+			if p := remotes.inputBundle(entry.Target); p != "" {
+				lsRemoteURL = p
+			}
+			check := newGitCmd("ls-remote", "--exit-code", "--heads", lsRemoteURL, "refs/heads/"+b.Name)
+			if err := run(out, check); err != nil {
 				exitErr, ok := err.(*exec.ExitError)
 				if !ok {
 					return nil, err
@@ -338,27 +698,34 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 				}
 				fetchMain := newGitCmd(
 					"fetch", "--no-tags",
-					auther.InsertAuth(entry.Target),
+					remotes.fetchURL(entry.Target),
 					mainRef.BaseBranchFetchRefspec())
-				if err := run(fetchMain); err != nil {
+				if err := run(out, fetchMain); err != nil {
 					return nil, err
 				}
 
 				// Push the new branch: fork from the main commit we just fetched to a local branch.
+				pushURL, err := remotes.pushURL(out, entry.Target)
+				if err != nil {
+					return nil, err
+				}
 				fork := newGitCmd(
 					"push", "--no-tags",
-					auther.InsertAuth(entry.Target),
+					pushURL,
 					b.ForkFromMainRefspec(mainRef.PRBranch()))
 				if *f.DryRun {
 					fork.Args = append(fork.Args, "-n")
 				}
-				if err := run(fork); err != nil {
+				if err := run(out, fork); err != nil {
 					return nil, err
 				}
 
 				if *f.DryRun {
 					return nil, errWouldCreateBranchButCurrentlyDryRun
 				}
+				if err := remotes.pushed(out, entry.Target); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
@@ -369,8 +736,8 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 	//
 	// For an overview of the sequence of Git commands below, see the command description.
 
-	fetchUpstream := newGitCmd("fetch", "--no-tags", auther.InsertAuth(entry.Upstream))
-	fetchOrigin := newGitCmd("fetch", "--no-tags", auther.InsertAuth(entry.Target))
+	fetchUpstream := newGitCmd("fetch", "--no-tags", remotes.fetchURL(entry.Upstream))
+	fetchOrigin := newGitCmd("fetch", "--no-tags", remotes.fetchURL(entry.Target))
 	for _, b := range branches {
 		fetchUpstream.Args = append(fetchUpstream.Args, b.UpstreamFetchRefspec())
 		fetchOrigin.Args = append(fetchOrigin.Args, b.BaseBranchFetchRefspec())
@@ -378,29 +745,56 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 	for _, b := range autoMirrorBranches {
 		fetchUpstream.Args = append(fetchUpstream.Args, b.UpstreamMirrorFetchRefspec())
 	}
-	if err := run(fetchUpstream); err != nil {
+	if err := run(out, fetchUpstream); err != nil {
 		return nil, err
 	}
-	if err := run(fetchOrigin); err != nil {
+	if err := run(out, fetchOrigin); err != nil {
 		return nil, err
 	}
 
 	// Fetch the state of the official/upstream-maintained mirror (if specified) so we can check
 	// against it later.
 	if entry.UpstreamMirror != "" {
-		fetchUpstreamMirror := newGitCmd("fetch", "--no-tags", auther.InsertAuth(entry.UpstreamMirror))
+		fetchUpstreamMirror := newGitCmd("fetch", "--no-tags", remotes.fetchURL(entry.UpstreamMirror))
 		for _, b := range branches {
 			fetchUpstreamMirror.Args = append(fetchUpstreamMirror.Args, b.UpstreamMirrorFetchRefspec())
 		}
-		if err := run(fetchUpstreamMirror); err != nil {
+		if err := run(out, fetchUpstreamMirror); err != nil {
 			return nil, err
 		}
+
+		// If requested, check that the mirror isn't too far behind before using it.
+		if t := f.MirrorLagThresholds(); t != nil {
+			var problems []string
+			now := time.Now()
+			for _, b := range branches {
+				l, err := measureMirrorLag(out, dir, "refs/heads/"+b.UpstreamName, b.UpstreamLocalBranch(), b.UpstreamMirrorLocalBranch(), now)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(out, "---- Upstream mirror check: %v\n", l)
+				if p := t.Problem(l); p != "" {
+					problems = append(problems, p)
+				}
+			}
+			if len(problems) > 0 {
+				return nil, fmt.Errorf("UpstreamMirror %v is past the lag thresholds:\n  %v", entry.UpstreamMirror, strings.Join(problems, "\n  "))
+			}
+		}
+	}
+
+	if err := fetchAdditionalSubmodules(out, dir, remotes, entry, branches); err != nil {
+		return nil, err
 	}
 
 	// Before attempting any update, mirror everything (if specified). Only continue once this is
 	// complete, to avoid a potentially broken internal build state.
 	if entry.MirrorTarget != "" {
-		mirror := newGitCmd("push", auther.InsertAuth(entry.MirrorTarget))
+		mirrorURL, err := remotes.pushURL(out, entry.MirrorTarget)
+		if err != nil {
+			return nil, err
+		}
+		mirror := newGitCmd("push", mirrorURL)
 		for _, b := range branches {
 			mirror.Args = append(mirror.Args, b.UpstreamMirrorRefspec())
 		}
@@ -411,41 +805,124 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 			mirror.Args = append(mirror.Args, "-n")
 		}
 
-		if err := run(mirror); err != nil {
+		if err := run(out, mirror); err != nil {
 			return nil, err
 		}
+		if !*f.DryRun {
+			if err := remotes.pushed(out, entry.MirrorTarget); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Push upstream tags (if specified). Like mirroring, this must succeed before sync continues.
+	if (len(entry.AutoMirrorTags) > 0 && entry.MirrorTarget != "") || len(entry.AutoTargetTags) > 0 {
+		upstreamURL := remotes.fetchURL(entry.Upstream)
+		upstreamRefs, err := lsRemote(out, dir, upstreamURL)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry.AutoMirrorTags) > 0 && entry.MirrorTarget != "" {
+			if err := pushTags(out, dir, remotes, *f.DryRun, upstreamURL, upstreamRefs, entry.AutoMirrorTags, entry.MirrorTarget); err != nil {
+				return nil, err
+			}
+		}
+		if len(entry.AutoTargetTags) > 0 {
+			if err := pushTags(out, dir, remotes, *f.DryRun, upstreamURL, upstreamRefs, entry.AutoTargetTags, entry.Target); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Track the sync results. In this first section, we figure out the result's Commit value. In
 	// the second section, a PR is created if the Commit doesn't exist in the target, and we update
 	// the result struct to include that info.
 	results := make([]SyncResult, len(branches))
+	for i, b := range branches {
+		results[i] = SyncResult{
+			Upstream:       entry.Upstream,
+			Target:         entry.Target,
+			UpstreamBranch: b.UpstreamName,
+			TargetBranch:   b.Name,
+		}
+	}
 
 	// While looping through the branches and trying to sync, use this slice to keep track of which
 	// branches have changes, so we can push changes and submit PRs later.
 	changedBranches := make([]changedBranch, 0, len(branches))
+	// hookFailures lists the branches that weren't synced because a hook failed.
+	var hookFailures []string
 
 	for i, b := range branches {
-		fmt.Printf("---- Processing branch %q for entry targeting %v\n", b.Name, entry.Target)
+		fmt.Fprintf(out, "---- Processing branch %q for entry targeting %v\n", b.Name, entry.Target)
 
-		if err := run(newGitCmd("checkout", b.PRBranch())); err != nil {
+		if err := run(out, newGitCmd("checkout", b.PRBranch())); err != nil {
 			return nil, err
 		}
+		// Keep track of the Target commit to check if the branch is up to date later, even if a
+		// pre-merge hook commits changes on top of it.
+		baseCommit, err := combinedOutput(out, newGitCmd("rev-parse", "HEAD"))
+		if err != nil {
+			return nil, err
+		}
+		baseCommit = strings.TrimSpace(baseCommit)
+		results[i].TargetCommit = baseCommit
 
 		c := changedBranch{
-			Refs: b,
-			PRBody: "Hi! I'm a bot, and this is an automatically generated upstream sync PR. 🔃" +
+			Refs:       b,
+			BaseCommit: baseCommit,
+			PRBody: prBodyGreeting +
 				"\n\nAfter submitting the PR, I will attempt to enable auto-merge in the \"merge commit\" configuration." +
-				"\n\nFor more information, visit [sync documentation in microsoft/go-infra](https://github.com/microsoft/go-infra/tree/main/docs/automation/sync.md).",
+				prBodyDocs,
 			Result: &results[i],
 		}
 		var commitMessage string
 
+		// If a hook fails, mark the branch as failed and continue with the next branch, like a PR
+		// submission failure. Returns err if it isn't a hook failure.
+		handleHookError := func(err error) error {
+			var hookErr *HookError
+			if !errors.As(err, &hookErr) {
+				return err
+			}
+			fmt.Fprintln(out, err)
+			c.Result.Error = err.Error()
+			hookFailures = append(hookFailures, b.Name)
+			// Discard the partial sync so the next branch starts clean.
+			if err := run(out, newGitCmd("reset", "--hard", "--quiet")); err != nil {
+				return err
+			}
+			return run(out, newGitCmd("clean", "-ffdq"))
+		}
+
+		if err := runHooks(out, dir, "pre-merge", entry.PreMergeHooks, entry, b); err != nil {
+			if err := handleHookError(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(entry.PreMergeHooks) > 0 {
+			if err := run(out, newGitCmd("diff", "--cached", "--quiet")); err != nil {
+				if _, ok := err.(*exec.ExitError); !ok {
+					return nil, err
+				}
+				if err := run(out, newGitCmd("commit", "-m", "Apply pre-merge sync hook changes")); err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		if entry.SubmoduleTarget == "" {
+			upstreamCommit, err := combinedOutput(out, newGitCmd("rev-parse", b.UpstreamLocalSyncTarget()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to find upstream sync target in local repo after fetching: %w", err)
+			}
+			c.Result.UpstreamCommit = strings.TrimSpace(upstreamCommit)
+
 			// This is not a submodule update, so merge with the upstream repository.
-			if err := run(newGitCmd("merge", "--no-ff", "--no-commit", b.UpstreamLocalSyncTarget())); err != nil {
+			if err := run(out, newGitCmd("merge", "--no-ff", "--no-commit", b.UpstreamLocalSyncTarget())); err != nil {
 				if exitError, ok := err.(*exec.ExitError); ok {
-					fmt.Printf("---- Merge hit an ExitError: %q. A non-zero exit code is expected if there were conflicts. The script will try to resolve them, next.\n", exitError)
+					fmt.Fprintf(out, "---- Merge hit an ExitError: %q. A non-zero exit code is expected if there were conflicts. The script will try to resolve them, next.\n", exitError)
 				} else {
 					// Make sure we don't ignore more than we intended.
 					return nil, err
@@ -456,41 +933,95 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 				// Automatically resolve conflicts in specific project doc files. Use '--no-overlay' to make
 				// sure we delete new files in e.g. '.github' that are in upstream but don't exist locally.
 				// '--ours' auto-deletes if upstream modifies a file that we deleted in our branch.
-				if err := run(newGitCmd(append([]string{"checkout", "--no-overlay", "--ours", "HEAD", "--"}, entry.AutoResolveTarget...)...)); err != nil {
+				if err := run(out, newGitCmd(append([]string{"checkout", "--no-overlay", "--ours", "HEAD", "--"}, entry.AutoResolveTarget...)...)); err != nil {
 					return nil, err
 				}
 			}
+
+			// Resolve remaining conflicts that match AutoResolve rules.
+			resolved, err := autoResolveConflicts(out, dir, entry.AutoResolve)
+			if err != nil {
+				return nil, err
+			}
+
+			// If there are still conflicts, the merge can't continue. Report them to help with the
+			// manual merge.
+			conflicts, err := unmergedFiles(out, dir)
+			if err != nil {
+				return nil, err
+			}
+			if len(conflicts) > 0 {
+				if err := f.reportConflicts(out, dir, entry, c.Result, conflicts); err != nil {
+					return nil, err
+				}
+				if conflictPR == ConflictPROff {
+					return nil, fmt.Errorf("merging upstream %#q into %#q has %v conflicting file(s) that can't be resolved automatically", b.UpstreamName, b.Name, len(conflicts))
+				}
+				if err := stageConflicts(out, dir, conflicts, conflictPR); err != nil {
+					return nil, err
+				}
+				for _, u := range conflicts {
+					c.Conflicts = append(c.Conflicts, u.Path)
+				}
+				c.Result.Conflicts = c.Conflicts
+				// Use a separate PR branch, so the draft doesn't replace an auto-merge PR that
+				// may have been submitted before upstream introduced the conflict.
+				conflictRefs := *b
+				conflictRefs.Purpose = autoSyncConflictPurpose
+				c.Refs = &conflictRefs
+				c.PRBody = prBodyGreeting + conflictPRBody(c.Conflicts, conflictPR) + prBodyDocs
+			}
+
 			c.PRTitle = fmt.Sprintf("Merge upstream %#q into %#q", b.UpstreamName, b.Name)
+			if len(c.Conflicts) > 0 {
+				c.PRTitle = "[Conflicts] " + c.PRTitle
+			}
 			c.PRBody += fmt.Sprintf(
 				"\n\nThis PR merges %#q into %#q.\n\nIf PR validation fails and you need to fix up the PR, make sure to use a merge commit, not a squash or rebase!",
 				c.Refs.UpstreamName, c.Refs.Name,
 			)
+			c.PRBody += autoResolvedPRBody(resolved)
+
+			// The merge isn't committed yet, so HEAD is still the Target branch.
+			targetCommit, err := combinedOutput(out, newGitCmd("rev-parse", "HEAD"))
+			if err != nil {
+				return nil, err
+			}
+			c.UpstreamRange = strings.TrimSpace(targetCommit) + ".." + c.Result.UpstreamCommit
+			changelog, err := upstreamChangelog(out, dir, c.UpstreamRange)
+			if err != nil {
+				return nil, err
+			}
+			c.PRBody += changelogPRBody(changelog, entry.Upstream, entry.UpstreamMirror)
 			commitMessage = fmt.Sprintf("Merge upstream branch %q into %v", b.UpstreamName, b.Name)
+			if len(c.Conflicts) > 0 {
+				commitMessage += "\n\nConflicts:\n\t" + strings.Join(c.Conflicts, "\n\t")
+			}
 		} else {
 			// This is a submodule update. We'll be doing more evaluation to figure out which commit
 			// to update to, so define a helper func with captured context.
 			getTrimmedCmdOutput := func(args ...string) (string, error) {
-				out, err := combinedOutput(newGitCmd(args...))
+				o, err := combinedOutput(out, newGitCmd(args...))
 				if err != nil {
 					return "", err
 				}
-				return strings.TrimSpace(out), nil
+				return strings.TrimSpace(o), nil
 			}
 
 			// Set the content of the file at the path, creating the file if necessary, and add the
 			// file to the Git index for committing later. If the content is empty, delete the file
 			// if it exists.
 			updateFile := func(path, content string) error {
-				fmt.Printf("---- Setting %#q content: %q\n", path, content)
+				fmt.Fprintf(out, "---- Setting %#q content: %q\n", path, content)
 				if content == "" {
-					if err := run(newGitCmd("rm", "--ignore-unmatch", "--", path)); err != nil {
+					if err := run(out, newGitCmd("rm", "--ignore-unmatch", "--", path)); err != nil {
 						return err
 					}
 				} else {
 					if err := os.WriteFile(path, []byte(content), 0666); err != nil {
 						return err
 					}
-					if err := run(newGitCmd("add", "--", path)); err != nil {
+					if err := run(out, newGitCmd("add", "--", path)); err != nil {
 						return err
 					}
 				}
@@ -522,16 +1053,17 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 					// coincided with the potential time window where a commit has been pushed to
 					// Upstream before being pushed to UpstreamMirror. Or, the user gave a specific
 					// commit to use which is intentionally not the latest one in the branch.
-					fmt.Printf("--- Upstream and upstream mirror commits do not match: %v != %v\n", newCommit, upstreamMirrorCommit)
+					fmt.Fprintf(out, "--- Upstream and upstream mirror commits do not match: %v != %v\n", newCommit, upstreamMirrorCommit)
 				}
 
 				commonCommit, err := getTrimmedCmdOutput("merge-base", newCommit, upstreamMirrorCommit)
 				if err != nil {
 					return nil, err
 				}
-				fmt.Printf("---- Common commit of upstream and upstream mirror: %v\n", commonCommit)
+				fmt.Fprintf(out, "---- Common commit of upstream and upstream mirror: %v\n", commonCommit)
 				newCommit = commonCommit
 			}
+			c.Result.UpstreamCommit = newCommit
 
 			// Ensure either the VERSION file in the submodule is what we expect it to be, or the
 			// Microsoft Go repo contains a VERSION file specifying that version. This fixes boring
@@ -543,7 +1075,7 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 				upstreamVersion, err := getTrimmedCmdOutput("show", newCommit+":VERSION")
 				if err != nil {
 					if _, ok := err.(*exec.ExitError); ok {
-						fmt.Printf("---- VERSION file doesn't exist in submodule.\n")
+						fmt.Fprintf(out, "---- VERSION file doesn't exist in submodule.\n")
 					} else {
 						return nil, err
 					}
@@ -575,11 +1107,40 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 				}
 			}
 
+			// Find the current submodule commit to list the upstream changes in the update. If
+			// the submodule doesn't exist yet, or the history between the commits isn't available,
+			// skip the list: it's only informational.
+			if entry.hasNestedSubmodules() {
+				fetchSubmoduleTargetCommit(out, dir, remotes, entry)
+			}
+			var changelog []changelogCommit
+			if oldCommit, err := getTrimmedCmdOutput("rev-parse", "HEAD:"+entry.SubmoduleTarget); err != nil {
+				fmt.Fprintf(out, "---- Unable to find current submodule commit, skipping upstream changelog: %v\n", err)
+			} else if changelog, err = upstreamChangelog(out, dir, oldCommit+".."+newCommit); err != nil {
+				fmt.Fprintf(out, "---- Unable to list upstream commits, skipping upstream changelog: %v\n", err)
+			} else {
+				c.UpstreamRange = oldCommit + ".." + newCommit
+			}
+
+			submodules, submodulesPRBody, err := updateAdditionalSubmodules(out, dir, entry, b.UpstreamName)
+			if err != nil {
+				return nil, err
+			}
+			// Submodules nested inside SubmoduleTarget are updated by a commit on top of the
+			// upstream commit.
+			submoduleCommit, err := commitNestedSubmodules(out, dir, entry, newCommit, submodules)
+			if err != nil {
+				return nil, err
+			}
+			if submoduleCommit != newCommit {
+				c.SubmoduleRefspec = submoduleCommit + ":refs/heads/" + nestedSubmoduleBranch(submoduleCommit)
+			}
+
 			// Set the submodule commit directly in the Git index. This avoids the need to
 			// init/clone the submodule, which can be time-consuming. Mode 160000 means the tree
 			// entry is a submodule.
-			cacheInfo := fmt.Sprintf("160000,%v,%v", newCommit, entry.SubmoduleTarget)
-			if err := run(newGitCmd("update-index", "--cacheinfo", cacheInfo)); err != nil {
+			cacheInfo := fmt.Sprintf("160000,%v,%v", submoduleCommit, entry.SubmoduleTarget)
+			if err := run(out, newGitCmd("update-index", "--cacheinfo", cacheInfo)); err != nil {
 				return nil, err
 			}
 
@@ -591,51 +1152,77 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 
 			c.PRTitle = fmt.Sprintf("Update submodule to latest %#q in %#q", b.UpstreamName, b.Name)
 			commitMessage = fmt.Sprintf("Update submodule to latest %v (%v): %v", b.UpstreamName, newCommit[:8], snippet)
+			if len(submodules) == 0 {
+				c.PRBody += changelogPRBody(changelog, entry.Upstream, entry.UpstreamMirror)
+			} else {
+				c.PRTitle = fmt.Sprintf("Update submodules to latest %#q in %#q", b.UpstreamName, b.Name)
+				commitMessage += "\n\nAlso update submodules:"
+				c.Result.SubmoduleCommits = make(map[string]string, len(submodules))
+				for _, u := range submodules {
+					commitMessage += fmt.Sprintf("\n\t%v to %v", u.Path, u.Commit[:8])
+					c.Result.SubmoduleCommits[u.Path] = u.Commit
+				}
+				c.PRBody += changelogPRSection(
+					fmt.Sprintf("Upstream changes in `%v`", entry.SubmoduleTarget),
+					changelog, entry.Upstream, entry.UpstreamMirror)
+				c.PRBody += submodulesPRBody
+			}
 		}
 
-		// Check if there are any files in the stage. If not, we don't need to process this branch
-		// anymore, because the merge + autoresolve didn't change anything.
-		if err := run(newGitCmd("diff", "--cached", "--quiet")); err != nil {
+		if err := runHooks(out, dir, "post-merge", entry.PostMergeHooks, entry, b); err != nil {
+			if err := handleHookError(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Check if there are any changes compared to the Target branch. If not, we don't need to
+		// process this branch anymore, because the merge + autoresolve didn't change anything.
+		if err := run(out, newGitCmd("diff", "--cached", "--quiet", baseCommit)); err != nil {
 			if _, ok := err.(*exec.ExitError); ok {
-				fmt.Printf("---- Detected changes in Git stage. Continuing to commit and submit PR.\n")
+				fmt.Fprintf(out, "---- Detected changes in Git stage. Continuing to commit and submit PR.\n")
 			} else {
 				// Make sure we don't ignore more than we intended.
 				return nil, err
 			}
 		} else {
 			// If the diff had 0 exit code, there are no changes. Skip this branch's next steps.
-			fmt.Printf("---- No changes to sync for %v. Skipping.\n", b.Name)
+			fmt.Fprintf(out, "---- No changes to sync for %v. Skipping.\n", b.Name)
 
-			// Save the current commit in the result struct. This lets the caller know exactly what
+			// Save the Target commit in the result struct. This lets the caller know exactly what
 			// commit was found to be up to date, to avoid racing with other changes being merged
 			// into the target repo.
-			commit, err := combinedOutput(newGitCmd("rev-parse", "HEAD"))
-			if err != nil {
-				return nil, err
-			}
-			c.Result.Commit = commit
+			c.Result.Commit = baseCommit
+			c.Result.UpToDate = true
 
 			continue
 		}
 
 		// If we still have unmerged files, 'git commit' will exit non-zero, causing the script to
 		// exit. This prevents the script from pushing a bad merge.
-		if err := run(newGitCmd("commit", "-m", commitMessage)); err != nil {
+		if err := run(out, newGitCmd("commit", "-m", commitMessage)); err != nil {
 			return nil, err
 		}
 
 		// Save the created commit in the result struct.
-		commit, err := combinedOutput(newGitCmd("rev-parse", "HEAD"))
+		commit, err := combinedOutput(out, newGitCmd("rev-parse", "HEAD"))
 		if err != nil {
 			return nil, err
 		}
-		c.Result.Commit = commit
+		c.Result.Commit = strings.TrimSpace(commit)
+
+		if c.Refs.PRBranch() != b.PRBranch() {
+			// Point the separate conflict PR branch at the commit so it's pushed.
+			if err := run(out, newGitCmd("branch", "--force", c.Refs.PRBranch(), "HEAD")); err != nil {
+				return nil, err
+			}
+		}
 
 		if entry.SubmoduleTarget == "" {
 			// Show a summary of which files are in our fork branch vs. upstream. This is just
 			// informational. CI is a better place to *enforce* a low diff: it's more visible, can
 			// be fixed up more easily, and doesn't block other branch mirror/merge operations.
-			diff, err := combinedOutput(newGitCmd(
+			diff, err := combinedOutput(out, newGitCmd(
 				"diff",
 				"--name-status",
 				b.UpstreamLocalBranch(),
@@ -676,25 +1263,66 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 		changedBranches = append(changedBranches, c)
 	}
 
+	var hookErr error
+	if len(hookFailures) > 0 {
+		hookErr = fmt.Errorf("hooks failed for %v branch(es): %v", len(hookFailures), strings.Join(hookFailures, ", "))
+	}
+
 	if len(changedBranches) == 0 {
-		fmt.Println("Checked branches for changes to sync: none found.")
-		fmt.Println("Success.")
+		fmt.Fprintln(out, "Checked branches for changes to sync: none found.")
+		if hookErr != nil {
+			return results, hookErr
+		}
+		fmt.Fprintln(out, "Success.")
 		return results, nil
 	}
 
-	newGitPushCommand := func(remote string, force bool, refspecs []string) *exec.Cmd {
+	if *f.DryRun {
+		if err := f.previewDryRun(out, dir, entry, changedBranches); err != nil {
+			return nil, err
+		}
+	}
+
+	newGitPushCommand := func(remote string, force bool, refspecs []string) (*exec.Cmd, error) {
+		pushURL, err := remotes.pushURL(out, remote)
+		if err != nil {
+			return nil, err
+		}
 		c := newGitCmd("push")
 		if force {
 			c.Args = append(c.Args, "--force")
 		}
-		c.Args = append(c.Args, auther.InsertAuth(remote))
+		c.Args = append(c.Args, pushURL)
 		for _, r := range refspecs {
 			c.Args = append(c.Args, r)
 		}
 		if *f.DryRun {
 			c.Args = append(c.Args, "-n")
 		}
-		return c
+		return c, nil
+	}
+
+	// Push the commits that update nested submodules before the PR branches that point at them. Each
+	// commit has its own branch, so there's no need to force.
+	var submodulePushRefspecs []string
+	for _, b := range changedBranches {
+		if b.SubmoduleRefspec != "" {
+			submodulePushRefspecs = append(submodulePushRefspecs, b.SubmoduleRefspec)
+		}
+	}
+	if len(submodulePushRefspecs) > 0 {
+		push, err := newGitPushCommand(entry.SubmoduleTargetRepo, false, submodulePushRefspecs)
+		if err != nil {
+			return nil, err
+		}
+		if err := run(out, push); err != nil {
+			return nil, err
+		}
+		if !*f.DryRun {
+			if err := remotes.pushed(out, entry.SubmoduleTargetRepo); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Force push the merge branches. We can't do a fast-forward push: our new merge commit is based
@@ -707,107 +1335,112 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 	for _, b := range changedBranches {
 		mergePushRefspecs = append(mergePushRefspecs, b.Refs.PRBranchRefspec())
 	}
-	if err := run(newGitPushCommand(entry.PRBranchStorageRepo(), true, mergePushRefspecs)); err != nil {
+	push, err := newGitPushCommand(entry.PRBranchStorageRepo(), true, mergePushRefspecs)
+	if err != nil {
+		return nil, err
+	}
+	if err := run(out, push); err != nil {
 		return nil, err
 	}
+	if !*f.DryRun {
+		if err := remotes.pushed(out, entry.PRBranchStorageRepo()); err != nil {
+			return nil, err
+		}
+	}
 
-	// All Git operations are complete! Next, ensure there's a GitHub PR for each auto-merge branch.
+	// All Git operations are complete! Next, ensure there's a PR for each auto-merge branch.
 
 	// Accumulate overall failure. This lets PR submission continue even if there's a problem for a
 	// specific branch.
 	var prFailed bool
 
-	// Parse the URLs involved in the PR to get segment information.
-	parsedPRTargetRemote, err := gitpr.ParseRemoteURL(entry.Target)
-	if err != nil {
-		return nil, err
-	}
-	parsedPRHeadRemote, err := gitpr.ParseRemoteURL(entry.PRBranchStorageRepo())
-	if err != nil {
-		return nil, err
+	// Figure out if we can submit PRs at all. If so, set up the forge that hosts the target repo.
+	var skipReason string
+	var forge gitpr.Forge
+	if *f.DryRun {
+		skipReason = "Dry run"
+	} else if f.OutputBundleDir != nil && *f.OutputBundleDir != "" {
+		skipReason = "Writing bundles instead of pushing"
+	} else {
+		skipReason, err = f.missingForgeAuth(entry)
+		if err != nil {
+			return nil, err
+		}
+		if skipReason == "" {
+			forge, err = f.newForge(out, entry)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
+	ctx := context.Background()
+
 	for _, b := range changedBranches {
 		prFlowDescription := fmt.Sprintf("%v -> %v", b.Refs.UpstreamName, b.Refs.PRBranch())
 
-		fmt.Printf("---- %s: Checking if PR should be submitted.\n", prFlowDescription)
-		fmt.Printf("---- PR Title: %s\n", b.PRTitle)
-		fmt.Printf("---- PR Body:\n%s\n", b.PRBody)
-
-		var skipReason string
-		switch {
-		case *f.DryRun:
-			skipReason = "Dry run"
-
-		case *f.GitHubUser == "":
-			skipReason = "github-user not provided"
-		case *f.GitHubPAT == "":
-			skipReason = "github-pat not provided"
-
-		case *f.GitHubPATReviewer == "":
-			// In theory, if we have githubPAT but no reviewer, we can submit the PR but skip
-			// reviewing it/enabling auto-merge. However, this doesn't seem very useful, so it isn't
-			// implemented.
-			skipReason = "github-pat-reviewer not provided"
-		}
+		fmt.Fprintf(out, "---- %s: Checking if PR should be submitted.\n", prFlowDescription)
+		fmt.Fprintf(out, "---- PR Title: %s\n", b.PRTitle)
+		fmt.Fprintf(out, "---- PR Body:\n%s\n", b.PRBody)
 
 		if skipReason != "" {
-			fmt.Printf("---- %s: skipping submitting PR for %v\n", skipReason, prFlowDescription)
+			fmt.Fprintf(out, "---- %s: skipping submitting PR for %v\n", skipReason, prFlowDescription)
 			continue
 		}
 
-		// err contains any err we get from running the sequence of GitHub PR submission API calls.
+		// err contains any err we get from running the sequence of PR submission API calls.
 		//
 		// This uses an immediately invoked anonymous function for convenience/maintainability. We
 		// can 'return err' from anywhere in the function, to keep control flow simple. Also, we can
 		// capture vars from the 'main()' scope rather than making them global or explicitly passing
 		// each one into a named function.
 		err := func() error {
-			fmt.Printf("---- PR for %v: Submitting...\n", prFlowDescription)
+			fmt.Fprintf(out, "---- PR for %v: Submitting...\n", prFlowDescription)
 
-			request := b.Refs.CreateGitHubPR(parsedPRHeadRemote.GetOwner(), b.PRTitle, b.PRBody)
+			request := b.Refs.CreatePRRequest(b.PRTitle, truncatePRBody(b.PRBody))
+			request.Draft = len(b.Conflicts) > 0
 
-			// POST the PR. The call returns success if the PR is created or if we receive a
-			// specific error message back from GitHub saying the PR is already created.
-			pr, err := gitpr.PostGitHub(parsedPRTargetRemote.GetOwnerSlashRepo(), request, *f.GitHubPAT)
-			fmt.Printf("%+v\n", pr)
+			// Create the PR. The call returns success if the PR is created, or a specific error if
+			// the forge says the PR is already created.
+			pr, err := forge.CreatePR(ctx, request)
+			fmt.Fprintf(out, "%+v\n", pr)
 			if err != nil {
-				return err
-			}
-
-			if pr.AlreadyExists {
-				fmt.Println("---- A PR already exists. Attempting to find it...")
-				existingPR, err := gitpr.FindExistingPR(
-					request,
-					parsedPRHeadRemote,
-					parsedPRTargetRemote,
-					b.Refs.PRBranch(),
-					*f.GitHubUser,
-					*f.GitHubPAT)
+				if !errors.Is(err, gitpr.ErrPRAlreadyExists) {
+					return err
+				}
+				fmt.Fprintln(out, "---- A PR already exists. Attempting to find it...")
+				pr, err = forge.FindExistingPR(ctx, request)
 				if err != nil {
 					return err
 				}
 				if pr == nil {
 					return fmt.Errorf("no PR found")
 				}
-				pr.NodeID = existingPR.ID
-				pr.Number = existingPR.Number
+				b.Result.PR, b.Result.PRReused = pr, true
 			} else {
-				fmt.Printf("---- Submitted brand new PR: %v\n", pr.HTMLURL)
+				b.Result.PR, b.Result.PRCreated = pr, true
+				fmt.Fprintf(out, "---- Submitted brand new PR: %v\n", pr.URL)
+			}
+
+			if len(b.Conflicts) > 0 {
+				fmt.Fprintf(out, "---- PR has conflicts to resolve manually: not approving or enabling auto-merge.\n")
+				fmt.Fprintf(out, "---- PR for %v: Done.\n", prFlowDescription)
+				return nil
+			}
 
-				fmt.Printf("---- Approving with reviewer account...\n")
-				if err = gitpr.ApprovePR(pr.NodeID, *f.GitHubPATReviewer); err != nil {
+			if b.Result.PRCreated {
+				fmt.Fprintf(out, "---- Approving with reviewer account...\n")
+				if err = forge.ApprovePR(ctx, pr); err != nil {
 					return err
 				}
 			}
 
-			fmt.Printf("---- Enabling auto-merge with reviewer account...\n")
-			if err = gitpr.EnablePRAutoMerge(pr.NodeID, *f.GitHubPATReviewer); err != nil {
+			fmt.Fprintf(out, "---- Enabling auto-merge with reviewer account...\n")
+			if err = forge.EnablePRAutoMerge(ctx, pr); err != nil {
 				return err
 			}
 
-			fmt.Printf("---- PR for %v: Done.\n", prFlowDescription)
-			b.Result.PR = pr
+			fmt.Fprintf(out, "---- PR for %v: Done.\n", prFlowDescription)
 			return nil
 		}()
 
@@ -821,7 +1454,8 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 		// try to update go1.15 in future runs of this script, go1.16 will never get synced. This is
 		// why we want to try to keep processing branches.
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(out, err)
+			b.Result.Error = err.Error()
 			prFailed = true
 			continue
 		}
@@ -829,28 +1463,28 @@ func MakeBranchPRs(f *Flags, dir string, entry *ConfigEntry) ([]SyncResult, erro
 
 	// If PR submission failed for any branch, exit the overall script with NZEC.
 	if prFailed {
-		return nil, fmt.Errorf("failed to submit one or more PRs")
+		return results, fmt.Errorf("failed to submit one or more PRs")
 	}
 
-	return results, nil
+	return results, hookErr
 }
 
-// run sets up the command so it logs directly to our stdout/stderr streams, then runs it.
-func run(c *exec.Cmd) error {
-	fmt.Printf("---- Running command: %v %v\n", c.Path, c.Args)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
+// run sets up the command so it logs directly to out, then runs it.
+func run(out io.Writer, c *exec.Cmd) error {
+	fmt.Fprintf(out, "---- Running command: %v %v\n", c.Path, c.Args)
+	c.Stdout = out
+	c.Stderr = out
 	return c.Run()
 }
 
 // combinedOutput returns the output string of c.CombinedOutput.
-func combinedOutput(c *exec.Cmd) (string, error) {
-	fmt.Printf("---- Running command: %v %v\n", c.Path, c.Args)
-	out, err := c.CombinedOutput()
+func combinedOutput(out io.Writer, c *exec.Cmd) (string, error) {
+	fmt.Fprintf(out, "---- Running command: %v %v\n", c.Path, c.Args)
+	output, err := c.CombinedOutput()
 	if err != nil {
 		return "", err
 	}
-	return string(out), nil
+	return string(output), nil
 }
 
 func createCommitMessageSnippet(message string) string {
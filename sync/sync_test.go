@@ -126,6 +126,7 @@ func Test_MakeBranchPRs_VersionUpdate(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
+		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			d := t.TempDir()
@@ -299,5 +300,5 @@ func addMockFile(dir, relativePath, content string) error {
 func runGit(dir string, args ...string) error {
 	cmd := exec.Command("git", args...)
 	cmd.Dir = dir
-	return run(cmd)
+	return run(os.Stdout, cmd)
 }
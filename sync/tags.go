@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RewrittenTagError is returned when a tag that sync would push already exists in the destination
+// repository, but points at a different object than the upstream tag. Upstream release tags are
+// never expected to move, so this needs investigation rather than a force push.
+type RewrittenTagError struct {
+	Repo string
+	// Tags lists each rewritten tag.
+	Tags []MirrorDrift
+}
+
+func (e *RewrittenTagError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "refusing to overwrite %v tag(s) in %v that differ from upstream: the tags may have been rewritten upstream:", len(e.Tags), e.Repo)
+	for _, t := range e.Tags {
+		b.WriteString("\n  ")
+		b.WriteString(t.String())
+	}
+	return b.String()
+}
+
+// pushTags pushes the upstream tags that match patterns and don't exist yet in the repository at
+// repoURL. upstreamRefs are the refs in upstream, from lsRemote. Returns *RewrittenTagError without
+// pushing anything if a matching tag exists in both repositories but points at different objects.
+func pushTags(out io.Writer, dir string, remotes *remoteSet, dryRun bool, upstreamURL string, upstreamRefs map[string]string, patterns []string, repoURL string) error {
+	pushURL, err := remotes.pushURL(out, repoURL)
+	if err != nil {
+		return err
+	}
+	destRefs, err := lsRemote(out, dir, pushURL)
+	if err != nil {
+		return err
+	}
+
+	fetch := []string{"fetch", "--no-tags", upstreamURL}
+	push := []string{"push", pushURL}
+	rewritten := &RewrittenTagError{Repo: repoURL}
+	for _, ref := range sortedKeys(upstreamRefs) {
+		name := strings.TrimPrefix(ref, "refs/tags/")
+		if name == ref {
+			continue
+		}
+		match, err := matchAny(patterns, name)
+		if err != nil {
+			return err
+		}
+		if !match {
+			continue
+		}
+		switch destRefs[ref] {
+		case upstreamRefs[ref]:
+			continue
+		case "":
+			local := mirrorFetchNamespace + "tags/" + name
+			fetch = append(fetch, "+"+ref+":"+local)
+			push = append(push, local+":"+ref)
+		default:
+			rewritten.Tags = append(rewritten.Tags, MirrorDrift{Ref: ref, UpstreamCommit: upstreamRefs[ref], MirrorCommit: destRefs[ref]})
+		}
+	}
+	if len(rewritten.Tags) > 0 {
+		return rewritten
+	}
+	if len(push) == 2 {
+		fmt.Fprintf(out, "---- No new tags to push to %v.\n", repoURL)
+		return nil
+	}
+
+	if err := run(out, newDirGitCmd(dir, fetch...)); err != nil {
+		return err
+	}
+	if dryRun {
+		push = append(push, "-n")
+	}
+	if err := run(out, newDirGitCmd(dir, push...)); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	return remotes.pushed(out, repoURL)
+}
@@ -0,0 +1,305 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/go-infra/gitpr"
+)
+
+// ConfigProblem is a problem found in a sync config file by validation.
+type ConfigProblem struct {
+	// Path is the JSON path of the value with the problem, e.g. '$[0].BranchMap["main"]'.
+	Path    string
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// ConfigProblemsError is an error containing all the problems found in a sync config.
+type ConfigProblemsError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigProblemsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %v problem(s) in sync config:", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// ValidateConfigFile reads the sync config file at path and returns the problems found in it.
+// Unlike Flags.ReadConfig, this also reports properties that don't match any ConfigEntry field,
+// which are otherwise silently ignored. Returns an error if the file can't be read or isn't JSON.
+func ValidateConfigFile(path string) ([]ConfigProblem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync config file: %w", err)
+	}
+	var rawEntries []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rawEntries); err != nil {
+		return nil, fmt.Errorf("failed to parse sync config file %v as a JSON list of objects: %w", path, err)
+	}
+	var entries []ConfigEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse sync config file %v: %w", path, err)
+	}
+
+	// encoding/json matches property names to fields case-insensitively.
+	knownFields := make(map[string]struct{})
+	t := reflect.TypeOf(ConfigEntry{})
+	for i := 0; i < t.NumField(); i++ {
+		knownFields[strings.ToLower(t.Field(i).Name)] = struct{}{}
+	}
+
+	var problems []ConfigProblem
+	for i, raw := range rawEntries {
+		names := make([]string, 0, len(raw))
+		for name := range raw {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := knownFields[strings.ToLower(name)]; !ok {
+				problems = append(problems, ConfigProblem{
+					Path:    fmt.Sprintf("$[%v].%v", i, name),
+					Message: "unknown property",
+				})
+			}
+		}
+	}
+	return append(problems, ValidateConfig(entries)...), nil
+}
+
+// ValidateConfig checks each entry in a sync config and returns all problems found. It doesn't
+// access the network, so it can't check that repositories or branches exist.
+func ValidateConfig(entries []ConfigEntry) []ConfigProblem {
+	var problems []ConfigProblem
+	for i := range entries {
+		problems = append(problems, entries[i].Validate(fmt.Sprintf("$[%v]", i))...)
+	}
+	return problems
+}
+
+var commitHashRegexp = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// Validate checks the entry and returns all problems found. path is the JSON path of the entry,
+// used as the prefix of each problem's path: for example, "$[0]" for the first entry in a file.
+func (c *ConfigEntry) Validate(path string) []ConfigProblem {
+	var problems []ConfigProblem
+	add := func(subPath, format string, a ...interface{}) {
+		problems = append(problems, ConfigProblem{
+			Path:    path + subPath,
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+
+	if c.Upstream == "" {
+		add(".Upstream", "required")
+	}
+	if c.Target == "" {
+		add(".Target", "required")
+	} else if kind, err := gitpr.DetectForgeKind(c.Target); err != nil {
+		add(".Target", "not a supported GitHub or Azure DevOps repository URL: %v", err)
+	} else if c.Head != "" {
+		if kind == gitpr.ForgeAzDO {
+			if c.Head != c.Target {
+				add(".Head", "Azure DevOps Targets don't support a separate Head repository")
+			}
+		} else if headKind, err := gitpr.DetectForgeKind(c.Head); err != nil || headKind != kind {
+			add(".Head", "must be on the same forge as Target")
+		}
+	}
+
+	if len(c.BranchMap) == 0 {
+		add(".BranchMap", "required")
+	}
+	patterns := sortedKeys(c.BranchMap)
+	var badPattern bool
+	for i, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			add(fmt.Sprintf(".BranchMap[%q]", p), "invalid glob pattern: %v", err)
+			badPattern = true
+			continue
+		}
+		if c.BranchMap[p] == "" {
+			add(fmt.Sprintf(".BranchMap[%q]", p), "target branch is empty")
+		}
+		for _, other := range patterns[i+1:] {
+			if globsOverlap(p, other) {
+				add(fmt.Sprintf(".BranchMap[%q]", p), "overlaps with %q: a branch may match both patterns", other)
+			}
+		}
+	}
+
+	// If a pattern is invalid, TargetBranch fails for every branch. The pattern is already reported.
+	for i := 0; i < len(c.AutoSyncBranches) && !badPattern; i++ {
+		b := c.AutoSyncBranches[i]
+		target, err := c.TargetBranch(b)
+		if err != nil {
+			add(fmt.Sprintf(".AutoSyncBranches[%v]", i), "%v", err)
+		} else if target == "" {
+			add(fmt.Sprintf(".AutoSyncBranches[%v]", i), "%q doesn't match any BranchMap pattern", b)
+		}
+	}
+
+	if len(c.AutoMirrorBranches) > 0 && c.MirrorTarget == "" {
+		add(".AutoMirrorBranches", "has no effect without a MirrorTarget")
+	}
+	for i, b := range c.AutoMirrorBranches {
+		if _, err := filepath.Match(b, ""); err != nil {
+			add(fmt.Sprintf(".AutoMirrorBranches[%v]", i), "invalid glob pattern: %v", err)
+		}
+	}
+
+	if len(c.AutoMirrorTags) > 0 && c.MirrorTarget == "" {
+		add(".AutoMirrorTags", "has no effect without a MirrorTarget")
+	}
+	if len(c.AutoTargetTags) > 0 && c.SubmoduleTarget != "" {
+		add(".AutoTargetTags", "can't be used when SubmoduleTarget is set: Target doesn't contain Upstream's history")
+	}
+	for i, t := range c.AutoMirrorTags {
+		if _, err := filepath.Match(t, ""); err != nil {
+			add(fmt.Sprintf(".AutoMirrorTags[%v]", i), "invalid glob pattern: %v", err)
+		}
+	}
+	for i, t := range c.AutoTargetTags {
+		if _, err := filepath.Match(t, ""); err != nil {
+			add(fmt.Sprintf(".AutoTargetTags[%v]", i), "invalid glob pattern: %v", err)
+		}
+	}
+
+	for _, b := range sortedKeys(c.SourceBranchLatestCommit) {
+		if !commitHashRegexp.MatchString(c.SourceBranchLatestCommit[b]) {
+			add(fmt.Sprintf(".SourceBranchLatestCommit[%q]", b), "not a full lowercase commit hash")
+		}
+	}
+
+	if c.SubmoduleTarget != "" && len(c.AutoResolveTarget) > 0 {
+		add(".AutoResolveTarget", "has no effect when SubmoduleTarget is set: a submodule update doesn't merge files")
+	}
+	if c.SubmoduleTarget != "" && len(c.AutoResolve) > 0 {
+		add(".AutoResolve", "has no effect when SubmoduleTarget is set: a submodule update doesn't merge files")
+	}
+	for i := range c.AutoResolve {
+		if problem := c.AutoResolve[i].validate(); problem != "" {
+			add(fmt.Sprintf(".AutoResolve[%v]", i), "%v", problem)
+		}
+	}
+	if len(c.AdditionalSubmodules) > 0 && c.SubmoduleTarget == "" {
+		add(".AdditionalSubmodules", "requires SubmoduleTarget")
+	}
+	paths := map[string]bool{c.SubmoduleTarget: true}
+	for i, sm := range c.AdditionalSubmodules {
+		p := fmt.Sprintf(".AdditionalSubmodules[%v]", i)
+		if sm.Path == "" {
+			add(p+".Path", "required")
+		} else if paths[sm.Path] {
+			add(p+".Path", "submodule %q is already updated by this entry", sm.Path)
+		}
+		paths[sm.Path] = true
+		if sm.Upstream == "" {
+			add(p+".Upstream", "required")
+		}
+	}
+	if c.hasNestedSubmodules() {
+		if c.SubmoduleTargetRepo == "" {
+			add(".SubmoduleTargetRepo", "required when an AdditionalSubmodules path is inside SubmoduleTarget")
+		}
+	} else if c.SubmoduleTargetRepo != "" {
+		add(".SubmoduleTargetRepo", "has no effect unless an AdditionalSubmodules path is inside SubmoduleTarget")
+	}
+	for i, h := range c.PreMergeHooks {
+		if len(h.Command) == 0 || h.Command[0] == "" {
+			add(fmt.Sprintf(".PreMergeHooks[%v].Command", i), "required")
+		}
+	}
+	for i, h := range c.PostMergeHooks {
+		if len(h.Command) == 0 || h.Command[0] == "" {
+			add(fmt.Sprintf(".PostMergeHooks[%v].Command", i), "required")
+		}
+	}
+	if c.SubmoduleTarget == "" {
+		if c.GoVersionFileContent != "" {
+			add(".GoVersionFileContent", "has no effect unless SubmoduleTarget is set")
+		}
+		if c.GoMicrosoftRevisionFileContent != "" {
+			add(".GoMicrosoftRevisionFileContent", "has no effect unless SubmoduleTarget is set")
+		}
+	}
+	return problems
+}
+
+// globsOverlap returns true if it finds a branch name that matches both glob patterns. It tries
+// each pattern as a literal name, and sample names derived from each pattern. This catches common
+// mistakes like "release-*" and "release-branch.go*", but it isn't an exhaustive check.
+func globsOverlap(a, b string) bool {
+	for _, name := range append(globSamples(a), globSamples(b)...) {
+		matchA, errA := filepath.Match(a, name)
+		matchB, errB := filepath.Match(b, name)
+		if errA == nil && errB == nil && matchA && matchB {
+			return true
+		}
+	}
+	return false
+}
+
+// globSamples returns names that match pattern, and the pattern itself.
+func globSamples(pattern string) []string {
+	samples := []string{pattern}
+	for _, star := range []string{"", "x"} {
+		var b strings.Builder
+		for i := 0; i < len(pattern); i++ {
+			switch ch := pattern[i]; ch {
+			case '*':
+				b.WriteString(star)
+			case '?':
+				b.WriteByte('x')
+			case '\\':
+				if i+1 < len(pattern) {
+					i++
+					b.WriteByte(pattern[i])
+				}
+			case '[':
+				// Use the first character in the class, unless the class is negated.
+				end := strings.IndexByte(pattern[i:], ']')
+				if end < 0 {
+					return samples
+				}
+				class := pattern[i+1 : i+end]
+				if class == "" || class[0] == '^' {
+					return samples
+				}
+				b.WriteByte(class[0])
+				i += end
+			default:
+				b.WriteByte(ch)
+			}
+		}
+		samples = append(samples, b.String())
+	}
+	return samples
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigEntry_Validate(t *testing.T) {
+	valid := func() *ConfigEntry {
+		return &ConfigEntry{
+			Upstream: "https://go.googlesource.com/go",
+			Target:   "https://github.com/microsoft/go",
+			BranchMap: map[string]string{
+				"master":             "microsoft/main",
+				"release-branch.go*": "microsoft/?",
+			},
+			AutoSyncBranches: []string{"master"},
+			SubmoduleTarget:  "go",
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(c *ConfigEntry)
+		want   []ConfigProblem
+	}{
+		{"valid", func(c *ConfigEntry) {}, nil},
+		{
+			"overlapping globs",
+			func(c *ConfigEntry) { c.BranchMap["release-*"] = "microsoft/?" },
+			[]ConfigProblem{
+				{`$.BranchMap["release-*"]`, `overlaps with "release-branch.go*": a branch may match both patterns`},
+			},
+		},
+		{
+			"auto sync branch without match",
+			func(c *ConfigEntry) { c.AutoSyncBranches = append(c.AutoSyncBranches, "dev.boringcrypto") },
+			[]ConfigProblem{
+				{"$.AutoSyncBranches[1]", `"dev.boringcrypto" doesn't match any BranchMap pattern`},
+			},
+		},
+		{
+			"submodule with auto resolve",
+			func(c *ConfigEntry) { c.AutoResolveTarget = []string{"CODEOWNERS"} },
+			[]ConfigProblem{
+				{"$.AutoResolveTarget", "has no effect when SubmoduleTarget is set: a submodule update doesn't merge files"},
+			},
+		},
+		{
+			"unsupported target",
+			func(c *ConfigEntry) { c.Target = "https://go.googlesource.com/go" },
+			[]ConfigProblem{
+				{"$.Target", `not a supported GitHub or Azure DevOps repository URL: unable to determine forge for repository URL "https://go.googlesource.com/go": expected a github.com or Azure DevOps URL`},
+			},
+		},
+		{
+			"azdo target with separate head",
+			func(c *ConfigEntry) {
+				c.Target = "https://dnceng@dev.azure.com/dnceng/internal/_git/microsoft-go"
+				c.Head = "https://dnceng@dev.azure.com/dnceng/internal/_git/microsoft-go-fork"
+			},
+			[]ConfigProblem{
+				{"$.Head", "Azure DevOps Targets don't support a separate Head repository"},
+			},
+		},
+		{
+			"bad auto resolve rules",
+			func(c *ConfigEntry) {
+				c.SubmoduleTarget = ""
+				c.AutoResolve = []AutoResolveRule{
+					{Pattern: "go.mod", Strategy: "merge"},
+					{Pattern: "*.txt", Strategy: ResolveResolver, Resolver: "missing"},
+					{Pattern: "VERSION", Strategy: ResolveOurs, Resolver: "missing"},
+				}
+			},
+			[]ConfigProblem{
+				{"$.AutoResolve[0]", `unknown strategy "merge"`},
+				{"$.AutoResolve[1]", `no resolver registered with name "missing"`},
+				{"$.AutoResolve[2]", `Resolver is only used by the "resolver" strategy`},
+			},
+		},
+		{
+			"tags",
+			func(c *ConfigEntry) {
+				c.AutoMirrorTags = []string{"go1.*"}
+				c.AutoTargetTags = []string{"[go"}
+			},
+			[]ConfigProblem{
+				{"$.AutoMirrorTags", "has no effect without a MirrorTarget"},
+				{"$.AutoTargetTags", "can't be used when SubmoduleTarget is set: Target doesn't contain Upstream's history"},
+				{"$.AutoTargetTags[0]", "invalid glob pattern: syntax error in pattern"},
+			},
+		},
+		{
+			"additional submodules",
+			func(c *ConfigEntry) {
+				c.AdditionalSubmodules = []AdditionalSubmodule{
+					{Path: "go", Upstream: "https://github.com/golang/go"},
+					{Path: "x/crypto"},
+					{Upstream: "https://github.com/golang/sys"},
+					{Path: "go/src/vendor/x", Upstream: "https://github.com/golang/text"},
+				}
+			},
+			[]ConfigProblem{
+				{"$.AdditionalSubmodules[0].Path", `submodule "go" is already updated by this entry`},
+				{"$.AdditionalSubmodules[1].Upstream", "required"},
+				{"$.AdditionalSubmodules[2].Path", "required"},
+				{"$.SubmoduleTargetRepo", "required when an AdditionalSubmodules path is inside SubmoduleTarget"},
+			},
+		},
+		{
+			"submodule target repo",
+			func(c *ConfigEntry) {
+				c.SubmoduleTargetRepo = "https://github.com/microsoft/go-submodule"
+			},
+			[]ConfigProblem{
+				{"$.SubmoduleTargetRepo", "has no effect unless an AdditionalSubmodules path is inside SubmoduleTarget"},
+			},
+		},
+		{
+			"hooks",
+			func(c *ConfigEntry) {
+				c.PreMergeHooks = []Hook{{Name: "empty"}}
+				c.PostMergeHooks = []Hook{{Command: []string{"go", "mod", "tidy"}}, {Command: []string{""}}}
+			},
+			[]ConfigProblem{
+				{"$.PreMergeHooks[0].Command", "required"},
+				{"$.PostMergeHooks[1].Command", "required"},
+			},
+		},
+		{
+			"bad glob and commit",
+			func(c *ConfigEntry) {
+				c.BranchMap["[main"] = "microsoft/main"
+				c.SourceBranchLatestCommit = map[string]string{"master": "abc"}
+			},
+			[]ConfigProblem{
+				{`$.BranchMap["[main"]`, "invalid glob pattern: syntax error in pattern"},
+				{`$.SourceBranchLatestCommit["master"]`, "not a full lowercase commit hash"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			if got := c.Validate("$"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	t.Run("repo config", func(t *testing.T) {
+		problems, err := ValidateConfigFile(filepath.Join("..", "eng", "sync-config.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) != 0 {
+			t.Errorf("unexpected problems: %v", problems)
+		}
+	})
+	t.Run("unknown property", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "sync-config.json")
+		content := `[{"Upstream": "https://go.googlesource.com/go", "Target": "https://github.com/microsoft/go", "BranchMap": {"master": "microsoft/main"}, "AutoSyncBranch": ["master"]}]`
+		if err := os.WriteFile(p, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		problems, err := ValidateConfigFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []ConfigProblem{{"$[0].AutoSyncBranch", "unknown property"}}
+		if !reflect.DeepEqual(problems, want) {
+			t.Errorf("ValidateConfigFile() = %v, want %v", problems, want)
+		}
+	})
+}